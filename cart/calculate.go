@@ -1,82 +1,133 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+var (
+	errCouponNotActive  = errors.New("coupon is not active")
+	errCurrencyMismatch = errors.New("coupon is not valid in the currency of the cart")
+	errConditionsNotMet = errors.New("cart does not meet the conditions of the coupon")
 )
 
 // GetAppliableCoupons will return the list of all the applicable coupons
-func GetAppliableCoupons(items []PricedItem, coupons []coupon.Coupon) []DiscountCoupon {
+// coupons outside their validity window at now, without remaining uses
+// or not valid in the currency of the cart are skipped, so are the coupons whose conditions or expression the cart does not meet
+// and the first order coupons for a customer who has completed an order or an anonymous cart
+// usages is the map of couponID -> usage, missing coupon will be treated as never used
+// cust is the customer of the cart, nil for an anonymous cart
+// the percentage discounts are rounded to the minor unit with the rounding
+func GetAppliableCoupons(items []PricedItem, coupons []coupon.Coupon, now time.Time, usages map[int]coupon.Usage, cust *customer.Customer, rounding money.Rounding) []DiscountCoupon {
 	if len(items) == 0 || len(coupons) == 0 {
 		return nil
 	}
-	totalPrice := 0
-	for _, item := range items {
-		totalPrice += item.Price * item.Quantity
-	}
+	totalPrice := totalOf(items)
 
 	result := make([]DiscountCoupon, 0, len(coupons))
 
-	for couponID, coupon := range coupons {
-		switch coupon.Type {
-		case "cart-wise":
-			if discount, ok := appliableCartWiseCoupons(totalPrice, coupon); ok {
-				result = append(result, DiscountCoupon{
-					CouponID: couponID,
-					Type:     coupon.Type,
-					Discount: discount,
-				})
-			}
-		case "product-wise":
-			if discount, ok := appliableProductWiseCoupon(items, coupon); ok {
-				result = append(result, DiscountCoupon{
-					CouponID: couponID,
-					Type:     coupon.Type,
-					Discount: discount,
-				})
-			}
-		case "bxgy":
-			if discount, _, ok := appliableBxGYCoupon(items, coupon); ok {
-				result = append(result, DiscountCoupon{
-					CouponID: couponID,
-					Type:     coupon.Type,
-					Discount: discount,
-				})
-			}
-		default:
-			panic(fmt.Errorf("unsupported coupon type %s", coupon.Type))
+	for _, coup := range coupons {
+		usage := usages[coup.ID]
+		// the reason is dropped here, EvaluateCoupon reports it for a single coupon
+		discount, tier, reason := evaluate(items, totalPrice, coup, now, usage, cust, rounding)
+		if reason != nil {
+			continue
+		}
+
+		discountCoupon := DiscountCoupon{
+			CouponID: coup.ID,
+			Type:     coup.Type,
+			Discount: discount,
+			Currency: totalPrice.Currency,
+			Tier:     tier,
+		}
+		if remaining, limited := coup.RemainingUses(usage); limited {
+			discountCoupon.RemainingUses = &remaining
 		}
+		result = append(result, discountCoupon)
 	}
 	return result
 }
 
+// currencyOf returns the currency of the items, all the items of a cart are priced in the same currency
+func currencyOf(items []PricedItem) money.Currency {
+	if len(items) == 0 {
+		return money.DefaultCurrency
+	}
+	return items[0].Price.Currency
+}
+
+// totalOf returns the total price of the items
+func totalOf(items []PricedItem) money.Money {
+	total := money.Zero(currencyOf(items))
+	for _, item := range items {
+		total = total.Add(item.Amount())
+	}
+	return total
+}
+
+// amountsOf returns the price of the whole quantity of every item
+func amountsOf(items []PricedItem) []money.Money {
+	amounts := make([]money.Money, len(items))
+	for i, item := range items {
+		amounts[i] = item.Amount()
+	}
+	return amounts
+}
+
 // appliableCartWiseCoupons for handling the cart wise coupon
-func appliableCartWiseCoupons(totalPrice int, coup coupon.Coupon) (int, bool) {
+// the discount is of the highest tier reached by the total price
+// the reason is nil if the coupon is applicable
+func appliableCartWiseCoupons(totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *Reason) {
 	detail := coup.Details.(coupon.CartWiseDetails)
-	if detail.Threshold > totalPrice {
-		return 0, false
+	tier, ok := detail.TierFor(totalPrice)
+	if !ok {
+		threshold := money.New(int64(detail.EffectiveTiers()[0].Threshold), totalPrice.Currency)
+		return money.Zero(totalPrice.Currency), amountShort(ReasonThresholdNotMet, totalPrice, threshold,
+			fmt.Sprintf("cart total %d is below the threshold %d", totalPrice.Amount, threshold.Amount))
 	}
-	return (detail.Discount * totalPrice) / 100, true
+	return capDiscount(detail.DiscountKind.DiscountOn(tier.Discount, totalPrice, rounding), detail.MaxDiscount), nil
 }
 
 // appliableProductWiseCoupon for handling the product wise coupon
-func appliableProductWiseCoupon(items []PricedItem, coup coupon.Coupon) (int, bool) {
+// the reason is nil if the coupon is applicable
+func appliableProductWiseCoupon(items []PricedItem, coup coupon.Coupon, rounding money.Rounding) (money.Money, *Reason) {
 	detail := coup.Details.(coupon.ProductWiseDetails)
 	itemIdx := slices.IndexFunc(items, func(item PricedItem) bool {
 		return item.ProductID == detail.ProductID
 	})
 	if itemIdx == -1 {
-		return 0, false
+		return money.Zero(currencyOf(items)), &Reason{
+			Code:      ReasonProductNotInCart,
+			Message:   fmt.Sprintf("product %d is not in the cart", detail.ProductID),
+			ProductID: detail.ProductID,
+		}
 	}
 	item := items[itemIdx]
-	return (detail.Discount * item.Price * item.Quantity) / 100, true
+	return capDiscount(detail.DiscountKind.DiscountOn(detail.Discount, item.Amount(), rounding), detail.MaxDiscount), nil
+}
+
+// capDiscount limits the discount to the max discount of the coupon, zero max discount is no cap
+// the max discount is in the minor unit of the currency of the discount
+func capDiscount(discount money.Money, maxDiscount int) money.Money {
+	if maxDiscount > 0 {
+		return discount.Min(money.New(int64(maxDiscount), discount.Currency))
+	}
+	return discount
 }
 
 // appliableBxGYCoupon for handling the bxgy coupon
-func appliableBxGYCoupon(items []PricedItem, coup coupon.Coupon) (int, map[int]int, bool) {
+// the reason is nil if the coupon is applicable
+func appliableBxGYCoupon(items []PricedItem, coup coupon.Coupon) (money.Money, map[int]money.Money, *Reason) {
 	detail := coup.Details.(coupon.BxGyDetails)
+	noDiscount := money.Zero(currencyOf(items))
 
 	cartMap := map[int]PricedItem{} // map of productID -> PricedItem
 	for _, product := range items {
@@ -91,18 +142,26 @@ func appliableBxGYCoupon(items []PricedItem, coup coupon.Coupon) (int, map[int]i
 		// every product of the buy array should be in our cart for discount to be applicable
 		productInCart, ok := cartMap[product.ProductID]
 		if !ok {
-			return 0, nil, false
+			return noDiscount, nil, &Reason{
+				Code:      ReasonMissingBuyProduct,
+				Message:   fmt.Sprintf("buy product %d is not in the cart", product.ProductID),
+				ProductID: product.ProductID,
+			}
 		}
 		totalBuyInCart += productInCart.Quantity
 	}
 
 	actualRepetitions := min(totalBuyInCart/totalBuyRequired, detail.RepetitionLimit)
 	if actualRepetitions == 0 {
-		return 0, nil, false
+		return noDiscount, nil, &Reason{
+			Code:          ReasonBuyQuantityNotMet,
+			Message:       fmt.Sprintf("cart has %d of the %d buy products required", totalBuyInCart, totalBuyRequired),
+			QuantityShort: totalBuyRequired - totalBuyInCart,
+		}
 	}
 
-	totalDiscount := 0
-	productDiscounts := map[int]int{}
+	totalDiscount := noDiscount
+	productDiscounts := map[int]money.Money{}
 	for _, getProduct := range detail.GetProducts {
 		productInCart, ok := cartMap[getProduct.ProductID]
 		if !ok {
@@ -113,76 +172,196 @@ func appliableBxGYCoupon(items []PricedItem, coup coupon.Coupon) (int, map[int]i
 		maxTimesByCart := productInCart.Quantity / getProduct.Quantity
 		times := min(actualRepetitions, maxTimesByCart)
 
-		discount := getProduct.Quantity * productInCart.Price * times
+		discount := productInCart.Price.Mul(getProduct.Quantity * times)
 		productDiscounts[getProduct.ProductID] = discount
-		totalDiscount += discount
+		totalDiscount = totalDiscount.Add(discount)
+	}
+	if totalDiscount.IsZero() {
+		return noDiscount, nil, &Reason{Code: ReasonMissingGetProduct, Message: "none of the get products are in the cart in the required quantity"}
+	}
+
+	return totalDiscount, productDiscounts, nil
+}
+
+// appliableCategoryWiseCoupon for handling the category wise coupon
+// the discount is on the total of the items of the category, and is prorated across those items
+func appliableCategoryWiseCoupon(items []PricedItem, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *Reason) {
+	detail := coup.Details.(coupon.CategoryWiseDetails)
+	return discountMatching(amountsOf(items), func(i int) bool {
+		return matchesCategory(items[i], detail.Category)
+	}, detail.Discount, detail.MaxDiscount, rounding)
+}
+
+// matchesCategory compares the categories case-insensitive
+func matchesCategory(item PricedItem, category string) bool {
+	return item.Category != "" && strings.EqualFold(item.Category, strings.TrimSpace(category))
+}
+
+// appliableBrandWiseCoupon for handling the brand wise coupon
+func appliableBrandWiseCoupon(items []PricedItem, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *Reason) {
+	return brandWiseDiscount(items, amountsOf(items), coup.Details.(coupon.BrandWiseDetails), rounding)
+}
+
+// brandWiseDiscount gives the discount on the amounts of the items of the brand which are not excluded
+// the discount is prorated across those items
+// It will return the reason if the subtotal of those items is below the min subtotal of the coupon
+func brandWiseDiscount(items []PricedItem, amounts []money.Money, detail coupon.BrandWiseDetails, rounding money.Rounding) (money.Money, []money.Money, *Reason) {
+	brand := strings.TrimSpace(detail.Brand)
+	eligible := func(i int) bool {
+		return items[i].Brand != "" && strings.EqualFold(items[i].Brand, brand) &&
+			!slices.Contains(detail.ExcludedProductIDs, items[i].ProductID)
+	}
+	subtotal := money.Zero(currencyOf(items))
+	for i, amount := range amounts {
+		if eligible(i) {
+			subtotal = subtotal.Add(amount)
+		}
+	}
+	if minSubtotal := money.New(int64(detail.MinSubtotal), subtotal.Currency); subtotal.Cmp(minSubtotal) < 0 {
+		return money.Zero(subtotal.Currency), nil, amountShort(ReasonMinSubtotalNotMet, subtotal, minSubtotal,
+			fmt.Sprintf("subtotal %d of the %s items is below the min subtotal %d", subtotal.Amount, brand, minSubtotal.Amount))
+	}
+	return discountMatching(amounts, eligible, detail.Discount, detail.MaxDiscount, rounding)
+}
+
+// appliableVolumeTierCoupon for handling the volume tier coupon
+func appliableVolumeTierCoupon(items []PricedItem, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier, *Reason) {
+	return volumeTierDiscount(items, amountsOf(items), coup.Details.(coupon.VolumeTierDetails), rounding)
+}
+
+// volumeTierDiscount gives the discount of the tier reached by the total quantity of the product
+// or the category, the discount is on the amounts of those items and is prorated across them
+// It will return the reason if the quantity is below the first tier
+func volumeTierDiscount(items []PricedItem, amounts []money.Money, detail coupon.VolumeTierDetails, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier, *Reason) {
+	match := func(i int) bool {
+		if detail.ProductID != 0 {
+			return items[i].ProductID == detail.ProductID
+		}
+		return matchesCategory(items[i], detail.Category)
+	}
+	quantity := 0
+	for i, item := range items {
+		if match(i) {
+			quantity += item.Quantity
+		}
+	}
+	noDiscount := money.Zero(currencyOf(items))
+	tier, ok := detail.TierFor(quantity)
+	if !ok {
+		minQuantity := detail.Tiers[0].MinQuantity
+		return noDiscount, nil, nil, &Reason{
+			Code:          ReasonQuantityNotMet,
+			Message:       fmt.Sprintf("cart has %d of the %d units of the first tier", quantity, minQuantity),
+			ProductID:     detail.ProductID,
+			QuantityShort: minQuantity - quantity,
+		}
 	}
-	if totalDiscount == 0 {
-		return 0, nil, false
+	discount, shares, reason := discountMatching(amounts, match, tier.Discount, detail.MaxDiscount, rounding)
+	if reason != nil {
+		return noDiscount, nil, nil, reason
 	}
+	return discount, shares, &tier, nil
+}
 
-	return totalDiscount, productDiscounts, true
+// discountMatching gives the percentage discount on the total amount of the matching items
+// capped by maxDiscount, the discount is prorated across the matching items by their amount
+// It will return the reason if none of the items match
+func discountMatching(amounts []money.Money, match func(i int) bool, percent, maxDiscount int, rounding money.Rounding) (money.Money, []money.Money, *Reason) {
+	currency := currencyOfAmounts(amounts)
+	matched := make([]money.Money, len(amounts))
+	total := money.Zero(currency)
+	for i, amount := range amounts {
+		matched[i] = money.Zero(currency)
+		if match(i) {
+			matched[i] = amount
+			total = total.Add(amount)
+		}
+	}
+	if total.IsZero() {
+		return total, nil, &Reason{Code: ReasonNoMatchingItems, Message: "none of the items in the cart are eligible for the coupon"}
+	}
+	discount := capDiscount(total.Percent(percent, rounding), maxDiscount)
+	return discount, money.Allocate(discount, matched), nil
 }
 
 // ApplyCoupon will apply the given coupon to the cart and return the discounted cart
-// It will panic if the coupon is invalid
-func ApplyCoupon(items []PricedItem, coupon coupon.Coupon) DiscountedCart {
-	totalPrice := 0
-	for _, item := range items {
-		totalPrice += item.Price * item.Quantity
+// It will return an error if the coupon is outside its validity window at now,
+// the usage has exhausted the limits of the coupon, the coupon is only for the first order and the customer is anonymous,
+// has completed an order or has already redeemed it, the coupon is not valid in the currency of the cart
+// or the cart does not meet the conditions or the expression of the coupon
+// the percentage discounts are rounded to the minor unit with the rounding
+// It will also return an error if the coupon type is unknown or the details are not of the type
+func ApplyCoupon(items []PricedItem, coupon coupon.Coupon, now time.Time, usage coupon.Usage, cust *customer.Customer, rounding money.Rounding) (DiscountedCart, error) {
+	if !coupon.IsActiveAt(now) {
+		return DiscountedCart{}, fmt.Errorf("%w: coupon %d is not valid at %s", errCouponNotActive, coupon.ID, now.Format(time.RFC3339))
+	}
+	if err := coupon.CheckUsage(usage); err != nil {
+		return DiscountedCart{}, err
+	}
+	if err := checkFirstOrder(coupon, usage, cust); err != nil {
+		return DiscountedCart{}, err
+	}
+
+	totalPrice := totalOf(items)
+	if !coupon.AppliesIn(totalPrice.Currency) {
+		return DiscountedCart{}, fmt.Errorf("%w: coupon %d in %s", errCurrencyMismatch, coupon.ID, totalPrice.Currency)
+	}
+	if err := checkConditions(items, totalPrice, coupon, now, cust); err != nil {
+		return DiscountedCart{}, err
 	}
 
-	switch coupon.Type {
-	case "cart-wise":
-		return applyCartWiseCoupon(items, totalPrice, coupon)
-	case "product-wise":
-		return applyProductWiseCoupon(items, totalPrice, coupon)
-	case "bxgy":
-		return applyBxGyWiseCoupon(items, totalPrice, coupon)
-	default:
-		panic(fmt.Errorf("unsupported coupon type %s", coupon.Type))
+	calc, err := calculatorFor(coupon)
+	if err != nil {
+		return DiscountedCart{}, err
 	}
+	discounted := calc.Apply(items, totalPrice, coupon, rounding)
+	discounted.Currency = totalPrice.Currency
+	return discounted, nil
 }
 
 // applyCartWiseCoupon will apply the cart wise coupon
-// since the coupon is on whole cart the discount on individual item will be zero
-// and the total discount will be the calculated discount
-func applyCartWiseCoupon(items []PricedItem, totalPrice int, coupon coupon.Coupon) DiscountedCart {
+// the discount on the whole cart is prorated across the items by their price,
+// so the discount of the items sums to the total discount
+func applyCartWiseCoupon(items []PricedItem, totalPrice money.Money, coupon coupon.Coupon, rounding money.Rounding) DiscountedCart {
 	discountedItems := make([]DiscountedItem, len(items))
-	for i := range items {
-		discountedItems[i] = items[i].ToDiscountedItem(0)
-	}
-	discount, ok := appliableCartWiseCoupons(totalPrice, coupon)
-	if !ok {
+	discount, reason := appliableCartWiseCoupons(totalPrice, coupon, rounding)
+	if reason != nil {
+		for i := range items {
+			discountedItems[i] = items[i].ToDiscountedItem(money.Zero(totalPrice.Currency))
+		}
 		return DiscountedCart{
 			Items:         discountedItems,
 			TotalPrice:    totalPrice,
-			TotalDiscount: 0,
+			TotalDiscount: money.Zero(totalPrice.Currency),
 			FinalPrice:    totalPrice,
 		}
 	}
+
+	for i, share := range money.Allocate(discount, amountsOf(items)) {
+		discountedItems[i] = items[i].ToDiscountedItem(share)
+	}
 	return DiscountedCart{
 		Items:         discountedItems,
 		TotalPrice:    totalPrice,
 		TotalDiscount: discount,
-		FinalPrice:    totalPrice - discount,
+		FinalPrice:    totalPrice.Sub(discount),
 	}
 }
 
 // applyProductWiseCoupon will return the cart list with discount against the product
 // along with the total discount and remaining products having zero discount
-func applyProductWiseCoupon(items []PricedItem, totalPrice int, coup coupon.Coupon) DiscountedCart {
+func applyProductWiseCoupon(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) DiscountedCart {
 	discountedItems := make([]DiscountedItem, len(items))
 	detail := coup.Details.(coupon.ProductWiseDetails)
 
-	discount, ok := appliableProductWiseCoupon(items, coup)
-	if !ok {
-		discount = 0
+	discount, reason := appliableProductWiseCoupon(items, coup, rounding)
+	if reason != nil {
+		discount = money.Zero(totalPrice.Currency)
 	}
 
 	for i, item := range items {
 		if item.ProductID != detail.ProductID {
-			discountedItems[i] = items[i].ToDiscountedItem(0)
+			discountedItems[i] = items[i].ToDiscountedItem(money.Zero(totalPrice.Currency))
 			continue
 		}
 		discountedItems[i] = items[i].ToDiscountedItem(discount)
@@ -191,30 +370,79 @@ func applyProductWiseCoupon(items []PricedItem, totalPrice int, coup coupon.Coup
 		Items:         discountedItems,
 		TotalPrice:    totalPrice,
 		TotalDiscount: discount,
-		FinalPrice:    totalPrice - discount,
+		FinalPrice:    totalPrice.Sub(discount),
 	}
 }
 
 // applyBxGyWiseCoupon will return the cart list with discount against the products
 // in the get products from the bxgy along with the total discount
-func applyBxGyWiseCoupon(items []PricedItem, totalPrice int, coup coupon.Coupon) DiscountedCart {
+func applyBxGyWiseCoupon(items []PricedItem, totalPrice money.Money, coup coupon.Coupon) DiscountedCart {
 	discountedItems := make([]DiscountedItem, len(items))
 
-	discount, productDiscounts, ok := appliableBxGYCoupon(items, coup)
-	if !ok {
-		discount = 0
+	discount, productDiscounts, reason := appliableBxGYCoupon(items, coup)
+	if reason != nil {
+		discount = money.Zero(totalPrice.Currency)
 	}
 
 	// discount map has the associated discount against the get item
 	// and default of zero for other items
 	for i, item := range items {
-		discount := productDiscounts[item.ProductID]
+		discount, ok := productDiscounts[item.ProductID]
+		if !ok {
+			discount = money.Zero(totalPrice.Currency)
+		}
 		discountedItems[i] = item.ToDiscountedItem(discount)
 	}
 	return DiscountedCart{
 		Items:         discountedItems,
 		TotalPrice:    totalPrice,
 		TotalDiscount: discount,
-		FinalPrice:    totalPrice - discount,
+		FinalPrice:    totalPrice.Sub(discount),
+	}
+}
+
+// applyCategoryWiseCoupon will return the cart list with the discount against the items
+// of the category along with the total discount and the other items having zero discount
+func applyCategoryWiseCoupon(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) DiscountedCart {
+	discount, itemDiscounts, reason := appliableCategoryWiseCoupon(items, coup, rounding)
+	return sharedDiscountCart(items, totalPrice, discount, itemDiscounts, reason == nil)
+}
+
+// applyBrandWiseCoupon will return the cart list with the discount against the items
+// of the brand along with the total discount and the other items having zero discount
+func applyBrandWiseCoupon(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) DiscountedCart {
+	discount, itemDiscounts, reason := appliableBrandWiseCoupon(items, coup, rounding)
+	return sharedDiscountCart(items, totalPrice, discount, itemDiscounts, reason == nil)
+}
+
+// applyVolumeTierCoupon will return the cart list with the discount of the reached tier against
+// the items of the product or category along with the total discount and the applied tier
+func applyVolumeTierCoupon(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) DiscountedCart {
+	discount, itemDiscounts, tier, reason := appliableVolumeTierCoupon(items, coup, rounding)
+	discounted := sharedDiscountCart(items, totalPrice, discount, itemDiscounts, reason == nil)
+	discounted.Tier = tier
+	return discounted
+}
+
+// sharedDiscountCart returns the cart with the discount shared across the items by itemDiscounts
+// the items have zero discount if the coupon is not applicable
+func sharedDiscountCart(items []PricedItem, totalPrice, discount money.Money, itemDiscounts []money.Money, ok bool) DiscountedCart {
+	if !ok {
+		discount = money.Zero(totalPrice.Currency)
+		itemDiscounts = make([]money.Money, len(items))
+		for i := range itemDiscounts {
+			itemDiscounts[i] = discount
+		}
+	}
+
+	discountedItems := make([]DiscountedItem, len(items))
+	for i, item := range items {
+		discountedItems[i] = item.ToDiscountedItem(itemDiscounts[i])
+	}
+	return DiscountedCart{
+		Items:         discountedItems,
+		TotalPrice:    totalPrice,
+		TotalDiscount: discount,
+		FinalPrice:    totalPrice.Sub(discount),
 	}
 }
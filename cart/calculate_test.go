@@ -1,12 +1,25 @@
 package cart
 
 import (
+	"errors"
+	"math/rand/v2"
 	"reflect"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
 	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
 )
 
+// inr is the amount in paisa
+func inr(amount int64) money.Money {
+	return money.New(amount, money.INR)
+}
+
 func TestApplyBxGyWiseCoupon(t *testing.T) {
 	const (
 		productXID = 1
@@ -20,18 +33,18 @@ func TestApplyBxGyWiseCoupon(t *testing.T) {
 	tests := []struct {
 		name         string
 		items        []PricedItem
-		totalPrice   int
+		totalPrice   money.Money
 		coupon       coupon.BxGyDetails
 		expectedCart DiscountedCart
 	}{
 		{
 			name: "Valid B2G1 with one discount",
 			items: []PricedItem{
-				{ProductID: productXID, Quantity: 1, Price: 10},
-				{ProductID: productYID, Quantity: 1, Price: 12},
-				{ProductID: productAID, Quantity: 1, Price: 8},
+				{ProductID: productXID, Quantity: 1, Price: inr(10)},
+				{ProductID: productYID, Quantity: 1, Price: inr(12)},
+				{ProductID: productAID, Quantity: 1, Price: inr(8)},
 			},
-			totalPrice: 30,
+			totalPrice: inr(30),
 			coupon: coupon.BxGyDetails{
 				BuyProducts: []coupon.CouponProduct{
 					{ProductID: productXID, Quantity: 1},
@@ -42,23 +55,23 @@ func TestApplyBxGyWiseCoupon(t *testing.T) {
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productXID, Quantity: 1, Price: 10, Discount: 0},
-					{ProductID: productYID, Quantity: 1, Price: 12, Discount: 0},
-					{ProductID: productAID, Quantity: 1, Price: 8, Discount: 8},
+					{ProductID: productXID, Quantity: 1, Price: inr(10), Discount: inr(0)},
+					{ProductID: productYID, Quantity: 1, Price: inr(12), Discount: inr(0)},
+					{ProductID: productAID, Quantity: 1, Price: inr(8), Discount: inr(8)},
 				},
-				TotalPrice:    30,
-				TotalDiscount: 8,
-				FinalPrice:    22,
+				TotalPrice:    inr(30),
+				TotalDiscount: inr(8),
+				FinalPrice:    inr(22),
 			},
 		},
 		{
 			name: "B2G1 not applicable due to insufficient 'buy' items",
 			items: []PricedItem{
-				{ProductID: productXID, Quantity: 1, Price: 10},
-				{ProductID: productAID, Quantity: 1, Price: 8},
-				{ProductID: productBID, Quantity: 1, Price: 9},
+				{ProductID: productXID, Quantity: 1, Price: inr(10)},
+				{ProductID: productAID, Quantity: 1, Price: inr(8)},
+				{ProductID: productBID, Quantity: 1, Price: inr(9)},
 			},
-			totalPrice: 27,
+			totalPrice: inr(27),
 			coupon: coupon.BxGyDetails{
 				BuyProducts: []coupon.CouponProduct{
 					{ProductID: productXID, Quantity: 1},
@@ -69,24 +82,24 @@ func TestApplyBxGyWiseCoupon(t *testing.T) {
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productXID, Quantity: 1, Price: 10, Discount: 0},
-					{ProductID: productAID, Quantity: 1, Price: 8, Discount: 0},
-					{ProductID: productBID, Quantity: 1, Price: 9, Discount: 0},
+					{ProductID: productXID, Quantity: 1, Price: inr(10), Discount: inr(0)},
+					{ProductID: productAID, Quantity: 1, Price: inr(8), Discount: inr(0)},
+					{ProductID: productBID, Quantity: 1, Price: inr(9), Discount: inr(0)},
 				},
-				TotalPrice:    27,
-				TotalDiscount: 0,
-				FinalPrice:    27,
+				TotalPrice:    inr(27),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(27),
 			},
 		},
 		{
 			name: "B2G1 applied multiple times up to repetition limit",
 			items: []PricedItem{
-				{ProductID: productXID, Quantity: 6, Price: 10},
-				{ProductID: productAID, Quantity: 1, Price: 8},
-				{ProductID: productBID, Quantity: 1, Price: 9},
-				{ProductID: productCID, Quantity: 1, Price: 11},
+				{ProductID: productXID, Quantity: 6, Price: inr(10)},
+				{ProductID: productAID, Quantity: 1, Price: inr(8)},
+				{ProductID: productBID, Quantity: 1, Price: inr(9)},
+				{ProductID: productCID, Quantity: 1, Price: inr(11)},
 			},
-			totalPrice: 88,
+			totalPrice: inr(88),
 			coupon: coupon.BxGyDetails{
 				BuyProducts: []coupon.CouponProduct{{ProductID: productXID, Quantity: 2}},
 				GetProducts: []coupon.CouponProduct{
@@ -98,23 +111,23 @@ func TestApplyBxGyWiseCoupon(t *testing.T) {
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productXID, Quantity: 6, Price: 10, Discount: 0},
-					{ProductID: productAID, Quantity: 1, Price: 8, Discount: 8},
-					{ProductID: productBID, Quantity: 1, Price: 9, Discount: 9},
-					{ProductID: productCID, Quantity: 1, Price: 11, Discount: 11},
+					{ProductID: productXID, Quantity: 6, Price: inr(10), Discount: inr(0)},
+					{ProductID: productAID, Quantity: 1, Price: inr(8), Discount: inr(8)},
+					{ProductID: productBID, Quantity: 1, Price: inr(9), Discount: inr(9)},
+					{ProductID: productCID, Quantity: 1, Price: inr(11), Discount: inr(11)},
 				},
-				TotalPrice:    88,
-				TotalDiscount: 28,
-				FinalPrice:    60,
+				TotalPrice:    inr(88),
+				TotalDiscount: inr(28),
+				FinalPrice:    inr(60),
 			},
 		},
 		{
 			name: "Not enough 'get' items to apply coupon multiple times",
 			items: []PricedItem{
-				{ProductID: productXID, Quantity: 6, Price: 10},
-				{ProductID: productAID, Quantity: 1, Price: 8},
+				{ProductID: productXID, Quantity: 6, Price: inr(10)},
+				{ProductID: productAID, Quantity: 1, Price: inr(8)},
 			},
-			totalPrice: 68,
+			totalPrice: inr(68),
 			coupon: coupon.BxGyDetails{
 				BuyProducts:     []coupon.CouponProduct{{ProductID: productXID, Quantity: 2}},
 				GetProducts:     []coupon.CouponProduct{{ProductID: productAID, Quantity: 1}},
@@ -122,12 +135,12 @@ func TestApplyBxGyWiseCoupon(t *testing.T) {
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productXID, Quantity: 6, Price: 10, Discount: 0},
-					{ProductID: productAID, Quantity: 1, Price: 8, Discount: 8},
+					{ProductID: productXID, Quantity: 6, Price: inr(10), Discount: inr(0)},
+					{ProductID: productAID, Quantity: 1, Price: inr(8), Discount: inr(8)},
 				},
-				TotalPrice:    68,
-				TotalDiscount: 8,
-				FinalPrice:    60,
+				TotalPrice:    inr(68),
+				TotalDiscount: inr(8),
+				FinalPrice:    inr(60),
 			},
 		},
 	}
@@ -157,48 +170,126 @@ func TestApplyProductWiseCoupon(t *testing.T) {
 	tests := []struct {
 		name         string
 		items        []PricedItem
-		totalPrice   int
+		totalPrice   money.Money
 		coupon       coupon.ProductWiseDetails
 		expectedCart DiscountedCart
 	}{
 		{
 			name: "20% off on a product",
 			items: []PricedItem{
-				{ProductID: productAID, Quantity: 1, Price: 100},
-				{ProductID: productBID, Quantity: 1, Price: 50},
+				{ProductID: productAID, Quantity: 1, Price: inr(100)},
+				{ProductID: productBID, Quantity: 1, Price: inr(50)},
 			},
-			totalPrice: 150,
+			totalPrice: inr(150),
 			coupon: coupon.ProductWiseDetails{
 				ProductID: productAID, Discount: 20,
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productAID, Quantity: 1, Price: 100, Discount: 20},
-					{ProductID: productBID, Quantity: 1, Price: 50, Discount: 0},
+					{ProductID: productAID, Quantity: 1, Price: inr(100), Discount: inr(20)},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
+				},
+				TotalPrice:    inr(150),
+				TotalDiscount: inr(20),
+				FinalPrice:    inr(130),
+			},
+		},
+		{
+			name: "Discount above the cap is capped",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 3, Price: inr(100)},
+				{ProductID: productBID, Quantity: 1, Price: inr(50)},
+			},
+			totalPrice: inr(350),
+			coupon: coupon.ProductWiseDetails{
+				ProductID: productAID, Discount: 20, MaxDiscount: 45,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 3, Price: inr(100), Discount: inr(45)},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
+				},
+				TotalPrice:    inr(350),
+				TotalDiscount: inr(45),
+				FinalPrice:    inr(305),
+			},
+		},
+		{
+			name: "Discount below the cap is not changed",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(100)},
+			},
+			totalPrice: inr(100),
+			coupon: coupon.ProductWiseDetails{
+				ProductID: productAID, Discount: 20, MaxDiscount: 45,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(100), Discount: inr(20)},
+				},
+				TotalPrice:    inr(100),
+				TotalDiscount: inr(20),
+				FinalPrice:    inr(80),
+			},
+		},
+		{
+			name: "Fixed discount on the product",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 2, Price: inr(100)},
+				{ProductID: productBID, Quantity: 1, Price: inr(50)},
+			},
+			totalPrice: inr(250),
+			coupon: coupon.ProductWiseDetails{
+				ProductID: productAID, Discount: 50, DiscountKind: coupon.DiscountFixed,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 2, Price: inr(100), Discount: inr(50)},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
 				},
-				TotalPrice:    150,
-				TotalDiscount: 20,
-				FinalPrice:    130,
+				TotalPrice:    inr(250),
+				TotalDiscount: inr(50),
+				FinalPrice:    inr(200),
+			},
+		},
+		{
+			name: "Fixed discount is clamped to the price of the product",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(30)},
+				{ProductID: productBID, Quantity: 1, Price: inr(50)},
+			},
+			totalPrice: inr(80),
+			coupon: coupon.ProductWiseDetails{
+				ProductID: productAID, Discount: 50, DiscountKind: coupon.DiscountFixed,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(30), Discount: inr(30)},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
+				},
+				TotalPrice:    inr(80),
+				TotalDiscount: inr(30),
+				FinalPrice:    inr(50),
 			},
 		},
 		{
 			name: "No matching product in cart",
 			items: []PricedItem{
-				{ProductID: productBID, Quantity: 1, Price: 50},
-				{ProductID: productCID, Quantity: 1, Price: 75},
+				{ProductID: productBID, Quantity: 1, Price: inr(50)},
+				{ProductID: productCID, Quantity: 1, Price: inr(75)},
 			},
-			totalPrice: 125,
+			totalPrice: inr(125),
 			coupon: coupon.ProductWiseDetails{
 				ProductID: productAID, Discount: 20,
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productBID, Quantity: 1, Price: 50, Discount: 0},
-					{ProductID: productCID, Quantity: 1, Price: 75, Discount: 0},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
+					{ProductID: productCID, Quantity: 1, Price: inr(75), Discount: inr(0)},
 				},
-				TotalPrice:    125,
-				TotalDiscount: 0,
-				FinalPrice:    125,
+				TotalPrice:    inr(125),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(125),
 			},
 		},
 	}
@@ -210,7 +301,7 @@ func TestApplyProductWiseCoupon(t *testing.T) {
 				Type:    "product-wise",
 				Details: tc.coupon,
 			}
-			gotCart := applyProductWiseCoupon(tc.items, tc.totalPrice, coup)
+			gotCart := applyProductWiseCoupon(tc.items, tc.totalPrice, coup, money.Floor)
 			if !reflect.DeepEqual(gotCart, tc.expectedCart) {
 				t.Errorf("applyProductWiseCoupon() = %+v, want %+v", gotCart, tc.expectedCart)
 			}
@@ -218,6 +309,316 @@ func TestApplyProductWiseCoupon(t *testing.T) {
 	}
 }
 
+func TestApplyCategoryWiseCoupon(t *testing.T) {
+	const (
+		productAID = 1
+		productBID = 2
+		productCID = 3
+	)
+
+	tests := []struct {
+		name         string
+		items        []PricedItem
+		totalPrice   money.Money
+		coupon       coupon.CategoryWiseDetails
+		expectedCart DiscountedCart
+	}{
+		{
+			name: "10% off on all the clothing",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 2, Price: inr(100), Category: "clothing"},
+				{ProductID: productBID, Quantity: 1, Price: inr(50), Category: "electronics"},
+				{ProductID: productCID, Quantity: 1, Price: inr(55), Category: "Clothing"},
+			},
+			totalPrice: inr(305),
+			coupon: coupon.CategoryWiseDetails{
+				Category: "clothing", Discount: 10,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 2, Price: inr(100), Discount: inr(20)},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
+					{ProductID: productCID, Quantity: 1, Price: inr(55), Discount: inr(5)},
+				},
+				TotalPrice:    inr(305),
+				TotalDiscount: inr(25),
+				FinalPrice:    inr(280),
+			},
+		},
+		{
+			name: "Capped discount is prorated across the category",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 2, Price: inr(100), Category: "clothing"},
+				{ProductID: productCID, Quantity: 1, Price: inr(100), Category: "clothing"},
+			},
+			totalPrice: inr(300),
+			coupon: coupon.CategoryWiseDetails{
+				Category: "clothing", Discount: 50, MaxDiscount: 100,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 2, Price: inr(100), Discount: inr(67)},
+					{ProductID: productCID, Quantity: 1, Price: inr(100), Discount: inr(33)},
+				},
+				TotalPrice:    inr(300),
+				TotalDiscount: inr(100),
+				FinalPrice:    inr(200),
+			},
+		},
+		{
+			name: "No item of the category in cart",
+			items: []PricedItem{
+				{ProductID: productBID, Quantity: 1, Price: inr(50), Category: "electronics"},
+				{ProductID: productCID, Quantity: 1, Price: inr(75)},
+			},
+			totalPrice: inr(125),
+			coupon: coupon.CategoryWiseDetails{
+				Category: "clothing", Discount: 10,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(0)},
+					{ProductID: productCID, Quantity: 1, Price: inr(75), Discount: inr(0)},
+				},
+				TotalPrice:    inr(125),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(125),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			coup := coupon.Coupon{
+				ID:      1,
+				Type:    "category-wise",
+				Details: tc.coupon,
+			}
+			gotCart := applyCategoryWiseCoupon(tc.items, tc.totalPrice, coup, money.Floor)
+			if !reflect.DeepEqual(gotCart, tc.expectedCart) {
+				t.Errorf("applyCategoryWiseCoupon() = %+v, want %+v", gotCart, tc.expectedCart)
+			}
+		})
+	}
+}
+
+func TestGetAppliableCouponsCategoryWise(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100), Category: "clothing"},
+		{ProductID: 2, Quantity: 1, Price: inr(50), Category: "electronics"},
+	}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "category-wise", Details: coupon.CategoryWiseDetails{Category: "Clothing", Discount: 10}},
+		{ID: 2, Type: "category-wise", Details: coupon.CategoryWiseDetails{Category: "groceries", Discount: 50}},
+	}
+
+	got := GetAppliableCoupons(items, coupons, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{{CouponID: 1, Type: "category-wise", Discount: inr(20), Currency: money.INR}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestApplyBrandWiseCoupon(t *testing.T) {
+	const (
+		laptopID    = 1
+		clearanceID = 2
+		mouseID     = 3
+		phoneID     = 4
+	)
+	items := []PricedItem{
+		{ProductID: laptopID, Quantity: 1, Price: inr(700), Brand: "Dell"},
+		{ProductID: clearanceID, Quantity: 1, Price: inr(300), Brand: "Dell"},
+		{ProductID: mouseID, Quantity: 2, Price: inr(50), Brand: "dell"},
+		{ProductID: phoneID, Quantity: 1, Price: inr(500), Brand: "Apple"},
+	}
+
+	tests := []struct {
+		name         string
+		coupon       coupon.BrandWiseDetails
+		expectedCart DiscountedCart
+	}{
+		{
+			name:   "10% off on the brand except the excluded products",
+			coupon: coupon.BrandWiseDetails{Brand: "DELL", Discount: 10, ExcludedProductIDs: []int{clearanceID}},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: laptopID, Quantity: 1, Price: inr(700), Discount: inr(70)},
+					{ProductID: clearanceID, Quantity: 1, Price: inr(300), Discount: inr(0)},
+					{ProductID: mouseID, Quantity: 2, Price: inr(50), Discount: inr(10)},
+					{ProductID: phoneID, Quantity: 1, Price: inr(500), Discount: inr(0)},
+				},
+				TotalPrice:    inr(1600),
+				TotalDiscount: inr(80),
+				FinalPrice:    inr(1520),
+			},
+		},
+		{
+			name:   "Min subtotal is reached by the brand items",
+			coupon: coupon.BrandWiseDetails{Brand: "Dell", Discount: 10, MinSubtotal: 1100, MaxDiscount: 55},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: laptopID, Quantity: 1, Price: inr(700), Discount: inr(35)},
+					{ProductID: clearanceID, Quantity: 1, Price: inr(300), Discount: inr(15)},
+					{ProductID: mouseID, Quantity: 2, Price: inr(50), Discount: inr(5)},
+					{ProductID: phoneID, Quantity: 1, Price: inr(500), Discount: inr(0)},
+				},
+				TotalPrice:    inr(1600),
+				TotalDiscount: inr(55),
+				FinalPrice:    inr(1545),
+			},
+		},
+		{
+			name:   "Excluded products do not count towards the min subtotal",
+			coupon: coupon.BrandWiseDetails{Brand: "Dell", Discount: 10, MinSubtotal: 1000, ExcludedProductIDs: []int{clearanceID}},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: laptopID, Quantity: 1, Price: inr(700), Discount: inr(0)},
+					{ProductID: clearanceID, Quantity: 1, Price: inr(300), Discount: inr(0)},
+					{ProductID: mouseID, Quantity: 2, Price: inr(50), Discount: inr(0)},
+					{ProductID: phoneID, Quantity: 1, Price: inr(500), Discount: inr(0)},
+				},
+				TotalPrice:    inr(1600),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(1600),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			coup := coupon.Coupon{
+				ID:      1,
+				Type:    "brand-wise",
+				Details: tc.coupon,
+			}
+			gotCart := applyBrandWiseCoupon(items, inr(1600), coup, money.Floor)
+			if !reflect.DeepEqual(gotCart, tc.expectedCart) {
+				t.Errorf("applyBrandWiseCoupon() = %+v, want %+v", gotCart, tc.expectedCart)
+			}
+		})
+	}
+}
+
+func TestGetAppliableCouponsBrandWise(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100), Brand: "Dell"},
+		{ProductID: 2, Quantity: 1, Price: inr(50), Brand: "Dell"},
+		{ProductID: 3, Quantity: 1, Price: inr(80)},
+	}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "brand-wise", Details: coupon.BrandWiseDetails{Brand: "dell", Discount: 10, ExcludedProductIDs: []int{2}}},
+		{ID: 2, Type: "brand-wise", Details: coupon.BrandWiseDetails{Brand: "dell", Discount: 10, MinSubtotal: 300}},
+		{ID: 3, Type: "brand-wise", Details: coupon.BrandWiseDetails{Brand: "hp", Discount: 50}},
+	}
+
+	got := GetAppliableCoupons(items, coupons, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{{CouponID: 1, Type: "brand-wise", Discount: inr(20), Currency: money.INR}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestApplyVolumeTierCoupon(t *testing.T) {
+	tiers := []coupon.VolumeTier{{MinQuantity: 10, Discount: 10}, {MinQuantity: 20, Discount: 15}}
+
+	tests := []struct {
+		name         string
+		items        []PricedItem
+		coupon       coupon.VolumeTierDetails
+		expectedCart DiscountedCart
+	}{
+		{
+			name: "Below the first tier",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 9, Price: inr(100)},
+			},
+			coupon: coupon.VolumeTierDetails{ProductID: 1, Tiers: tiers},
+			expectedCart: DiscountedCart{
+				Items:         []DiscountedItem{{ProductID: 1, Quantity: 9, Price: inr(100), Discount: inr(0)}},
+				TotalPrice:    inr(900),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(900),
+			},
+		},
+		{
+			name: "First tier of the product",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 12, Price: inr(100)},
+				{ProductID: 2, Quantity: 30, Price: inr(10)},
+			},
+			coupon: coupon.VolumeTierDetails{ProductID: 1, Tiers: tiers},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 12, Price: inr(100), Discount: inr(120)},
+					{ProductID: 2, Quantity: 30, Price: inr(10), Discount: inr(0)},
+				},
+				TotalPrice:    inr(1500),
+				TotalDiscount: inr(120),
+				FinalPrice:    inr(1380),
+				Tier:          &coupon.VolumeTier{MinQuantity: 10, Discount: 10},
+			},
+		},
+		{
+			name: "Highest tier reached by the quantity of the category",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 15, Price: inr(100), Category: "clothing"},
+				{ProductID: 2, Quantity: 5, Price: inr(20), Category: "Clothing"},
+				{ProductID: 3, Quantity: 30, Price: inr(10), Category: "electronics"},
+			},
+			coupon: coupon.VolumeTierDetails{Category: "clothing", Tiers: tiers},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 15, Price: inr(100), Discount: inr(225)},
+					{ProductID: 2, Quantity: 5, Price: inr(20), Discount: inr(15)},
+					{ProductID: 3, Quantity: 30, Price: inr(10), Discount: inr(0)},
+				},
+				TotalPrice:    inr(1900),
+				TotalDiscount: inr(240),
+				FinalPrice:    inr(1660),
+				Tier:          &coupon.VolumeTier{MinQuantity: 20, Discount: 15},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			coup := coupon.Coupon{
+				ID:      1,
+				Type:    "volume-tier",
+				Details: tc.coupon,
+			}
+			gotCart := applyVolumeTierCoupon(tc.items, totalOf(tc.items), coup, money.Floor)
+			if !reflect.DeepEqual(gotCart, tc.expectedCart) {
+				t.Errorf("applyVolumeTierCoupon() = %+v, want %+v", gotCart, tc.expectedCart)
+			}
+		})
+	}
+}
+
+func TestGetAppliableCouponsVolumeTier(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 20, Price: inr(10)},
+		{ProductID: 2, Quantity: 5, Price: inr(50)},
+	}
+	tiers := []coupon.VolumeTier{{MinQuantity: 10, Discount: 10}, {MinQuantity: 20, Discount: 15}}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "volume-tier", Details: coupon.VolumeTierDetails{ProductID: 1, Tiers: tiers}},
+		{ID: 2, Type: "volume-tier", Details: coupon.VolumeTierDetails{ProductID: 2, Tiers: tiers}},
+	}
+
+	got := GetAppliableCoupons(items, coupons, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{
+		{CouponID: 1, Type: "volume-tier", Discount: inr(30), Currency: money.INR, Tier: &coupon.VolumeTier{MinQuantity: 20, Discount: 15}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, expected)
+	}
+}
+
 func TestApplyCartWiseCoupon(t *testing.T) {
 	const (
 		productAID = 1
@@ -228,66 +629,246 @@ func TestApplyCartWiseCoupon(t *testing.T) {
 	tests := []struct {
 		name         string
 		items        []PricedItem
-		totalPrice   int
+		totalPrice   money.Money
 		coupon       coupon.CartWiseDetails
 		expectedCart DiscountedCart
 	}{
 		{
 			name: "Total above threshold, apply 10% discount",
 			items: []PricedItem{
-				{ProductID: productAID, Quantity: 1, Price: 200},
-				{ProductID: productBID, Quantity: 1, Price: 100},
+				{ProductID: productAID, Quantity: 1, Price: inr(200)},
+				{ProductID: productBID, Quantity: 1, Price: inr(100)},
 			},
-			totalPrice: 300,
+			totalPrice: inr(300),
 			coupon: coupon.CartWiseDetails{
 				Threshold: 250, Discount: 10,
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productAID, Quantity: 1, Price: 200, Discount: 0},
-					{ProductID: productBID, Quantity: 1, Price: 100, Discount: 0},
+					{ProductID: productAID, Quantity: 1, Price: inr(200), Discount: inr(20)},
+					{ProductID: productBID, Quantity: 1, Price: inr(100), Discount: inr(10)},
 				},
-				TotalPrice:    300,
-				TotalDiscount: 30,
-				FinalPrice:    270,
+				TotalPrice:    inr(300),
+				TotalDiscount: inr(30),
+				FinalPrice:    inr(270),
 			},
 		},
 		{
 			name: "Total below threshold, no discount applied",
 			items: []PricedItem{
-				{ProductID: productAID, Quantity: 1, Price: 80},
-				{ProductID: productCID, Quantity: 1, Price: 100},
+				{ProductID: productAID, Quantity: 1, Price: inr(80)},
+				{ProductID: productCID, Quantity: 1, Price: inr(100)},
 			},
-			totalPrice: 180,
+			totalPrice: inr(180),
 			coupon: coupon.CartWiseDetails{
 				Threshold: 200, Discount: 10,
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productAID, Quantity: 1, Price: 80, Discount: 0},
-					{ProductID: productCID, Quantity: 1, Price: 100, Discount: 0},
+					{ProductID: productAID, Quantity: 1, Price: inr(80), Discount: inr(0)},
+					{ProductID: productCID, Quantity: 1, Price: inr(100), Discount: inr(0)},
 				},
-				TotalPrice:    180,
-				TotalDiscount: 0,
-				FinalPrice:    180,
+				TotalPrice:    inr(180),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(180),
 			},
 		},
 		{
 			name: "Total equals threshold, discount applies",
 			items: []PricedItem{
-				{ProductID: productBID, Quantity: 2, Price: 100},
+				{ProductID: productBID, Quantity: 2, Price: inr(100)},
 			},
-			totalPrice: 200,
+			totalPrice: inr(200),
 			coupon: coupon.CartWiseDetails{
 				Threshold: 200, Discount: 25,
 			},
 			expectedCart: DiscountedCart{
 				Items: []DiscountedItem{
-					{ProductID: productBID, Quantity: 2, Price: 100, Discount: 0},
+					{ProductID: productBID, Quantity: 2, Price: inr(100), Discount: inr(50)},
+				},
+				TotalPrice:    inr(200),
+				TotalDiscount: inr(50),
+				FinalPrice:    inr(150),
+			},
+		},
+		{
+			name: "Discount above the cap is capped and prorated",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(200)},
+				{ProductID: productBID, Quantity: 1, Price: inr(100)},
+			},
+			totalPrice: inr(300),
+			coupon: coupon.CartWiseDetails{
+				Threshold: 250, Discount: 10, MaxDiscount: 25,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(200), Discount: inr(17)},
+					{ProductID: productBID, Quantity: 1, Price: inr(100), Discount: inr(8)},
+				},
+				TotalPrice:    inr(300),
+				TotalDiscount: inr(25),
+				FinalPrice:    inr(275),
+			},
+		},
+		{
+			name: "Discount equal to the cap is not changed",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(200)},
+				{ProductID: productBID, Quantity: 1, Price: inr(100)},
+			},
+			totalPrice: inr(300),
+			coupon: coupon.CartWiseDetails{
+				Threshold: 250, Discount: 10, MaxDiscount: 30,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(200), Discount: inr(20)},
+					{ProductID: productBID, Quantity: 1, Price: inr(100), Discount: inr(10)},
+				},
+				TotalPrice:    inr(300),
+				TotalDiscount: inr(30),
+				FinalPrice:    inr(270),
+			},
+		},
+		{
+			name: "Left over unit goes to the largest remainder",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(33)},
+				{ProductID: productBID, Quantity: 1, Price: inr(33)},
+				{ProductID: productCID, Quantity: 2, Price: inr(17)},
+			},
+			totalPrice: inr(100),
+			coupon: coupon.CartWiseDetails{
+				Threshold: 0, Discount: 10,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(33), Discount: inr(3)},
+					{ProductID: productBID, Quantity: 1, Price: inr(33), Discount: inr(3)},
+					{ProductID: productCID, Quantity: 2, Price: inr(17), Discount: inr(4)},
+				},
+				TotalPrice:    inr(100),
+				TotalDiscount: inr(10),
+				FinalPrice:    inr(90),
+			},
+		},
+		{
+			name: "Equal remainders go to the earlier items",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(50)},
+				{ProductID: productBID, Quantity: 1, Price: inr(50)},
+				{ProductID: productCID, Quantity: 1, Price: inr(50)},
+			},
+			totalPrice: inr(150),
+			coupon: coupon.CartWiseDetails{
+				Threshold: 100, Discount: 25,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(50), Discount: inr(13)},
+					{ProductID: productBID, Quantity: 1, Price: inr(50), Discount: inr(12)},
+					{ProductID: productCID, Quantity: 1, Price: inr(50), Discount: inr(12)},
+				},
+				TotalPrice:    inr(150),
+				TotalDiscount: inr(37),
+				FinalPrice:    inr(113),
+			},
+		},
+		{
+			name: "Highest reached tier is applied",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(1000)},
+				{ProductID: productBID, Quantity: 1, Price: inr(500)},
+			},
+			totalPrice: inr(1500),
+			coupon: coupon.CartWiseDetails{
+				Tiers: []coupon.CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}, {Threshold: 2000, Discount: 15}},
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(1000), Discount: inr(100)},
+					{ProductID: productBID, Quantity: 1, Price: inr(500), Discount: inr(50)},
+				},
+				TotalPrice:    inr(1500),
+				TotalDiscount: inr(150),
+				FinalPrice:    inr(1350),
+			},
+		},
+		{
+			name: "Top tier is capped",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 2, Price: inr(1000)},
+			},
+			totalPrice: inr(2000),
+			coupon: coupon.CartWiseDetails{
+				Tiers:       []coupon.CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}, {Threshold: 2000, Discount: 15}},
+				MaxDiscount: 250,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 2, Price: inr(1000), Discount: inr(250)},
+				},
+				TotalPrice:    inr(2000),
+				TotalDiscount: inr(250),
+				FinalPrice:    inr(1750),
+			},
+		},
+		{
+			name: "Fixed discount over the threshold is prorated",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(1200)},
+				{ProductID: productBID, Quantity: 2, Price: inr(300)},
+			},
+			totalPrice: inr(1800),
+			coupon: coupon.CartWiseDetails{
+				Threshold: 1500, Discount: 200, DiscountKind: coupon.DiscountFixed,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(1200), Discount: inr(133)},
+					{ProductID: productBID, Quantity: 2, Price: inr(300), Discount: inr(67)},
+				},
+				TotalPrice:    inr(1800),
+				TotalDiscount: inr(200),
+				FinalPrice:    inr(1600),
+			},
+		},
+		{
+			name: "Fixed discount tiers",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(1000)},
+			},
+			totalPrice: inr(1000),
+			coupon: coupon.CartWiseDetails{
+				Tiers:        []coupon.CartWiseTier{{Threshold: 500, Discount: 50}, {Threshold: 1000, Discount: 150}},
+				DiscountKind: coupon.DiscountFixed,
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(1000), Discount: inr(150)},
+				},
+				TotalPrice:    inr(1000),
+				TotalDiscount: inr(150),
+				FinalPrice:    inr(850),
+			},
+		},
+		{
+			name: "Total below the first tier",
+			items: []PricedItem{
+				{ProductID: productAID, Quantity: 1, Price: inr(499)},
+			},
+			totalPrice: inr(499),
+			coupon: coupon.CartWiseDetails{
+				Tiers: []coupon.CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}},
+			},
+			expectedCart: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: productAID, Quantity: 1, Price: inr(499), Discount: inr(0)},
 				},
-				TotalPrice:    200,
-				TotalDiscount: 50,
-				FinalPrice:    150,
+				TotalPrice:    inr(499),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(499),
 			},
 		},
 	}
@@ -299,10 +880,629 @@ func TestApplyCartWiseCoupon(t *testing.T) {
 				Type:    "cart-wise",
 				Details: tc.coupon,
 			}
-			gotCart := applyCartWiseCoupon(tc.items, tc.totalPrice, coup)
+			gotCart := applyCartWiseCoupon(tc.items, tc.totalPrice, coup, money.Floor)
 			if !reflect.DeepEqual(gotCart, tc.expectedCart) {
 				t.Errorf("applyCartWiseCoupon() = %v, want %v", gotCart, tc.expectedCart)
 			}
 		})
 	}
 }
+
+func TestGetAppliableCouponsValidityWindow(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, ist)
+	past := now.Add(-24 * time.Hour)
+	future := now.Add(24 * time.Hour)
+
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100)},
+	}
+	details := coupon.CartWiseDetails{Threshold: 100, Discount: 10}
+
+	tests := []struct {
+		name     string
+		startsAt *time.Time
+		endsAt   *time.Time
+		expected []DiscountCoupon
+	}{
+		{
+			name:     "No window is always active",
+			expected: []DiscountCoupon{{CouponID: 7, Type: "cart-wise", Discount: inr(20), Currency: money.INR}},
+		},
+		{
+			name:     "Inside the window",
+			startsAt: &past,
+			endsAt:   &future,
+			expected: []DiscountCoupon{{CouponID: 7, Type: "cart-wise", Discount: inr(20), Currency: money.INR}},
+		},
+		{
+			name:     "Starts exactly now",
+			startsAt: &now,
+			expected: []DiscountCoupon{{CouponID: 7, Type: "cart-wise", Discount: inr(20), Currency: money.INR}},
+		},
+		{
+			name:     "Not started yet",
+			startsAt: &future,
+			expected: []DiscountCoupon{},
+		},
+		{
+			name:     "Already expired",
+			endsAt:   &past,
+			expected: []DiscountCoupon{},
+		},
+		{
+			name:     "Ends exactly now",
+			endsAt:   &now,
+			expected: []DiscountCoupon{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			coup := coupon.Coupon{
+				ID:       7,
+				Type:     "cart-wise",
+				Details:  details,
+				StartsAt: tc.startsAt,
+				EndsAt:   tc.endsAt,
+			}
+			got := GetAppliableCoupons(items, []coupon.Coupon{coup}, now, nil, nil, money.Floor)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetAppliableCouponsRequiresCode(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100)},
+	}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 100, Discount: 10}},
+		{ID: 2, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 100, Discount: 50}, RequiresCode: true},
+	}
+
+	got := GetAppliableCoupons(items, coupons, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{{CouponID: 1, Type: "cart-wise", Discount: inr(20), Currency: money.INR}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestApplyCouponValidityWindow(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	// the same instant in a different timezone should not change the outcome
+	endsAt := now.In(time.FixedZone("IST", 5*60*60+30*60))
+
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 1, Price: inr(100)},
+	}
+	coup := coupon.Coupon{
+		ID:      1,
+		Type:    "product-wise",
+		Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 50},
+		EndsAt:  &endsAt,
+	}
+
+	gotCart, err := ApplyCoupon(items, coup, now.Add(-time.Second), coupon.Usage{}, nil, money.Floor)
+	if err != nil {
+		t.Fatalf("ApplyCoupon() before expiry unexpected error: %v", err)
+	}
+	if gotCart.TotalDiscount != inr(50) {
+		t.Errorf("ApplyCoupon() before expiry discount = %v, want %v", gotCart.TotalDiscount, inr(50))
+	}
+
+	_, err = ApplyCoupon(items, coup, now, coupon.Usage{}, nil, money.Floor)
+	if !errors.Is(err, errCouponNotActive) {
+		t.Errorf("ApplyCoupon() at expiry error = %v, want %v", err, errCouponNotActive)
+	}
+}
+
+func TestGetAppliableCouponsUsageLimits(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 1, Price: inr(100)},
+	}
+	intPtr := func(i int) *int { return &i }
+
+	tests := []struct {
+		name     string
+		coupon   coupon.Coupon
+		usage    coupon.Usage
+		expected []DiscountCoupon
+	}{
+		{
+			name:     "Unlimited coupon has no remaining uses",
+			coupon:   coupon.Coupon{ID: 1},
+			usage:    coupon.Usage{Total: 1000},
+			expected: []DiscountCoupon{{CouponID: 1, Type: "cart-wise", Discount: inr(10), Currency: money.INR}},
+		},
+		{
+			name:     "Total limit reports remaining uses",
+			coupon:   coupon.Coupon{ID: 1, MaxTotalUses: 5},
+			usage:    coupon.Usage{Total: 3},
+			expected: []DiscountCoupon{{CouponID: 1, Type: "cart-wise", Discount: inr(10), Currency: money.INR, RemainingUses: intPtr(2)}},
+		},
+		{
+			name:     "Total limit exhausted",
+			coupon:   coupon.Coupon{ID: 1, MaxTotalUses: 5},
+			usage:    coupon.Usage{Total: 5},
+			expected: []DiscountCoupon{},
+		},
+		{
+			name:     "Lower of total and per customer limit is reported",
+			coupon:   coupon.Coupon{ID: 1, MaxTotalUses: 5, MaxUsesPerCustomer: 2},
+			usage:    coupon.Usage{CustomerID: 9, Total: 1, ByCustomer: 1},
+			expected: []DiscountCoupon{{CouponID: 1, Type: "cart-wise", Discount: inr(10), Currency: money.INR, RemainingUses: intPtr(1)}},
+		},
+		{
+			name:     "Per customer limit exhausted",
+			coupon:   coupon.Coupon{ID: 1, MaxUsesPerCustomer: 2},
+			usage:    coupon.Usage{CustomerID: 9, Total: 2, ByCustomer: 2},
+			expected: []DiscountCoupon{},
+		},
+		{
+			name:     "Per customer limit is not available to anonymous customer",
+			coupon:   coupon.Coupon{ID: 1, MaxUsesPerCustomer: 2},
+			usage:    coupon.Usage{},
+			expected: []DiscountCoupon{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			coup := tc.coupon
+			coup.Type = "cart-wise"
+			coup.Details = coupon.CartWiseDetails{Threshold: 50, Discount: 10}
+			usages := map[int]coupon.Usage{coup.ID: tc.usage}
+			got := GetAppliableCoupons(items, []coupon.Coupon{coup}, now, usages, nil, money.Floor)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestApplyCouponUsageLimits(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 1, Price: inr(100)},
+	}
+	coup := coupon.Coupon{
+		ID:                 1,
+		Type:               "cart-wise",
+		Details:            coupon.CartWiseDetails{Threshold: 50, Discount: 10},
+		MaxTotalUses:       10,
+		MaxUsesPerCustomer: 1,
+	}
+
+	tests := []struct {
+		name        string
+		usage       coupon.Usage
+		expectedErr error
+	}{
+		{name: "First use by customer", usage: coupon.Usage{CustomerID: 3, Total: 4}},
+		{name: "Second use by customer", usage: coupon.Usage{CustomerID: 3, Total: 4, ByCustomer: 1}, expectedErr: coupon.ErrUsageExhausted},
+		{name: "Total exhausted", usage: coupon.Usage{CustomerID: 3, Total: 10}, expectedErr: coupon.ErrUsageExhausted},
+		{name: "Anonymous customer", usage: coupon.Usage{Total: 4}, expectedErr: coupon.ErrCustomerRequired},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ApplyCoupon(items, coup, now, tc.usage, nil, money.Floor)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("ApplyCoupon() error = %v, want %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestApplyCouponRounding(t *testing.T) {
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 1, Price: inr(670), Category: "clothing"},
+		{ProductID: 2, Quantity: 1, Price: inr(335), Category: "clothing"},
+	}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}},
+		{ID: 2, Type: "category-wise", Details: coupon.CategoryWiseDetails{Category: "clothing", Discount: 10}},
+	}
+	tests := []struct {
+		rounding      money.Rounding
+		totalDiscount money.Money
+		itemDiscounts []money.Money
+	}{
+		// 10% of 1005 is 100.5
+		{rounding: money.HalfUp, totalDiscount: inr(101), itemDiscounts: []money.Money{inr(67), inr(34)}},
+		{rounding: money.HalfEven, totalDiscount: inr(100), itemDiscounts: []money.Money{inr(67), inr(33)}},
+		{rounding: money.Floor, totalDiscount: inr(100), itemDiscounts: []money.Money{inr(67), inr(33)}},
+	}
+
+	for _, tc := range tests {
+		for _, coup := range coupons {
+			t.Run(tc.rounding.String()+" "+string(coup.Type), func(t *testing.T) {
+				got, err := ApplyCoupon(items, coup, time.Now(), coupon.Usage{}, nil, tc.rounding)
+				if err != nil {
+					t.Fatalf("ApplyCoupon() unexpected error: %v", err)
+				}
+				if got.TotalDiscount != tc.totalDiscount {
+					t.Errorf("ApplyCoupon() total discount = %v, want %v", got.TotalDiscount, tc.totalDiscount)
+				}
+				for i, item := range got.Items {
+					if item.Discount != tc.itemDiscounts[i] {
+						t.Errorf("ApplyCoupon() item %d discount = %v, want %v", i, item.Discount, tc.itemDiscounts[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestGetAppliableCouponsCurrency(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: money.New(1_500, money.USD)},
+	}
+	coupons := []coupon.Coupon{
+		// the threshold without currency is in INR
+		{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 100, Discount: 10}},
+		{ID: 2, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 10}},
+		{ID: 3, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 500, DiscountKind: coupon.DiscountFixed}, Currency: money.USD},
+		{ID: 4, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 500, DiscountKind: coupon.DiscountFixed}, Currency: money.INR},
+	}
+
+	got := GetAppliableCoupons(items, coupons, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{
+		{CouponID: 2, Type: "product-wise", Discount: money.New(300, money.USD), Currency: money.USD},
+		{CouponID: 3, Type: "product-wise", Discount: money.New(500, money.USD), Currency: money.USD},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestApplyCouponCurrency(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 1, Price: money.New(2_000, money.USD)},
+	}
+	fixed := coupon.ProductWiseDetails{ProductID: 1, Discount: 500, DiscountKind: coupon.DiscountFixed}
+
+	got, err := ApplyCoupon(items, coupon.Coupon{ID: 1, Type: "product-wise", Details: fixed, Currency: money.USD}, now, coupon.Usage{}, nil, money.Floor)
+	if err != nil {
+		t.Fatalf("ApplyCoupon() unexpected error: %v", err)
+	}
+	if got.Currency != money.USD || got.FinalPrice != money.New(1_500, money.USD) {
+		t.Errorf("ApplyCoupon() = %+v, want final price of 1500 USD", got)
+	}
+
+	_, err = ApplyCoupon(items, coupon.Coupon{ID: 2, Type: "product-wise", Details: fixed}, now, coupon.Usage{}, nil, money.Floor)
+	if !errors.Is(err, errCurrencyMismatch) {
+		t.Errorf("ApplyCoupon() of INR coupon to USD cart error = %v, want %v", err, errCurrencyMismatch)
+	}
+}
+
+func TestCouponConditions(t *testing.T) {
+	// 2025-10-18 is a Saturday
+	now := time.Date(2025, time.October, 18, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(500), Category: "Shoes"},
+		{ProductID: 2, Quantity: 1, Price: inr(200), Category: "books"},
+	}
+	weekend := &rule.Rule{All: []rule.Rule{
+		{Condition: rule.Condition{Type: rule.CartTotal, Amount: 1_000}},
+		{Condition: rule.Condition{Type: rule.ContainsCategory, Category: "shoes", Quantity: 2}},
+		{Condition: rule.Condition{Type: rule.DayOfWeek, Days: []string{"saturday", "sunday"}}},
+	}}
+	noBooks := &rule.Rule{Not: &rule.Rule{Condition: rule.Condition{Type: rule.ContainsCategory, Category: "books"}}}
+	vip := &rule.Rule{Condition: rule.Condition{Type: rule.CustomerSegment, Segment: "vip"}}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, Conditions: weekend},
+		{ID: 2, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 20}, Conditions: noBooks},
+		{ID: 3, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 30}, Conditions: vip},
+		{ID: 4, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 5}, Expression: `cart.total > 1000 && count(items, category == "shoes") >= 2`},
+		{ID: 5, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 40}, Expression: `sum(items, price * quantity) < 1000`},
+	}
+
+	applicable := GetAppliableCoupons(items, coupons, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{
+		{CouponID: 1, Type: "cart-wise", Discount: inr(120), Currency: money.INR},
+		{CouponID: 4, Type: "cart-wise", Discount: inr(60), Currency: money.INR},
+	}
+	if !reflect.DeepEqual(applicable, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", applicable, expected)
+	}
+
+	if _, err := ApplyCoupon(items, coupons[0], now, coupon.Usage{}, nil, money.Floor); err != nil {
+		t.Errorf("ApplyCoupon() unexpected error: %v", err)
+	}
+	if _, err := ApplyCoupon(items, coupons[0], now.AddDate(0, 0, 2), coupon.Usage{}, nil, money.Floor); !errors.Is(err, errConditionsNotMet) {
+		t.Errorf("ApplyCoupon() on a Monday error = %v, want %v", err, errConditionsNotMet)
+	}
+	if _, err := ApplyCoupon(items, coupons[1], now, coupon.Usage{}, nil, money.Floor); !errors.Is(err, errConditionsNotMet) {
+		t.Errorf("ApplyCoupon() with books error = %v, want %v", err, errConditionsNotMet)
+	}
+	if _, err := ApplyCoupon(items, coupons[4], now, coupon.Usage{}, nil, money.Floor); !errors.Is(err, errConditionsNotMet) {
+		t.Errorf("ApplyCoupon() with false expression error = %v, want %v", err, errConditionsNotMet)
+	}
+
+	stacked, _ := ApplyCoupons(items, coupons, now, nil, nil, money.Floor)
+	if len(stacked.Coupons) != 1 || stacked.Coupons[0].CouponID != 1 {
+		t.Errorf("ApplyCoupons() coupons = %+v, want only coupon 1", stacked.Coupons)
+	}
+
+	evaluation := EvaluateCoupon(items, coupons[2], now, coupon.Usage{}, nil, money.Floor)
+	if evaluation.Reason == nil || evaluation.Reason.Code != ReasonConditionsNotMet {
+		t.Errorf("EvaluateCoupon() = %+v, want reason %s", evaluation, ReasonConditionsNotMet)
+	}
+	evaluation = EvaluateCoupon(items, coupons[4], now, coupon.Usage{}, nil, money.Floor)
+	if evaluation.Reason == nil || evaluation.Reason.Code != ReasonConditionsNotMet {
+		t.Errorf("EvaluateCoupon() of false expression = %+v, want reason %s", evaluation, ReasonConditionsNotMet)
+	}
+}
+
+func TestCustomerConditions(t *testing.T) {
+	now := time.Date(2025, time.October, 18, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{{ProductID: 1, Quantity: 2, Price: inr(500), Category: "shoes"}}
+	vip := &rule.Rule{Condition: rule.Condition{Type: rule.CustomerSegment, Segment: "vip"}}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, Conditions: vip},
+		{ID: 2, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 20}, Expression: `customer.order_count >= 5 || has_segment("staff")`},
+	}
+
+	tests := []struct {
+		name     string
+		customer *customer.Customer
+		expected []int
+	}{
+		{name: "Anonymous", customer: nil, expected: []int{}},
+		{name: "VIP", customer: &customer.Customer{ID: 1, Segments: []string{"vip"}}, expected: []int{1}},
+		{name: "Loyal", customer: &customer.Customer{ID: 2, OrderCount: 5}, expected: []int{2}},
+		{name: "VIP staff", customer: &customer.Customer{ID: 3, Segments: []string{"staff", "vip"}}, expected: []int{1, 2}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := make([]int, 0)
+			for _, applicable := range GetAppliableCoupons(items, coupons, now, nil, tc.customer, money.Floor) {
+				got = append(got, applicable.CouponID)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("GetAppliableCoupons() coupons = %v, want %v", got, tc.expected)
+			}
+			_, err := ApplyCoupon(items, coupons[0], now, coupon.Usage{}, tc.customer, money.Floor)
+			if isVIP := slices.Contains(tc.expected, 1); isVIP != (err == nil) {
+				t.Errorf("ApplyCoupon() of the vip coupon error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFirstOrderOnly(t *testing.T) {
+	now := time.Date(2025, time.October, 18, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{{ProductID: 1, Quantity: 2, Price: inr(500)}}
+	welcome := coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, FirstOrderOnly: true}
+	everyone := coupon.Coupon{ID: 2, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 5}}
+	coupons := []coupon.Coupon{welcome, everyone}
+
+	tests := []struct {
+		name           string
+		customer       *customer.Customer
+		usage          coupon.Usage
+		expectedIDs    []int
+		expectedErr    error
+		expectedReason ReasonCode
+	}{
+		{
+			name:        "Brand new customer",
+			customer:    &customer.Customer{ID: 1},
+			expectedIDs: []int{1, 2},
+		},
+		{
+			name:           "Returning customer",
+			customer:       &customer.Customer{ID: 2, OrderCount: 1, LifetimeSpend: 900},
+			expectedIDs:    []int{2},
+			expectedErr:    coupon.ErrNotFirstOrder,
+			expectedReason: ReasonFirstOrderOnly,
+		},
+		{
+			// the order count is not updated by the redemptions, the usage is
+			name:           "New customer who already redeemed it",
+			customer:       &customer.Customer{ID: 3},
+			usage:          coupon.Usage{CustomerID: 3, Total: 1, ByCustomer: 1},
+			expectedIDs:    []int{2},
+			expectedErr:    coupon.ErrNotFirstOrder,
+			expectedReason: ReasonFirstOrderOnly,
+		},
+		{
+			name:           "Anonymous shopper",
+			customer:       nil,
+			expectedIDs:    []int{2},
+			expectedErr:    coupon.ErrCustomerRequired,
+			expectedReason: ReasonCustomerRequired,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			usages := map[int]coupon.Usage{welcome.ID: tc.usage}
+			got := make([]int, 0)
+			for _, applicable := range GetAppliableCoupons(items, coupons, now, usages, tc.customer, money.Floor) {
+				got = append(got, applicable.CouponID)
+			}
+			if !reflect.DeepEqual(got, tc.expectedIDs) {
+				t.Errorf("GetAppliableCoupons() coupons = %v, want %v", got, tc.expectedIDs)
+			}
+
+			applied, err := ApplyCoupon(items, welcome, now, tc.usage, tc.customer, money.Floor)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("ApplyCoupon() error = %v, want %v", err, tc.expectedErr)
+			}
+			if err == nil && applied.TotalDiscount != inr(100) {
+				t.Errorf("ApplyCoupon() total discount = %v, want %v", applied.TotalDiscount, inr(100))
+			}
+
+			evaluation := EvaluateCoupon(items, welcome, now, tc.usage, tc.customer, money.Floor)
+			if tc.expectedReason == "" && !evaluation.Applicable {
+				t.Errorf("EvaluateCoupon() = %+v, want applicable", evaluation)
+			}
+			if tc.expectedReason != "" && (evaluation.Reason == nil || evaluation.Reason.Code != tc.expectedReason) {
+				t.Errorf("EvaluateCoupon() = %+v, want reason %s", evaluation, tc.expectedReason)
+			}
+
+			stacked, _ := ApplyCoupons(items, []coupon.Coupon{welcome}, now, usages, tc.customer, money.Floor)
+			if applied := len(stacked.Coupons) == 1; applied != (tc.expectedErr == nil) {
+				t.Errorf("ApplyCoupons() coupons = %+v", stacked.Coupons)
+			}
+		})
+	}
+}
+
+func TestFirstOrderOnlyAppliedTwice(t *testing.T) {
+	now := time.Date(2025, time.October, 18, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{{ProductID: 1, Quantity: 2, Price: inr(500)}}
+	repo := coupon.NewRepository()
+	welcome, err := repo.CreateCoupon(coupon.Coupon{Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, FirstOrderOnly: true})
+	if err != nil {
+		t.Fatalf("CreateCoupon() unexpected error: %v", err)
+	}
+	newCustomer := &customer.Customer{ID: 1}
+
+	// the order count of the customer stays 0, the redemption of the first apply has to block the second
+	for i, expectedErr := range []error{nil, coupon.ErrNotFirstOrder} {
+		usage, err := repo.GetUsage(welcome.ID, newCustomer.ID)
+		if err != nil {
+			t.Fatalf("GetUsage() unexpected error: %v", err)
+		}
+		applied, err := ApplyCoupon(items, welcome, now, usage, newCustomer, money.Floor)
+		if !errors.Is(err, expectedErr) {
+			t.Fatalf("ApplyCoupon() #%d error = %v, want %v", i+1, err, expectedErr)
+		}
+		if err != nil {
+			continue
+		}
+		err = repo.RecordRedemption(coupon.Redemption{
+			CouponID:   welcome.ID,
+			CustomerID: newCustomer.ID,
+			CartTotal:  int(applied.TotalPrice.Amount),
+			Discount:   int(applied.TotalDiscount.Amount),
+			RedeemedAt: now,
+			Currency:   applied.TotalPrice.Currency,
+		})
+		if err != nil {
+			t.Fatalf("RecordRedemption() unexpected error: %v", err)
+		}
+	}
+}
+
+func TestToPricedItem(t *testing.T) {
+	product := catalog.Product{ID: 1, Price: 19_900, Prices: map[money.Currency]int{money.USD: 299}, Category: "kitchen", Active: true}
+	item := Item{ProductID: 1, Quantity: 2}
+	tests := []struct {
+		currency    money.Currency
+		expected    PricedItem
+		expectedErr error
+	}{
+		{currency: money.INR, expected: PricedItem{ProductID: 1, Quantity: 2, Price: inr(19_900), Category: "kitchen"}},
+		{currency: money.USD, expected: PricedItem{ProductID: 1, Quantity: 2, Price: money.New(299, money.USD), Category: "kitchen"}},
+	}
+
+	for _, tc := range tests {
+		got, err := item.ToPricedItem(product, tc.currency)
+		if err != nil {
+			t.Fatalf("ToPricedItem(%s) unexpected error: %v", tc.currency, err)
+		}
+		if got != tc.expected {
+			t.Errorf("ToPricedItem(%s) = %+v, want %+v", tc.currency, got, tc.expected)
+		}
+	}
+
+	product.Prices = nil
+	if _, err := item.ToPricedItem(product, money.USD); !errors.Is(err, catalog.ErrPriceUnavailable) {
+		t.Errorf("ToPricedItem() without USD price error = %v, want %v", err, catalog.ErrPriceUnavailable)
+	}
+}
+
+// TestDiscountsReconcile applies every coupon type to random carts with every rounding,
+// the item discounts must add up to the total discount to the paisa
+func TestDiscountsReconcile(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(17, 2025))
+	categories := []string{"clothing", "electronics", ""}
+	brands := []string{"Dell", "Apple", ""}
+	coupons := []coupon.Coupon{
+		{ID: 1, Type: "cart-wise", Stackable: true, Details: coupon.CartWiseDetails{Threshold: 1_000, Discount: 7}},
+		{ID: 2, Type: "cart-wise", Details: coupon.CartWiseDetails{
+			Tiers:       []coupon.CartWiseTier{{Threshold: 500, Discount: 3}, {Threshold: 50_000, Discount: 13}},
+			MaxDiscount: 9_999,
+		}},
+		{ID: 3, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 20_000, Discount: 15_000, DiscountKind: coupon.DiscountFixed}},
+		{ID: 4, Type: "product-wise", Stackable: true, Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 33}},
+		{ID: 5, Type: "product-wise", Stackable: true, Details: coupon.ProductWiseDetails{ProductID: 2, Discount: 5_000, DiscountKind: coupon.DiscountFixed}},
+		{ID: 6, Type: "bxgy", Stackable: true, Details: coupon.BxGyDetails{
+			BuyProducts:     []coupon.CouponProduct{{ProductID: 3, Quantity: 2}},
+			GetProducts:     []coupon.CouponProduct{{ProductID: 4, Quantity: 1}},
+			RepetitionLimit: 2,
+		}},
+		{ID: 7, Type: "category-wise", Stackable: true, Details: coupon.CategoryWiseDetails{Category: "clothing", Discount: 17, MaxDiscount: 12_345}},
+		{ID: 8, Type: "brand-wise", Stackable: true, Details: coupon.BrandWiseDetails{Brand: "dell", Discount: 11, ExcludedProductIDs: []int{5}}},
+		{ID: 9, Type: "volume-tier", Stackable: true, Details: coupon.VolumeTierDetails{
+			Category: "electronics",
+			Tiers:    []coupon.VolumeTier{{MinQuantity: 3, Discount: 9}, {MinQuantity: 10, Discount: 21}},
+		}},
+	}
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+
+	check := func(t *testing.T, items []PricedItem, got DiscountedCart) {
+		t.Helper()
+		totalPrice, totalDiscount := inr(0), inr(0)
+		for i, item := range got.Items {
+			amount := items[i].Amount()
+			if item.Discount.Amount < 0 || item.Discount.Cmp(amount) > 0 {
+				t.Errorf("item %d discount %v is not within its amount %v", i, item.Discount, amount)
+			}
+			totalPrice = totalPrice.Add(amount)
+			totalDiscount = totalDiscount.Add(item.Discount)
+		}
+		if got.TotalPrice != totalPrice {
+			t.Errorf("total price = %v, want the sum of the items %v", got.TotalPrice, totalPrice)
+		}
+		if got.TotalDiscount != totalDiscount {
+			t.Errorf("total discount = %v, want the sum of the item discounts %v", got.TotalDiscount, totalDiscount)
+		}
+		if got.FinalPrice != totalPrice.Sub(totalDiscount) {
+			t.Errorf("final price = %v, want %v", got.FinalPrice, totalPrice.Sub(totalDiscount))
+		}
+		if got.Coupons != nil {
+			byCoupon := inr(0)
+			for _, applied := range got.Coupons {
+				byCoupon = byCoupon.Add(applied.Discount)
+			}
+			if byCoupon != totalDiscount {
+				t.Errorf("coupon breakdown sums to %v, want %v", byCoupon, totalDiscount)
+			}
+		}
+	}
+
+	for range 300 {
+		items := make([]PricedItem, 1+rnd.IntN(6))
+		for i := range items {
+			items[i] = PricedItem{
+				ProductID: i + 1,
+				Quantity:  1 + rnd.IntN(12),
+				Price:     inr(1 + rnd.Int64N(99_999)),
+				Category:  categories[rnd.IntN(len(categories))],
+				Brand:     brands[rnd.IntN(len(brands))],
+			}
+		}
+		for _, rounding := range []money.Rounding{money.HalfUp, money.HalfEven, money.Floor} {
+			for _, coup := range coupons {
+				got, err := ApplyCoupon(items, coup, now, coupon.Usage{}, nil, rounding)
+				if err != nil {
+					t.Fatalf("ApplyCoupon() unexpected error: %v", err)
+				}
+				check(t, items, got)
+			}
+			stacked, _ := ApplyCoupons(items, coupons, now, nil, nil, rounding)
+			check(t, items, stacked)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package cart
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+var errInvalidDetails = errors.New("invalid coupon details")
+
+// Calculator computes the discounts of a coupon type
+// every type registered with coupon.Register needs a calculator registered with RegisterCalculator
+type Calculator struct {
+	// Level orders the coupons of a combination, the lower levels are applied first
+	// so the product level coupons (0) are applied before the cart level ones (1)
+	Level int
+	// Evaluate gives the discount of the coupon on the cart, the reason is nil if the coupon is applicable
+	Evaluate func(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason)
+	// Apply applies the coupon alone, the cart has zero discount if the coupon is not applicable
+	Apply func(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) DiscountedCart
+	// Stack gives the discount on the remaining amounts of the items in a combination along with the share of every item,
+	// no share is more than the remaining amount of the item
+	Stack func(items []PricedItem, remaining []money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier)
+}
+
+var calculators = struct {
+	mu          sync.RWMutex
+	calculators map[coupon.CouponType]Calculator
+}{calculators: make(map[coupon.CouponType]Calculator)}
+
+// RegisterCalculator adds the calculator of the coupon type, it is meant to be called from an init function
+// It will panic if the calculator is incomplete or the type already has one
+func RegisterCalculator(couponType coupon.CouponType, calc Calculator) {
+	if calc.Evaluate == nil || calc.Apply == nil || calc.Stack == nil {
+		panic(fmt.Sprintf("cart: RegisterCalculator of type %q without Evaluate, Apply or Stack", couponType))
+	}
+	calculators.mu.Lock()
+	defer calculators.mu.Unlock()
+	if _, ok := calculators.calculators[couponType]; ok {
+		panic(fmt.Sprintf("cart: RegisterCalculator of type %q twice", couponType))
+	}
+	calculators.calculators[couponType] = calc
+}
+
+// calculatorFor returns the calculator of the type of the coupon
+// It will return an error if the type is unknown or the details are not of the type
+func calculatorFor(coup coupon.Coupon) (Calculator, error) {
+	calculators.mu.RLock()
+	calc, ok := calculators.calculators[coup.Type]
+	calculators.mu.RUnlock()
+	if !ok {
+		return Calculator{}, fmt.Errorf("%w: %q of coupon %d", coupon.ErrUnknownType, coup.Type, coup.ID)
+	}
+	if coup.Details == nil || coup.Details.GetCouponType() != coup.Type {
+		return Calculator{}, fmt.Errorf("%w: coupon %d of type %q", errInvalidDetails, coup.ID, coup.Type)
+	}
+	return calc, nil
+}
+
+func init() {
+	RegisterCalculator(coupon.TypeCartWise, Calculator{
+		Level: 1,
+		Evaluate: func(_ []PricedItem, totalPrice money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, reason := appliableCartWiseCoupons(totalPrice, coup, rounding)
+			return discount, nil, reason
+		},
+		Apply: applyCartWiseCoupon,
+		Stack: stackCartWiseCoupon,
+	})
+	RegisterCalculator(coupon.TypeProductWise, Calculator{
+		Evaluate: func(items []PricedItem, _ money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, reason := appliableProductWiseCoupon(items, coup, rounding)
+			return discount, nil, reason
+		},
+		Apply: applyProductWiseCoupon,
+		Stack: stackProductWiseCoupon,
+	})
+	RegisterCalculator(coupon.TypeBxGy, Calculator{
+		Evaluate: func(items []PricedItem, _ money.Money, coup coupon.Coupon, _ money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, _, reason := appliableBxGYCoupon(items, coup)
+			return discount, nil, reason
+		},
+		Apply: func(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, _ money.Rounding) DiscountedCart {
+			return applyBxGyWiseCoupon(items, totalPrice, coup)
+		},
+		Stack: stackBxGyCoupon,
+	})
+	RegisterCalculator(coupon.TypeCategoryWise, Calculator{
+		Evaluate: func(items []PricedItem, _ money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, _, reason := appliableCategoryWiseCoupon(items, coup, rounding)
+			return discount, nil, reason
+		},
+		Apply: applyCategoryWiseCoupon,
+		Stack: stackCategoryWiseCoupon,
+	})
+	RegisterCalculator(coupon.TypeBrandWise, Calculator{
+		Evaluate: func(items []PricedItem, _ money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, _, reason := appliableBrandWiseCoupon(items, coup, rounding)
+			return discount, nil, reason
+		},
+		Apply: applyBrandWiseCoupon,
+		Stack: func(items []PricedItem, remaining []money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+			discount, shares, _ := brandWiseDiscount(items, remaining, coup.Details.(coupon.BrandWiseDetails), rounding)
+			return discount, shares, nil
+		},
+	})
+	RegisterCalculator(coupon.TypeVolumeTier, Calculator{
+		Evaluate: func(items []PricedItem, _ money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, _, tier, reason := appliableVolumeTierCoupon(items, coup, rounding)
+			return discount, tier, reason
+		},
+		Apply: applyVolumeTierCoupon,
+		// the tier is by the quantity, only the discount is on the remaining price
+		Stack: func(items []PricedItem, remaining []money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+			discount, shares, tier, _ := volumeTierDiscount(items, remaining, coup.Details.(coupon.VolumeTierDetails), rounding)
+			return discount, shares, tier
+		},
+	})
+}
+
+// stackCartWiseCoupon gives the cart wise discount on the remaining total, prorated by the remaining amounts
+func stackCartWiseCoupon(_ []PricedItem, remaining []money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+	total := money.Zero(currencyOfAmounts(remaining))
+	for _, amount := range remaining {
+		total = total.Add(amount)
+	}
+	discount, _ := appliableCartWiseCoupons(total, coup, rounding)
+	return discount, money.Allocate(discount, remaining), nil
+}
+
+// stackProductWiseCoupon gives the discount on the remaining amount of the product
+func stackProductWiseCoupon(items []PricedItem, remaining []money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+	detail := coup.Details.(coupon.ProductWiseDetails)
+	i := slices.IndexFunc(items, func(item PricedItem) bool {
+		return item.ProductID == detail.ProductID
+	})
+	if i == -1 {
+		return money.Zero(currencyOfAmounts(remaining)), nil, nil
+	}
+	discount := capDiscount(detail.DiscountKind.DiscountOn(detail.Discount, remaining[i], rounding), detail.MaxDiscount)
+	shares := zeroShares(remaining)
+	shares[i] = discount
+	return discount, shares, nil
+}
+
+// stackBxGyCoupon gives the get products free upto their remaining amount
+func stackBxGyCoupon(items []PricedItem, remaining []money.Money, coup coupon.Coupon, _ money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+	_, productDiscounts, _ := appliableBxGYCoupon(items, coup)
+	discount := money.Zero(currencyOfAmounts(remaining))
+	shares := zeroShares(remaining)
+	for i, item := range items {
+		itemDiscount, ok := productDiscounts[item.ProductID]
+		if !ok {
+			continue
+		}
+		itemDiscount = itemDiscount.Min(remaining[i])
+		// the free quantity is given once even if the product is in the cart more than once
+		delete(productDiscounts, item.ProductID)
+		shares[i] = itemDiscount
+		discount = discount.Add(itemDiscount)
+	}
+	return discount, shares, nil
+}
+
+// stackCategoryWiseCoupon gives the category wise discount on the remaining amounts of the items of the category
+func stackCategoryWiseCoupon(items []PricedItem, remaining []money.Money, coup coupon.Coupon, rounding money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+	detail := coup.Details.(coupon.CategoryWiseDetails)
+	discount, shares, _ := discountMatching(remaining, func(i int) bool {
+		return matchesCategory(items[i], detail.Category)
+	}, detail.Discount, detail.MaxDiscount, rounding)
+	return discount, shares, nil
+}
+
+// currencyOfAmounts returns the currency of the amounts, all the amounts of a cart are in the same currency
+func currencyOfAmounts(amounts []money.Money) money.Currency {
+	if len(amounts) == 0 {
+		return money.DefaultCurrency
+	}
+	return amounts[0].Currency
+}
+
+// zeroShares returns no share for every amount
+func zeroShares(amounts []money.Money) []money.Money {
+	shares := make([]money.Money, len(amounts))
+	for i := range shares {
+		shares[i] = money.Zero(currencyOfAmounts(amounts))
+	}
+	return shares
+}
@@ -0,0 +1,138 @@
+package cart
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+// perUnitDetails is a coupon type registered only for the tests, Amount off every unit in the cart
+type perUnitDetails struct {
+	Amount int `json:"amount"`
+}
+
+const perUnitType coupon.CouponType = "per-unit-test"
+
+func (perUnitDetails) GetCouponType() coupon.CouponType { return perUnitType }
+
+func (perUnitDetails) ValidateCoupon() error { return nil }
+
+// perUnitShares gives every item Amount off each of its units, upto the amount of the item
+func perUnitShares(items []PricedItem, amounts []money.Money, coup coupon.Coupon) (money.Money, []money.Money) {
+	detail := coup.Details.(perUnitDetails)
+	discount := money.Zero(currencyOfAmounts(amounts))
+	shares := make([]money.Money, len(items))
+	for i, item := range items {
+		shares[i] = money.New(int64(detail.Amount*item.Quantity), amounts[i].Currency).Min(amounts[i])
+		discount = discount.Add(shares[i])
+	}
+	return discount, shares
+}
+
+func init() {
+	coupon.Register(coupon.Definition{Type: perUnitType, Decode: coupon.DecodeAs[perUnitDetails]})
+	RegisterCalculator(perUnitType, Calculator{
+		Evaluate: func(items []PricedItem, _ money.Money, coup coupon.Coupon, _ money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+			discount, _ := perUnitShares(items, amountsOf(items), coup)
+			if discount.IsZero() {
+				return discount, nil, &Reason{Code: ReasonNoMatchingItems, Message: "cart is empty"}
+			}
+			return discount, nil, nil
+		},
+		Apply: func(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, _ money.Rounding) DiscountedCart {
+			discount, shares := perUnitShares(items, amountsOf(items), coup)
+			discountedItems := make([]DiscountedItem, len(items))
+			for i, share := range shares {
+				discountedItems[i] = items[i].ToDiscountedItem(share)
+			}
+			return DiscountedCart{Items: discountedItems, TotalPrice: totalPrice, TotalDiscount: discount, FinalPrice: totalPrice.Sub(discount)}
+		},
+		Stack: func(items []PricedItem, remaining []money.Money, coup coupon.Coupon, _ money.Rounding) (money.Money, []money.Money, *coupon.VolumeTier) {
+			discount, shares := perUnitShares(items, remaining, coup)
+			return discount, shares, nil
+		},
+	})
+}
+
+func TestRegisteredCalculator(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100)},
+		{ProductID: 2, Quantity: 1, Price: inr(5)},
+	}
+	coup := coupon.Coupon{ID: 1, Type: perUnitType, Details: perUnitDetails{Amount: 10}}
+
+	applicable := GetAppliableCoupons(items, []coupon.Coupon{coup}, now, nil, nil, money.Floor)
+	expected := []DiscountCoupon{{CouponID: 1, Type: perUnitType, Discount: inr(25), Currency: money.INR}}
+	if !reflect.DeepEqual(applicable, expected) {
+		t.Errorf("GetAppliableCoupons() = %+v, want %+v", applicable, expected)
+	}
+
+	applied, err := ApplyCoupon(items, coup, now, coupon.Usage{}, nil, money.Floor)
+	if err != nil {
+		t.Fatalf("ApplyCoupon() unexpected error: %v", err)
+	}
+	if applied.TotalDiscount != inr(25) || applied.FinalPrice != inr(180) {
+		t.Errorf("ApplyCoupon() = %+v, want discount 25 and final price 180", applied)
+	}
+
+	stacked, _ := ApplyCoupons(items, []coupon.Coupon{coup}, now, nil, nil, money.Floor)
+	if stacked.TotalDiscount != inr(25) || len(stacked.Coupons) != 1 || stacked.Coupons[0].CouponID != 1 {
+		t.Errorf("ApplyCoupons() = %+v, want discount 25 of coupon 1", stacked)
+	}
+
+	details, err := coupon.DecodeDetails(perUnitType, []byte(`{"amount": 10}`))
+	if err != nil || details != (perUnitDetails{Amount: 10}) {
+		t.Errorf("DecodeDetails() = %+v, %v, want %+v", details, err, perUnitDetails{Amount: 10})
+	}
+}
+
+func TestUnknownCouponType(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100)},
+	}
+	tests := []struct {
+		name        string
+		coupon      coupon.Coupon
+		expectedErr error
+	}{
+		{
+			name:        "Unregistered type",
+			coupon:      coupon.Coupon{ID: 1, Type: "bogus", Details: coupon.CartWiseDetails{Discount: 10}},
+			expectedErr: coupon.ErrUnknownType,
+		},
+		{
+			name:        "Details of another type",
+			coupon:      coupon.Coupon{ID: 2, Type: "cart-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 10}},
+			expectedErr: errInvalidDetails,
+		},
+		{
+			name:        "Without details",
+			coupon:      coupon.Coupon{ID: 3, Type: "cart-wise"},
+			expectedErr: errInvalidDetails,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ApplyCoupon(items, tc.coupon, now, coupon.Usage{}, nil, money.Floor); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("ApplyCoupon() error = %v, want %v", err, tc.expectedErr)
+			}
+			if got := GetAppliableCoupons(items, []coupon.Coupon{tc.coupon}, now, nil, nil, money.Floor); len(got) != 0 {
+				t.Errorf("GetAppliableCoupons() = %+v, want none", got)
+			}
+			if got, _ := ApplyCoupons(items, []coupon.Coupon{tc.coupon}, now, nil, nil, money.Floor); !got.TotalDiscount.IsZero() || len(got.Coupons) != 0 {
+				t.Errorf("ApplyCoupons() = %+v, want no discount", got)
+			}
+			got := EvaluateCoupon(items, tc.coupon, now, coupon.Usage{}, nil, money.Floor)
+			if got.Applicable || got.Reason == nil || got.Reason.Code != ReasonUnknownType {
+				t.Errorf("EvaluateCoupon() = %+v, want reason %s", got, ReasonUnknownType)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package cart
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/expr"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
+)
+
+// ReasonCode is the machine readable reason of a coupon not being applicable to the cart
+type ReasonCode string
+
+const (
+	ReasonUnknownType       ReasonCode = "unknown_type"
+	ReasonCodeRequired      ReasonCode = "code_required"
+	ReasonNotStarted        ReasonCode = "not_started"
+	ReasonExpired           ReasonCode = "expired"
+	ReasonCustomerRequired  ReasonCode = "customer_required"
+	ReasonUsageExhausted    ReasonCode = "usage_exhausted"
+	ReasonFirstOrderOnly    ReasonCode = "first_order_only"
+	ReasonCurrencyMismatch  ReasonCode = "currency_mismatch"
+	ReasonConditionsNotMet  ReasonCode = "conditions_not_met"
+	ReasonThresholdNotMet   ReasonCode = "threshold_not_met"
+	ReasonProductNotInCart  ReasonCode = "product_not_in_cart"
+	ReasonMissingBuyProduct ReasonCode = "missing_buy_product"
+	ReasonBuyQuantityNotMet ReasonCode = "buy_quantity_not_met"
+	ReasonMissingGetProduct ReasonCode = "missing_get_product"
+	ReasonNoMatchingItems   ReasonCode = "no_matching_items"
+	ReasonMinSubtotalNotMet ReasonCode = "min_subtotal_not_met"
+	ReasonQuantityNotMet    ReasonCode = "quantity_not_met"
+)
+
+// Reason is why the coupon is not applicable to the cart
+type Reason struct {
+	Code    ReasonCode `json:"code"`
+	Message string     `json:"message"`
+	// ProductID is the product the reason is about, e.g. the missing buy product
+	ProductID int `json:"product_id,omitempty"`
+	// AmountShort is how much the cart is short of the threshold or min subtotal, in the currency of the cart
+	AmountShort *money.Money `json:"amount_short,omitempty"`
+	// QuantityShort is how many more units the cart needs for the coupon
+	QuantityShort int `json:"quantity_short,omitempty"`
+}
+
+// Evaluation is the outcome of checking a single coupon against the cart
+// Reason is nil for an applicable coupon
+type Evaluation struct {
+	CouponID   int                `json:"coupon_id"`
+	Type       coupon.CouponType  `json:"type"`
+	Applicable bool               `json:"applicable"`
+	Discount   money.Money        `json:"discount"`
+	Currency   money.Currency     `json:"currency"`
+	Tier       *coupon.VolumeTier `json:"tier,omitempty"`
+	Reason     *Reason            `json:"reason,omitempty"`
+}
+
+// amountShort is the reason of an amount which is short of the required amount
+func amountShort(code ReasonCode, have, want money.Money, message string) *Reason {
+	short := want.Sub(have)
+	return &Reason{Code: code, Message: fmt.Sprintf("%s, short by %d", message, short.Amount), AmountShort: &short}
+}
+
+// EvaluateCoupon checks the coupon against the cart in the same order GetAppliableCoupons does
+// and returns the discount, or the reason of the first check the coupon fails
+// usage is the usage of the coupon by the customer of the cart, cust is the customer, nil for an anonymous cart
+func EvaluateCoupon(items []PricedItem, coup coupon.Coupon, now time.Time, usage coupon.Usage, cust *customer.Customer, rounding money.Rounding) Evaluation {
+	totalPrice := totalOf(items)
+	evaluation := Evaluation{
+		CouponID: coup.ID,
+		Type:     coup.Type,
+		Discount: money.Zero(totalPrice.Currency),
+		Currency: totalPrice.Currency,
+	}
+	discount, tier, reason := evaluate(items, totalPrice, coup, now, usage, cust, rounding)
+	if reason != nil {
+		evaluation.Reason = reason
+		return evaluation
+	}
+	evaluation.Applicable = true
+	evaluation.Discount = discount
+	evaluation.Tier = tier
+	return evaluation
+}
+
+// evaluate runs the checks of EvaluateCoupon on the priced cart, the reason is nil if the coupon is applicable
+func evaluate(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, now time.Time, usage coupon.Usage, cust *customer.Customer, rounding money.Rounding) (money.Money, *coupon.VolumeTier, *Reason) {
+	noDiscount := money.Zero(totalPrice.Currency)
+	calc, err := calculatorFor(coup)
+	if err != nil {
+		return noDiscount, nil, &Reason{Code: ReasonUnknownType, Message: err.Error()}
+	}
+	// a coupon which requires a code is not advertised, the shopper has to know the code
+	if coup.RequiresCode {
+		return noDiscount, nil, &Reason{Code: ReasonCodeRequired, Message: "coupon can only be applied with its code"}
+	}
+	if coup.StartsAt != nil && now.Before(*coup.StartsAt) {
+		return noDiscount, nil, &Reason{Code: ReasonNotStarted, Message: "coupon is valid from " + coup.StartsAt.Format(time.RFC3339)}
+	}
+	if !coup.IsActiveAt(now) {
+		return noDiscount, nil, &Reason{Code: ReasonExpired, Message: "coupon expired at " + coup.EndsAt.Format(time.RFC3339)}
+	}
+	if err := coup.CheckUsage(usage); err != nil {
+		code := ReasonUsageExhausted
+		if errors.Is(err, coupon.ErrCustomerRequired) {
+			code = ReasonCustomerRequired
+		}
+		return noDiscount, nil, &Reason{Code: code, Message: err.Error()}
+	}
+	if err := checkFirstOrder(coup, usage, cust); err != nil {
+		code := ReasonFirstOrderOnly
+		if errors.Is(err, coupon.ErrCustomerRequired) {
+			code = ReasonCustomerRequired
+		}
+		return noDiscount, nil, &Reason{Code: code, Message: err.Error()}
+	}
+	if !coup.AppliesIn(totalPrice.Currency) {
+		return noDiscount, nil, &Reason{Code: ReasonCurrencyMismatch, Message: fmt.Sprintf("coupon is not valid in %s", totalPrice.Currency)}
+	}
+	if err := checkConditions(items, totalPrice, coup, now, cust); err != nil {
+		return noDiscount, nil, &Reason{Code: ReasonConditionsNotMet, Message: err.Error()}
+	}
+
+	discount, tier, reason := calc.Evaluate(items, totalPrice, coup, rounding)
+	if reason != nil {
+		return noDiscount, nil, reason
+	}
+	return discount, tier, nil
+}
+
+// checkFirstOrder returns an error if the coupon is only for the first order and the customer has completed an order
+// or has already redeemed the coupon, the order count of the customer is not updated by the redemptions
+// an anonymous cart has no order history, so it needs a customer
+func checkFirstOrder(coup coupon.Coupon, usage coupon.Usage, cust *customer.Customer) error {
+	if !coup.FirstOrderOnly {
+		return nil
+	}
+	if cust == nil {
+		return fmt.Errorf("%w: coupon %d is only for the first order of a customer", coupon.ErrCustomerRequired, coup.ID)
+	}
+	if cust.OrderCount > 0 {
+		return fmt.Errorf("%w: coupon %d, customer %d has %d orders", coupon.ErrNotFirstOrder, coup.ID, cust.ID, cust.OrderCount)
+	}
+	return coup.CheckFirstOrder(usage)
+}
+
+// checkConditions returns an error if the cart does not meet the conditions or the expression of the coupon
+// an expression which fails to evaluate, e.g. on the step limit, is not met
+// an anonymous cart, i.e. a nil customer, is in no segment and has no orders
+func checkConditions(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, now time.Time, cust *customer.Customer) error {
+	if coup.Conditions != nil {
+		facts := rule.Facts{Total: totalPrice, Items: make([]rule.Item, len(items)), Now: now}
+		if cust != nil {
+			facts.Segments = cust.Segments
+		}
+		for i, item := range items {
+			facts.Items[i] = rule.Item{ProductID: item.ProductID, Category: item.Category, Quantity: item.Quantity}
+		}
+		if !coup.Conditions.Matches(facts) {
+			return fmt.Errorf("%w: coupon %d", errConditionsNotMet, coup.ID)
+		}
+	}
+	if coup.Expression == "" {
+		return nil
+	}
+	program, err := expr.CompileCached(coup.Expression)
+	if err != nil {
+		return fmt.Errorf("%w: expression of coupon %d: %w", errConditionsNotMet, coup.ID, err)
+	}
+	// the category and the brand are lower case, so they compare case-insensitive like in the other coupons
+	env := expr.Env{Total: totalPrice.Amount, Currency: string(totalPrice.Currency), Items: make([]expr.Item, len(items)), Now: now}
+	for i, item := range items {
+		env.Items[i] = expr.Item{
+			ProductID: item.ProductID,
+			Category:  strings.ToLower(strings.TrimSpace(item.Category)),
+			Brand:     strings.ToLower(strings.TrimSpace(item.Brand)),
+			Quantity:  item.Quantity,
+			Price:     item.Price.Amount,
+		}
+	}
+	if cust != nil {
+		env.Customer = expr.Customer{OrderCount: cust.OrderCount, LifetimeSpend: int64(cust.LifetimeSpend), Segments: cust.Segments}
+	}
+	ok, err := program.Eval(env)
+	if err != nil {
+		return fmt.Errorf("%w: expression of coupon %d: %w", errConditionsNotMet, coup.ID, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: coupon %d, %s is false", errConditionsNotMet, coup.ID, program)
+	}
+	return nil
+}
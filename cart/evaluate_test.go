@@ -0,0 +1,166 @@
+package cart
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+func TestEvaluateCoupon(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	short := func(amount int64) *money.Money {
+		m := inr(amount)
+		return &m
+	}
+
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100), Category: "clothing", Brand: "Acme"},
+		{ProductID: 2, Quantity: 1, Price: inr(50), Category: "books"},
+	}
+	tests := []struct {
+		name     string
+		coupon   coupon.Coupon
+		usage    coupon.Usage
+		expected Evaluation
+	}{
+		{
+			name:     "Applicable",
+			coupon:   coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 200, Discount: 10}},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Applicable: true, Discount: inr(25), Currency: money.INR},
+		},
+		{
+			name:   "Threshold not met",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 400, Discount: 10}},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonThresholdNotMet, Message: "cart total 250 is below the threshold 400, short by 150", AmountShort: short(150),
+			}},
+		},
+		{
+			name:   "Threshold of the first tier not met",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Tiers: []coupon.CartWiseTier{{Threshold: 300, Discount: 5}, {Threshold: 500, Discount: 10}}}},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonThresholdNotMet, Message: "cart total 250 is below the threshold 300, short by 50", AmountShort: short(50),
+			}},
+		},
+		{
+			name:   "Product not in cart",
+			coupon: coupon.Coupon{ID: 2, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 9, Discount: 10}},
+			expected: Evaluation{CouponID: 2, Type: "product-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonProductNotInCart, Message: "product 9 is not in the cart", ProductID: 9,
+			}},
+		},
+		{
+			name: "Missing buy product",
+			coupon: coupon.Coupon{ID: 3, Type: "bxgy", Details: coupon.BxGyDetails{
+				BuyProducts:     []coupon.CouponProduct{{ProductID: 1, Quantity: 2}, {ProductID: 3, Quantity: 2}},
+				GetProducts:     []coupon.CouponProduct{{ProductID: 2, Quantity: 1}},
+				RepetitionLimit: 1,
+			}},
+			expected: Evaluation{CouponID: 3, Type: "bxgy", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonMissingBuyProduct, Message: "buy product 3 is not in the cart", ProductID: 3,
+			}},
+		},
+		{
+			name: "Buy quantity not met",
+			coupon: coupon.Coupon{ID: 3, Type: "bxgy", Details: coupon.BxGyDetails{
+				BuyProducts:     []coupon.CouponProduct{{ProductID: 1, Quantity: 3}},
+				GetProducts:     []coupon.CouponProduct{{ProductID: 2, Quantity: 1}},
+				RepetitionLimit: 1,
+			}},
+			expected: Evaluation{CouponID: 3, Type: "bxgy", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonBuyQuantityNotMet, Message: "cart has 2 of the 3 buy products required", QuantityShort: 1,
+			}},
+		},
+		{
+			name: "Missing get product",
+			coupon: coupon.Coupon{ID: 3, Type: "bxgy", Details: coupon.BxGyDetails{
+				BuyProducts:     []coupon.CouponProduct{{ProductID: 1, Quantity: 2}},
+				GetProducts:     []coupon.CouponProduct{{ProductID: 4, Quantity: 1}},
+				RepetitionLimit: 1,
+			}},
+			expected: Evaluation{CouponID: 3, Type: "bxgy", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonMissingGetProduct, Message: "none of the get products are in the cart in the required quantity",
+			}},
+		},
+		{
+			name:   "No items of the category",
+			coupon: coupon.Coupon{ID: 4, Type: "category-wise", Details: coupon.CategoryWiseDetails{Category: "toys", Discount: 10}},
+			expected: Evaluation{CouponID: 4, Type: "category-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonNoMatchingItems, Message: "none of the items in the cart are eligible for the coupon",
+			}},
+		},
+		{
+			name:   "Min subtotal not met",
+			coupon: coupon.Coupon{ID: 5, Type: "brand-wise", Details: coupon.BrandWiseDetails{Brand: "acme", Discount: 10, MinSubtotal: 500}},
+			expected: Evaluation{CouponID: 5, Type: "brand-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonMinSubtotalNotMet, Message: "subtotal 200 of the acme items is below the min subtotal 500, short by 300", AmountShort: short(300),
+			}},
+		},
+		{
+			name:   "Volume not met",
+			coupon: coupon.Coupon{ID: 6, Type: "volume-tier", Details: coupon.VolumeTierDetails{ProductID: 1, Tiers: []coupon.VolumeTier{{MinQuantity: 5, Discount: 10}}}},
+			expected: Evaluation{CouponID: 6, Type: "volume-tier", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonQuantityNotMet, Message: "cart has 2 of the 5 units of the first tier", ProductID: 1, QuantityShort: 3,
+			}},
+		},
+		{
+			name:   "Requires code",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, RequiresCode: true},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonCodeRequired, Message: "coupon can only be applied with its code",
+			}},
+		},
+		{
+			name:   "Not started",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, StartsAt: &future},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonNotStarted, Message: "coupon is valid from 2025-10-20T13:00:00Z",
+			}},
+		},
+		{
+			name:   "Expired",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, EndsAt: &past},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonExpired, Message: "coupon expired at 2025-10-20T11:00:00Z",
+			}},
+		},
+		{
+			name:   "Usage exhausted",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, MaxTotalUses: 3},
+			usage:  coupon.Usage{Total: 3},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonUsageExhausted, Message: "coupon usage exhausted: coupon 1 has no remaining uses",
+			}},
+		},
+		{
+			name:   "Customer required",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, MaxUsesPerCustomer: 1},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonCustomerRequired, Message: "customer is required: coupon 1 is limited per customer",
+			}},
+		},
+		{
+			name:   "Currency mismatch",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 10}, Currency: money.USD},
+			expected: Evaluation{CouponID: 1, Type: "cart-wise", Discount: inr(0), Currency: money.INR, Reason: &Reason{
+				Code: ReasonCurrencyMismatch, Message: "coupon is not valid in INR",
+			}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := EvaluateCoupon(items, tc.coupon, now, tc.usage, nil, money.Floor)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("EvaluateCoupon() = %+v, want %+v", got, tc.expected)
+				if got.Reason != nil && tc.expected.Reason != nil {
+					t.Errorf("reason = %+v, want %+v", *got.Reason, *tc.expected.Reason)
+				}
+			}
+		})
+	}
+}
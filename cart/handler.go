@@ -2,26 +2,47 @@ package cart
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
 	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/money"
 	"github.com/ParasRaba155/monk-commerce-task/utils"
 )
 
 type Repository interface {
 	GetAllCoupons() ([]coupon.Coupon, error)
 	GetCouponByID(id int) (coupon.Coupon, error)
+	GetCouponByCode(code string) (coupon.Coupon, error)
+	GetCouponCode(code string) (coupon.CouponCode, error)
+	GetUsage(couponID, customerID int) (coupon.Usage, error)
+	GetUsages(couponIDs []int, customerID int) (map[int]coupon.Usage, error)
+	RecordRedemption(redemption coupon.Redemption) error
+	RecordRedemptions(redemptions []coupon.Redemption) error
 }
 
+// Clock returns the current time, it is injected in the handler so that
+// the validity window of the coupons can be checked against a pinned time
+type Clock func() time.Time
+
 type cartHandler struct {
-	Repo Repository
+	Repo      Repository
+	Products  ProductRepository
+	Customers CustomerRepository
+	Clock     Clock
+	// Rounding of the percentage discounts, the zero value is money.HalfUp
+	Rounding money.Rounding
 }
 
-func NewHandler(repo Repository) cartHandler {
-	return cartHandler{Repo: repo}
+func NewHandler(repo Repository, products ProductRepository, customers CustomerRepository) cartHandler {
+	return cartHandler{Repo: repo, Products: products, Customers: customers, Clock: time.Now}
 }
 
 func (h cartHandler) ApplicableCoupon(c echo.Context) error {
@@ -36,14 +57,16 @@ func (h cartHandler) ApplicableCoupon(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
 	}
 
-	pricedItems := make([]PricedItem, 0, len(req.Items))
-	for _, item := range req.Items {
-		price, err := getProductPrice(item.ProductID)
-		if err != nil {
-			slog.Error("applicable coupon get product price", slog.Any("err", err))
-			return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
-		}
-		pricedItems = append(pricedItems, item.ToPricedItem(price))
+	pricedItems, err := h.priceItems(req.Items, req.GetCurrency())
+	if err != nil {
+		slog.Error("applicable coupon get product price", slog.Any("err", err))
+		return c.JSON(productErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	cust, err := h.customerOf(req.CustomerID)
+	if err != nil {
+		slog.Error("applicable coupon get customer", slog.Any("err", err))
+		return c.JSON(customerErrorStatus(err), utils.GenericFailure(err))
 	}
 
 	coupons, err := h.Repo.GetAllCoupons()
@@ -52,7 +75,24 @@ func (h cartHandler) ApplicableCoupon(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
 	}
 
-	response := GetAppliableCoupons(pricedItems, coupons)
+	coupons, usages, err := h.getUsages(coupons, req.CustomerID)
+	if err != nil {
+		slog.Error("applicable coupon get usage", slog.Any("err", err))
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+
+	now := h.Clock()
+	response := GetAppliableCoupons(pricedItems, coupons, now, usages, cust, h.Rounding)
+	// the near misses change the shape of the response, so they are only given when asked for
+	if c.QueryParam("near_misses") == "true" {
+		if response == nil {
+			response = []DiscountCoupon{}
+		}
+		return c.JSON(http.StatusOK, utils.GenericSuccess(ApplicableCoupons{
+			Coupons:    response,
+			NearMisses: NearMisses(pricedItems, coupons, now, usages, cust, h.Rounding, h.productPricer(req.GetCurrency())),
+		}))
+	}
 	if len(response) == 0 {
 		return c.JSON(http.StatusOK, utils.GenericSuccess("Sorry! No coupons are available for you"))
 	}
@@ -84,16 +124,345 @@ func (h cartHandler) ApplyCoupon(c echo.Context) error {
 		}
 		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
 	}
-	pricedItems := make([]PricedItem, 0, len(req.Items))
-	for _, item := range req.Items {
-		price, err := getProductPrice(item.ProductID)
+	if couponByID.RequiresCode {
+		slog.Error("apply coupon by id requires code", slog.Int("id", id))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(coupon.ErrCodeRequired))
+	}
+	return h.applyCoupon(c, req, couponByID, "")
+}
+
+// EvaluateCoupon explains whether the coupon is applicable to the cart, and why not
+// nothing is redeemed, so a coupon which requires a code can be evaluated by its id
+func (h cartHandler) EvaluateCoupon(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	var req Cart
+	if err := c.Bind(&req); err != nil {
+		slog.Error("evaluate coupon bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("evaluate coupon validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	couponByID, err := h.Repo.GetCouponByID(id)
+	if err != nil {
+		slog.Error("evaluate coupon by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, coupon.ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+
+	pricedItems, err := h.priceItems(req.Items, req.GetCurrency())
+	if err != nil {
+		slog.Error("evaluate coupon get product price", slog.Any("err", err))
+		return c.JSON(productErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	cust, err := h.customerOf(req.CustomerID)
+	if err != nil {
+		slog.Error("evaluate coupon get customer", slog.Any("err", err), slog.Int("id", id))
+		return c.JSON(customerErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	usage, err := h.Repo.GetUsage(couponByID.ID, req.CustomerID)
+	if err != nil {
+		slog.Error("evaluate coupon get usage", slog.Any("err", err), slog.Int("id", id))
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+
+	return c.JSON(http.StatusOK, utils.GenericSuccess(EvaluateCoupon(pricedItems, couponByID, h.Clock(), usage, cust, h.Rounding)))
+}
+
+// ApplyCouponByCode behaves like ApplyCoupon, but the coupon is found by its case-insensitive code
+// the code can be either the code of the coupon or one of its single use codes
+func (h cartHandler) ApplyCouponByCode(c echo.Context) error {
+	code := c.Param("code")
+
+	var req Cart
+	if err := c.Bind(&req); err != nil {
+		slog.Error("apply coupon by code bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("apply coupon by code validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	code = coupon.NormalizeCode(code)
+	couponByCode, err := h.Repo.GetCouponByCode(code)
+	if errors.Is(err, coupon.ErrDoesNotExist) {
+		couponByCode, err = h.couponBySingleUseCode(code)
+	}
+	if err != nil {
+		slog.Error("apply coupon by code db", slog.Any("err", err), slog.String("code", code))
+		if errors.Is(err, coupon.ErrDoesNotExist) || errors.Is(err, coupon.ErrCodeRedeemed) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return h.applyCoupon(c, req, couponByCode, code)
+}
+
+// couponBySingleUseCode returns the coupon of the single use code if the code is not redeemed yet
+func (h cartHandler) couponBySingleUseCode(code string) (coupon.Coupon, error) {
+	singleUse, err := h.Repo.GetCouponCode(code)
+	if err != nil {
+		return coupon.Coupon{}, err
+	}
+	if singleUse.IsRedeemed() {
+		return coupon.Coupon{}, fmt.Errorf("%w: %q", coupon.ErrCodeRedeemed, code)
+	}
+	return h.Repo.GetCouponByID(singleUse.CouponID)
+}
+
+// applyCoupon prices the cart, applies the coupon and records the redemption with the code it was applied with
+func (h cartHandler) applyCoupon(c echo.Context, req Cart, coup coupon.Coupon, code string) error {
+	pricedItems, err := h.priceItems(req.Items, req.GetCurrency())
+	if err != nil {
+		slog.Error("apply coupon get product price", slog.Any("err", err))
+		return c.JSON(productErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	cust, err := h.customerOf(req.CustomerID)
+	if err != nil {
+		slog.Error("apply coupon get customer", slog.Any("err", err), slog.Int("id", coup.ID))
+		return c.JSON(customerErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	usage, err := h.Repo.GetUsage(coup.ID, req.CustomerID)
+	if err != nil {
+		slog.Error("apply coupon get usage", slog.Any("err", err), slog.Int("id", coup.ID))
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+
+	now := h.Clock()
+	discountedCart, err := ApplyCoupon(pricedItems, coup, now, usage, cust, h.Rounding)
+	if err != nil {
+		slog.Error("apply coupon", slog.Any("err", err), slog.Int("id", coup.ID))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	// a coupon which did not give any discount is not counted as used
+	if !discountedCart.TotalDiscount.IsZero() {
+		err = h.Repo.RecordRedemption(coupon.Redemption{
+			CouponID:   coup.ID,
+			CustomerID: req.CustomerID,
+			CartTotal:  int(discountedCart.TotalPrice.Amount),
+			Discount:   int(discountedCart.TotalDiscount.Amount),
+			Code:       code,
+			RedeemedAt: now,
+			Currency:   discountedCart.Currency,
+		})
 		if err != nil {
-			slog.Error("applicable coupon get product price", slog.Any("err", err))
-			return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+			slog.Error("apply coupon record redemption", slog.Any("err", err), slog.Int("id", coup.ID))
+			return c.JSON(redemptionErrorStatus(err), utils.GenericFailure(err))
 		}
-		pricedItems = append(pricedItems, item.ToPricedItem(price))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(discountedCart))
+}
+
+// ApplyCoupons applies the best combination of the given coupons, or of all the coupons for "auto"
+// every coupon of the combination is recorded as a redemption
+// a given coupon which can not be applied to the cart fails the request with the ids of all such coupons
+func (h cartHandler) ApplyCoupons(c echo.Context) error {
+	var req StackCart
+	if err := c.Bind(&req); err != nil {
+		slog.Error("apply coupons bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("apply coupons validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	coupons, err := h.selectCoupons(req.Coupons)
+	if err != nil {
+		slog.Error("apply coupons get coupons", slog.Any("err", err))
+		if errors.Is(err, coupon.ErrDoesNotExist) || errors.Is(err, coupon.ErrCodeRequired) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
 	}
 
-	discountedCart := ApplyCoupon(pricedItems, couponByID)
+	pricedItems, err := h.priceItems(req.Items, req.GetCurrency())
+	if err != nil {
+		slog.Error("apply coupons get product price", slog.Any("err", err))
+		return c.JSON(productErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	cust, err := h.customerOf(req.CustomerID)
+	if err != nil {
+		slog.Error("apply coupons get customer", slog.Any("err", err))
+		return c.JSON(customerErrorStatus(err), utils.GenericFailure(err))
+	}
+
+	coupons, usages, err := h.getUsages(coupons, req.CustomerID)
+	if err != nil {
+		slog.Error("apply coupons get usage", slog.Any("err", err))
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+
+	now := h.Clock()
+	discountedCart, rejected := ApplyCoupons(pricedItems, coupons, now, usages, cust, h.Rounding)
+	// the given coupons have to apply, only "auto" leaves out the ones which do not
+	if !req.Coupons.Auto {
+		for _, id := range req.Coupons.IDs {
+			if _, ok := usages[id]; !ok {
+				rejected = append(rejected, id) // deleted since it was read
+			}
+		}
+		if len(rejected) > 0 {
+			slices.Sort(rejected)
+			err := fmt.Errorf("%w: coupons %v can not be applied to the cart", errCouponsNotApplicable, rejected)
+			slog.Error("apply coupons rejected coupons", slog.Any("err", err))
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+	}
+
+	// the redemptions are recorded all or none, so a coupon used up by a concurrent request
+	// does not consume the other coupons of the combination
+	redemptions := make([]coupon.Redemption, 0, len(discountedCart.Coupons))
+	for _, applied := range discountedCart.Coupons {
+		redemptions = append(redemptions, coupon.Redemption{
+			CouponID:   applied.CouponID,
+			CustomerID: req.CustomerID,
+			CartTotal:  int(discountedCart.TotalPrice.Amount),
+			Discount:   int(applied.Discount.Amount),
+			RedeemedAt: now,
+			Currency:   discountedCart.Currency,
+		})
+	}
+	if len(redemptions) > 0 {
+		if err := h.Repo.RecordRedemptions(redemptions); err != nil {
+			slog.Error("apply coupons record redemptions", slog.Any("err", err))
+			return c.JSON(redemptionErrorStatus(err), utils.GenericFailure(err))
+		}
+	}
 	return c.JSON(http.StatusOK, utils.GenericSuccess(discountedCart))
 }
+
+// selectCoupons returns the coupons which can be applied without a code for "auto"
+// or the coupons of the given ids
+func (h cartHandler) selectCoupons(selection CouponSelection) ([]coupon.Coupon, error) {
+	if selection.Auto {
+		coupons, err := h.Repo.GetAllCoupons()
+		if err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(coupons, func(coup coupon.Coupon) bool { return coup.RequiresCode }), nil
+	}
+
+	coupons := make([]coupon.Coupon, 0, len(selection.IDs))
+	for _, id := range selection.IDs {
+		coup, err := h.Repo.GetCouponByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if coup.RequiresCode {
+			return nil, fmt.Errorf("%w: coupon %d", coupon.ErrCodeRequired, id)
+		}
+		coupons = append(coupons, coup)
+	}
+	return coupons, nil
+}
+
+// priceItems prices the items of the cart from the catalog in the currency of the cart
+// only active products which are sold in the currency can be in the cart
+func (h cartHandler) priceItems(items []Item, currency money.Currency) ([]PricedItem, error) {
+	pricedItems := make([]PricedItem, 0, len(items))
+	for _, item := range items {
+		product, err := h.Products.GetProductByID(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if !product.Active {
+			return nil, fmt.Errorf("%w: product %d", catalog.ErrProductInactive, product.ID)
+		}
+		pricedItem, err := item.ToPricedItem(product, currency)
+		if err != nil {
+			return nil, err
+		}
+		pricedItems = append(pricedItems, pricedItem)
+	}
+	return pricedItems, nil
+}
+
+// productPricer prices the active products of the catalog in the currency
+func (h cartHandler) productPricer(currency money.Currency) ProductPricer {
+	return func(productID int) (PricedItem, error) {
+		items, err := h.priceItems([]Item{{ProductID: productID}}, currency)
+		if err != nil {
+			return PricedItem{}, err
+		}
+		return items[0], nil
+	}
+}
+
+// productErrorStatus is the status for the error of pricing the items
+// the products which are missing, inactive or not sold in the currency are the mistake of the client
+func productErrorStatus(err error) int {
+	if errors.Is(err, catalog.ErrDoesNotExist) || errors.Is(err, catalog.ErrProductInactive) ||
+		errors.Is(err, catalog.ErrPriceUnavailable) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// customerOf returns the customer of the cart, nil for an anonymous cart
+func (h cartHandler) customerOf(customerID int) (*customer.Customer, error) {
+	if customerID == 0 {
+		return nil, nil
+	}
+	cust, err := h.Customers.GetCustomerByID(customerID)
+	if err != nil {
+		return nil, err
+	}
+	return &cust, nil
+}
+
+// customerErrorStatus is the status for the error of getting the customer of the cart
+// a cart of an unknown customer is the mistake of the client
+func customerErrorStatus(err error) int {
+	if errors.Is(err, customer.ErrDoesNotExist) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// getUsages returns the coupons along with the map of couponID -> usage of the coupons by the customer
+// the usages are read at once, a coupon deleted since it was read is left out of both
+func (h cartHandler) getUsages(coupons []coupon.Coupon, customerID int) ([]coupon.Coupon, map[int]coupon.Usage, error) {
+	ids := make([]int, len(coupons))
+	for i, coup := range coupons {
+		ids[i] = coup.ID
+	}
+	usages, err := h.Repo.GetUsages(ids, customerID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("usage of coupons: %w", err)
+	}
+	coupons = slices.DeleteFunc(coupons, func(coup coupon.Coupon) bool {
+		_, ok := usages[coup.ID]
+		return !ok
+	})
+	return coupons, usages, nil
+}
+
+// redemptionErrorStatus is the status for the error of recording a redemption
+// the coupon or code can be used up by a concurrent request after the usage was checked
+func redemptionErrorStatus(err error) int {
+	if errors.Is(err, coupon.ErrUsageExhausted) || errors.Is(err, coupon.ErrCustomerRequired) ||
+		errors.Is(err, coupon.ErrCodeRedeemed) || errors.Is(err, coupon.ErrDoesNotExist) ||
+		errors.Is(err, coupon.ErrNotFirstOrder) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
 	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
 )
 
 var errInvalidQuantity = errors.New("invalid quantity")
@@ -15,28 +17,44 @@ type Item struct {
 	Quantity  int `json:"quantity"`
 }
 
+// PricedItem is the item with the details of the product from the catalog
 type PricedItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
-	Price     int `json:"price"`
+	ProductID int         `json:"product_id"`
+	Quantity  int         `json:"quantity"`
+	Price     money.Money `json:"price"`
+	Category  string      `json:"category,omitempty"`
+	Brand     string      `json:"brand,omitempty"`
 }
 
-func (i Item) ToPricedItem(price int) PricedItem {
+// ToPricedItem prices the item with the catalog price in the currency
+// It will return catalog.ErrPriceUnavailable if the product is not sold in the currency
+func (i Item) ToPricedItem(product catalog.Product, currency money.Currency) (PricedItem, error) {
+	price, ok := product.PriceIn(currency)
+	if !ok {
+		return PricedItem{}, fmt.Errorf("%w: product %d in %s", catalog.ErrPriceUnavailable, product.ID, currency)
+	}
 	return PricedItem{
 		ProductID: i.ProductID,
 		Quantity:  i.Quantity,
 		Price:     price,
-	}
+		Category:  product.Category,
+		Brand:     product.Brand,
+	}, nil
+}
+
+// Amount is the price of the whole quantity
+func (i PricedItem) Amount() money.Money {
+	return i.Price.Mul(i.Quantity)
 }
 
 type DiscountedItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
-	Price     int `json:"price"`
-	Discount  int `json:"discount"`
+	ProductID int         `json:"product_id"`
+	Quantity  int         `json:"quantity"`
+	Price     money.Money `json:"price"`
+	Discount  money.Money `json:"discount"`
 }
 
-func (i Item) ToDiscountedItem(price, discount int) DiscountedItem {
+func (i Item) ToDiscountedItem(price, discount money.Money) DiscountedItem {
 	return DiscountedItem{
 		ProductID: i.ProductID,
 		Quantity:  i.Quantity,
@@ -45,7 +63,7 @@ func (i Item) ToDiscountedItem(price, discount int) DiscountedItem {
 	}
 }
 
-func (i PricedItem) ToDiscountedItem(discount int) DiscountedItem {
+func (i PricedItem) ToDiscountedItem(discount money.Money) DiscountedItem {
 	return DiscountedItem{
 		ProductID: i.ProductID,
 		Quantity:  i.Quantity,
@@ -57,26 +75,55 @@ func (i PricedItem) ToDiscountedItem(discount int) DiscountedItem {
 type DiscountCoupon struct {
 	CouponID int               `json:"coupon_id"`
 	Type     coupon.CouponType `json:"type"`
-	Discount int               `json:"discount"`
+	Discount money.Money       `json:"discount"`
+	Currency money.Currency    `json:"currency"`
+	// RemainingUses is nil for coupons without usage limit
+	RemainingUses *int `json:"remaining_uses,omitempty"`
+	// Tier is the applied tier of the volume tier coupon
+	Tier *coupon.VolumeTier `json:"tier,omitempty"`
 }
 
 type Cart struct {
-	Items []Item `json:"items"`
+	// CustomerID is optional, zero means an anonymous customer
+	CustomerID int `json:"customer_id,omitempty"`
+	// Currency is optional and case-insensitive, the cart is in money.DefaultCurrency without it
+	Currency string `json:"currency,omitempty"`
+	Items    []Item `json:"items"`
 }
 
 type DiscountedCart struct {
 	Items         []DiscountedItem `json:"items"`
-	TotalPrice    int              `json:"total_price"`
-	TotalDiscount int              `json:"total_discount"`
-	FinalPrice    int              `json:"final_price"`
+	TotalPrice    money.Money      `json:"total_price"`
+	TotalDiscount money.Money      `json:"total_discount"`
+	FinalPrice    money.Money      `json:"final_price"`
+	// Currency of all the amounts of the cart
+	Currency money.Currency `json:"currency"`
+	// Coupons is the breakdown of the discount by coupon when more than one coupon is applied
+	Coupons []DiscountCoupon `json:"coupons,omitempty"`
+	// Tier is the applied tier when a single volume tier coupon is applied
+	Tier *coupon.VolumeTier `json:"tier,omitempty"`
 }
 
-// Validate will check for >= 1 quantity
+// Validate will check for >= 1 quantity and the supported currency
 func (c Cart) Validate() error {
 	for _, item := range c.Items {
 		if item.Quantity < 1 {
 			return fmt.Errorf("%w: quantity should be positive", errInvalidQuantity)
 		}
 	}
+	if c.Currency != "" {
+		if _, err := money.ParseCurrency(c.Currency); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// GetCurrency returns the currency of the validated cart
+func (c Cart) GetCurrency() money.Currency {
+	if c.Currency == "" {
+		return money.DefaultCurrency
+	}
+	currency, _ := money.ParseCurrency(c.Currency)
+	return currency
+}
@@ -0,0 +1,172 @@
+package cart
+
+import (
+	"slices"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+// maxNearMissChanges is the most changes a coupon can be away from the cart to be a near miss
+const maxNearMissChanges = 3
+
+// CartChange is a single change which brings the cart closer to a coupon
+// it is either an amount to add, of any product or of the Brand, or the quantity of a product to add
+type CartChange struct {
+	AddAmount *money.Money `json:"add_amount,omitempty"`
+	Brand     string       `json:"brand,omitempty"`
+	ProductID int          `json:"product_id,omitempty"`
+	Quantity  int          `json:"quantity,omitempty"`
+}
+
+// NearMiss is a coupon which is not applicable to the cart yet, but would be with the changes
+type NearMiss struct {
+	CouponID int               `json:"coupon_id"`
+	Type     coupon.CouponType `json:"type"`
+	// Reason is why the coupon is not applicable to the cart as it is
+	Reason  *Reason      `json:"reason"`
+	Changes []CartChange `json:"changes"`
+	// Discount is the discount the changes unlock
+	Discount money.Money        `json:"discount"`
+	Currency money.Currency     `json:"currency"`
+	Tier     *coupon.VolumeTier `json:"tier,omitempty"`
+}
+
+// ApplicableCoupons is the applicable coupons along with the near misses
+type ApplicableCoupons struct {
+	Coupons    []DiscountCoupon `json:"coupons"`
+	NearMisses []NearMiss       `json:"near_misses"`
+}
+
+// ProductPricer prices a product of the catalog in the currency of the cart, the quantity is left zero
+type ProductPricer func(productID int) (PricedItem, error)
+
+// NearMisses returns the coupons which are not applicable only because of the contents of the cart
+// along with the smallest changes which make them applicable and the discount they unlock
+// a coupon which needs more than maxNearMissChanges changes, or a product the pricer fails for, is left out
+func NearMisses(items []PricedItem, coupons []coupon.Coupon, now time.Time, usages map[int]coupon.Usage, cust *customer.Customer, rounding money.Rounding, price ProductPricer) []NearMiss {
+	totalPrice := totalOf(items)
+	result := make([]NearMiss, 0)
+	for _, coup := range coupons {
+		usage := usages[coup.ID]
+		_, _, reason := evaluate(items, totalPrice, coup, now, usage, cust, rounding)
+		if reason == nil {
+			continue
+		}
+
+		simulated := slices.Clone(items)
+		changes := make([]CartChange, 0, maxNearMissChanges)
+		next := reason
+		for step := 0; next != nil && step < maxNearMissChanges; step++ {
+			var (
+				change CartChange
+				ok     bool
+			)
+			simulated, change, ok = fixReason(simulated, coup, next, price)
+			if !ok {
+				break
+			}
+			changes = mergeChange(changes, change)
+			discount, tier, nextReason := evaluate(simulated, totalOf(simulated), coup, now, usage, cust, rounding)
+			if nextReason == nil {
+				result = append(result, NearMiss{
+					CouponID: coup.ID,
+					Type:     coup.Type,
+					Reason:   reason,
+					Changes:  changes,
+					Discount: discount,
+					Currency: totalPrice.Currency,
+					Tier:     tier,
+				})
+			}
+			next = nextReason
+		}
+	}
+	return result
+}
+
+// fixReason returns the cart with the smallest change for the reason
+// It will return false for the reasons which are not about the contents of the cart
+// or which can not be fixed without knowing the catalog, e.g. no items of a category
+func fixReason(items []PricedItem, coup coupon.Coupon, reason *Reason, price ProductPricer) ([]PricedItem, CartChange, bool) {
+	switch reason.Code {
+	case ReasonThresholdNotMet:
+		// any product will do, the amount is added as an item which is not in the catalog
+		short := *reason.AmountShort
+		return append(items, PricedItem{Quantity: 1, Price: short}), CartChange{AddAmount: &short}, true
+	case ReasonMinSubtotalNotMet:
+		detail, ok := coup.Details.(coupon.BrandWiseDetails)
+		if !ok {
+			return items, CartChange{}, false
+		}
+		short := *reason.AmountShort
+		brand := detail.Brand
+		return append(items, PricedItem{Quantity: 1, Price: short, Brand: brand}), CartChange{AddAmount: &short, Brand: brand}, true
+	case ReasonProductNotInCart, ReasonMissingBuyProduct:
+		return addProduct(items, reason.ProductID, 1, price)
+	case ReasonBuyQuantityNotMet:
+		// every buy product counts towards the quantity, so the first one is suggested
+		detail, ok := coup.Details.(coupon.BxGyDetails)
+		if !ok || len(detail.BuyProducts) == 0 {
+			return items, CartChange{}, false
+		}
+		buy := detail.BuyProducts[0]
+		return addProduct(items, buy.ProductID, reason.QuantityShort, price)
+	case ReasonMissingGetProduct:
+		detail, ok := coup.Details.(coupon.BxGyDetails)
+		if !ok || len(detail.GetProducts) == 0 {
+			return items, CartChange{}, false
+		}
+		get := detail.GetProducts[0]
+		return addProduct(items, get.ProductID, get.Quantity, price)
+	case ReasonQuantityNotMet:
+		productID := reason.ProductID
+		if productID == 0 {
+			// the category tier counts every item of the category, one already in the cart is suggested
+			detail, ok := coup.Details.(coupon.VolumeTierDetails)
+			if !ok {
+				return items, CartChange{}, false
+			}
+			category := detail.Category
+			i := slices.IndexFunc(items, func(item PricedItem) bool { return matchesCategory(item, category) })
+			if i == -1 {
+				return items, CartChange{}, false
+			}
+			productID = items[i].ProductID
+		}
+		return addProduct(items, productID, reason.QuantityShort, price)
+	default:
+		return items, CartChange{}, false
+	}
+}
+
+// addProduct adds the quantity of the product to the cart, to its item if the product is already in the cart
+func addProduct(items []PricedItem, productID, quantity int, price ProductPricer) ([]PricedItem, CartChange, bool) {
+	change := CartChange{ProductID: productID, Quantity: quantity}
+	i := slices.IndexFunc(items, func(item PricedItem) bool { return item.ProductID == productID })
+	if i != -1 {
+		items = slices.Clone(items)
+		items[i].Quantity += quantity
+		return items, change, true
+	}
+	item, err := price(productID)
+	if err != nil {
+		return items, CartChange{}, false
+	}
+	item.Quantity = quantity
+	return append(items, item), change, true
+}
+
+// mergeChange adds the change to the changes, the quantities of the same product are added up
+func mergeChange(changes []CartChange, change CartChange) []CartChange {
+	if change.ProductID != 0 {
+		i := slices.IndexFunc(changes, func(c CartChange) bool { return c.ProductID == change.ProductID })
+		if i != -1 {
+			changes[i].Quantity += change.Quantity
+			return changes
+		}
+	}
+	return append(changes, change)
+}
@@ -0,0 +1,132 @@
+package cart
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+func TestNearMisses(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	short := func(amount int64) *money.Money {
+		m := inr(amount)
+		return &m
+	}
+	// the catalog has the products 1 to 9, the price of each product is id * 10
+	price := func(productID int) (PricedItem, error) {
+		if productID < 1 || productID > 9 {
+			return PricedItem{}, fmt.Errorf("%w: no product with id %d", catalog.ErrDoesNotExist, productID)
+		}
+		return PricedItem{ProductID: productID, Price: inr(int64(productID * 10)), Category: "general", Brand: "acme"}, nil
+	}
+
+	items := []PricedItem{
+		{ProductID: 3, Quantity: 2, Price: inr(30), Category: "general", Brand: "acme"},
+		{ProductID: 4, Quantity: 1, Price: inr(40), Category: "general", Brand: "acme"},
+	}
+	tests := []struct {
+		name     string
+		coupon   coupon.Coupon
+		expected []NearMiss
+	}{
+		{
+			name:   "Threshold",
+			coupon: coupon.Coupon{ID: 1, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 220, Discount: 10}},
+			expected: []NearMiss{{
+				CouponID: 1, Type: "cart-wise",
+				Reason:   &Reason{Code: ReasonThresholdNotMet, Message: "cart total 100 is below the threshold 220, short by 120", AmountShort: short(120)},
+				Changes:  []CartChange{{AddAmount: short(120)}},
+				Discount: inr(22), Currency: money.INR,
+			}},
+		},
+		{
+			name:   "Product",
+			coupon: coupon.Coupon{ID: 2, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 5, Discount: 20}},
+			expected: []NearMiss{{
+				CouponID: 2, Type: "product-wise",
+				Reason:   &Reason{Code: ReasonProductNotInCart, Message: "product 5 is not in the cart", ProductID: 5},
+				Changes:  []CartChange{{ProductID: 5, Quantity: 1}},
+				Discount: inr(10), Currency: money.INR,
+			}},
+		},
+		{
+			name: "One more of the buy product for the get product",
+			coupon: coupon.Coupon{ID: 3, Type: "bxgy", Details: coupon.BxGyDetails{
+				BuyProducts:     []coupon.CouponProduct{{ProductID: 3, Quantity: 3}},
+				GetProducts:     []coupon.CouponProduct{{ProductID: 5, Quantity: 1}},
+				RepetitionLimit: 1,
+			}},
+			expected: []NearMiss{{
+				CouponID: 3, Type: "bxgy",
+				Reason:   &Reason{Code: ReasonBuyQuantityNotMet, Message: "cart has 2 of the 3 buy products required", QuantityShort: 1},
+				Changes:  []CartChange{{ProductID: 3, Quantity: 1}, {ProductID: 5, Quantity: 1}},
+				Discount: inr(50), Currency: money.INR,
+			}},
+		},
+		{
+			name:   "Volume tier",
+			coupon: coupon.Coupon{ID: 4, Type: "volume-tier", Details: coupon.VolumeTierDetails{Category: "general", Tiers: []coupon.VolumeTier{{MinQuantity: 5, Discount: 10}}}},
+			expected: []NearMiss{{
+				CouponID: 4, Type: "volume-tier",
+				Reason:   &Reason{Code: ReasonQuantityNotMet, Message: "cart has 3 of the 5 units of the first tier", QuantityShort: 2},
+				Changes:  []CartChange{{ProductID: 3, Quantity: 2}},
+				Discount: inr(16), Currency: money.INR,
+				Tier: &coupon.VolumeTier{MinQuantity: 5, Discount: 10},
+			}},
+		},
+		{
+			name:   "Brand min subtotal",
+			coupon: coupon.Coupon{ID: 5, Type: "brand-wise", Details: coupon.BrandWiseDetails{Brand: "Acme", Discount: 10, MinSubtotal: 150}},
+			expected: []NearMiss{{
+				CouponID: 5, Type: "brand-wise",
+				Reason:   &Reason{Code: ReasonMinSubtotalNotMet, Message: "subtotal 100 of the Acme items is below the min subtotal 150, short by 50", AmountShort: short(50)},
+				Changes:  []CartChange{{AddAmount: short(50), Brand: "Acme"}},
+				Discount: inr(15), Currency: money.INR,
+			}},
+		},
+		{
+			name:     "Applicable is not a near miss",
+			coupon:   coupon.Coupon{ID: 6, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 50, Discount: 10}},
+			expected: []NearMiss{},
+		},
+		{
+			name:     "Expired is not a near miss",
+			coupon:   coupon.Coupon{ID: 7, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 220, Discount: 10}, EndsAt: &past},
+			expected: []NearMiss{},
+		},
+		{
+			name:     "Product which is not in the catalog",
+			coupon:   coupon.Coupon{ID: 8, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 42, Discount: 20}},
+			expected: []NearMiss{},
+		},
+		{
+			name:     "No item of the category",
+			coupon:   coupon.Coupon{ID: 9, Type: "category-wise", Details: coupon.CategoryWiseDetails{Category: "toys", Discount: 20}},
+			expected: []NearMiss{},
+		},
+		{
+			name: "Too many changes",
+			coupon: coupon.Coupon{ID: 10, Type: "bxgy", Details: coupon.BxGyDetails{
+				BuyProducts:     []coupon.CouponProduct{{ProductID: 6, Quantity: 1}, {ProductID: 7, Quantity: 1}, {ProductID: 8, Quantity: 1}},
+				GetProducts:     []coupon.CouponProduct{{ProductID: 9, Quantity: 1}},
+				RepetitionLimit: 1,
+			}},
+			expected: []NearMiss{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := NearMisses(items, []coupon.Coupon{tc.coupon}, now, nil, nil, money.Floor, price)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("NearMisses() = %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -2,20 +2,16 @@
 package cart
 
 import (
-	"errors"
-	"fmt"
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
 )
 
-var errInvalidProductID = errors.New("invalid product id")
-
-// getProductPrice: This would act as our db layer for product metadata
-// We are assuming that we will have unlimited quantity, so user can specify
-// but we only have 10 products from id 1 to 10
-// and price of each product is productID * 10
-func getProductPrice(productID int) (int, error) {
-	if productID < 1 || productID > 10 {
-		return 0, fmt.Errorf("%w: invalid id %d", errInvalidProductID, productID)
-	}
+// ProductRepository gives the products in the cart from the catalog
+type ProductRepository interface {
+	GetProductByID(id int) (catalog.Product, error)
+}
 
-	return productID * 10, nil
+// CustomerRepository gives the customer of the cart
+type CustomerRepository interface {
+	GetCustomerByID(id int) (customer.Customer, error)
 }
@@ -0,0 +1,241 @@
+package cart
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+const (
+	// MaxStackedCoupons is the maximum number of coupon ids in a single apply coupons request
+	MaxStackedCoupons = 10
+	// maxCandidates bounds the search, every subset of the stackable candidates is tried
+	// with each of the other candidates, so the search is at most 2^maxCandidates combinations
+	maxCandidates = 10
+)
+
+var (
+	errInvalidSelection     = errors.New("invalid coupon selection")
+	errCouponsNotApplicable = errors.New("coupons not applicable")
+)
+
+// CouponSelection is either the list of coupon ids or "auto" for all the coupons
+type CouponSelection struct {
+	Auto bool
+	IDs  []int
+}
+
+// UnmarshalJSON accepts either "auto" or the list of coupon ids
+func (s *CouponSelection) UnmarshalJSON(data []byte) error {
+	var auto string
+	if err := json.Unmarshal(data, &auto); err == nil {
+		if auto != "auto" {
+			return fmt.Errorf("%w: coupons must be a list of ids or \"auto\"", errInvalidSelection)
+		}
+		*s = CouponSelection{Auto: true}
+		return nil
+	}
+
+	var ids []int
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return fmt.Errorf("%w: coupons must be a list of ids or \"auto\"", errInvalidSelection)
+	}
+	*s = CouponSelection{IDs: ids}
+	return nil
+}
+
+// StackCart is the cart with the coupons to choose the best combination from
+type StackCart struct {
+	Cart
+	Coupons CouponSelection `json:"coupons"`
+}
+
+// Validate the cart and the selected coupon ids
+func (c StackCart) Validate() error {
+	if err := c.Cart.Validate(); err != nil {
+		return err
+	}
+	if c.Coupons.Auto {
+		return nil
+	}
+	if len(c.Coupons.IDs) == 0 {
+		return fmt.Errorf("%w: coupons is required field", errInvalidSelection)
+	}
+	if len(c.Coupons.IDs) > MaxStackedCoupons {
+		return fmt.Errorf("%w: at most %d coupons can be applied together", errInvalidSelection, MaxStackedCoupons)
+	}
+	for i, id := range c.Coupons.IDs {
+		if slices.Index(c.Coupons.IDs, id) != i {
+			return fmt.Errorf("%w: coupon %d is given more than once", errInvalidSelection, id)
+		}
+	}
+	return nil
+}
+
+// ApplyCoupons will apply the combination of the coupons with the highest total discount
+// coupons outside their validity window at now, without remaining uses
+// or not valid in the currency of the cart are left out, so are the coupons of an unknown type,
+// the first order coupons the customer is not eligible for, the coupons whose conditions or expression the cart does not meet
+// and the coupons without any discount on the cart, the ids of the left out coupons are returned sorted
+// only the maxCandidates coupons with the highest discount on their own are searched
+// on a tie the combination with fewer coupons wins
+// the applied coupons and their discounts are in the Coupons of the discounted cart
+// the percentage discounts are rounded to the minor unit with the rounding
+func ApplyCoupons(items []PricedItem, coupons []coupon.Coupon, now time.Time, usages map[int]coupon.Usage, cust *customer.Customer, rounding money.Rounding) (DiscountedCart, []int) {
+	candidates := make([]coupon.Coupon, 0, len(coupons))
+	standalone := make(map[int]money.Money, len(coupons)) // map of couponID -> discount when applied alone
+	var rejected []int
+	totalPrice := totalOf(items)
+	for _, coup := range coupons {
+		discount, ok := standaloneDiscount(items, totalPrice, coup, now, usages[coup.ID], cust, rounding)
+		if !ok {
+			rejected = append(rejected, coup.ID)
+			continue
+		}
+		standalone[coup.ID] = discount
+		candidates = append(candidates, coup)
+	}
+	slices.Sort(rejected)
+	if len(candidates) > maxCandidates {
+		slices.SortStableFunc(candidates, func(a, b coupon.Coupon) int {
+			return cmp.Or(standalone[b.ID].Cmp(standalone[a.ID]), a.ID-b.ID)
+		})
+		candidates = candidates[:maxCandidates]
+	}
+	// the search keeps the first of the equally good combinations, so the order has to be stable
+	slices.SortFunc(candidates, func(a, b coupon.Coupon) int { return a.ID - b.ID })
+	return bestStack(items, candidates, rounding), rejected
+}
+
+// standaloneDiscount returns the discount of the coupon applied alone
+// the bool is false if the coupon can not be applied to the cart or does not give any discount,
+// a coupon without discount on its own can not add discount to a combination either
+func standaloneDiscount(items []PricedItem, totalPrice money.Money, coup coupon.Coupon, now time.Time, usage coupon.Usage, cust *customer.Customer, rounding money.Rounding) (money.Money, bool) {
+	if !coup.IsActiveAt(now) || coup.CheckUsage(usage) != nil || !coup.AppliesIn(totalPrice.Currency) {
+		return money.Money{}, false
+	}
+	if checkFirstOrder(coup, usage, cust) != nil || checkConditions(items, totalPrice, coup, now, cust) != nil {
+		return money.Money{}, false
+	}
+	if _, err := calculatorFor(coup); err != nil {
+		return money.Money{}, false
+	}
+	discount := applyStack(items, []coupon.Coupon{coup}, rounding).TotalDiscount
+	return discount, !discount.IsZero()
+}
+
+// bestStack tries every allowed combination of the candidates
+// an exclusive coupon is only tried alone, and a combination has at most one coupon which is not stackable
+func bestStack(items []PricedItem, candidates []coupon.Coupon, rounding money.Rounding) DiscountedCart {
+	var exclusive, single, stackable []coupon.Coupon
+	for _, coup := range candidates {
+		switch {
+		case coup.Exclusive:
+			exclusive = append(exclusive, coup)
+		case coup.Stackable:
+			stackable = append(stackable, coup)
+		default:
+			single = append(single, coup)
+		}
+	}
+
+	best := applyStack(items, nil, rounding)
+	consider := func(stack []coupon.Coupon) {
+		discounted := applyStack(items, stack, rounding)
+		order := discounted.TotalDiscount.Cmp(best.TotalDiscount)
+		if order > 0 || (order == 0 && len(discounted.Coupons) < len(best.Coupons)) {
+			best = discounted
+		}
+	}
+
+	for _, coup := range exclusive {
+		consider([]coupon.Coupon{coup})
+	}
+	stack := make([]coupon.Coupon, 0, len(stackable)+1)
+	for mask := 0; mask < 1<<len(stackable); mask++ {
+		stack = stack[:0]
+		for i, coup := range stackable {
+			if mask&(1<<i) != 0 {
+				stack = append(stack, coup)
+			}
+		}
+		consider(stack)
+		for _, coup := range single {
+			consider(append(stack, coup))
+		}
+	}
+	return best
+}
+
+// couponLevel orders the coupons of a combination by the Level of their calculator, the product level coupons
+// are applied before the cart level ones so the cart wise discount is on the already discounted price
+func couponLevel(coup coupon.Coupon) int {
+	calc, err := calculatorFor(coup)
+	if err != nil {
+		return 0
+	}
+	return calc.Level
+}
+
+// applyStack applies the coupons one after the other, each on the remaining price
+// the cart level discounts are prorated across the items by their remaining price
+// an item is never discounted below zero, coupons without any discount or calculator are left out of Coupons
+func applyStack(items []PricedItem, stack []coupon.Coupon, rounding money.Rounding) DiscountedCart {
+	ordered := slices.Clone(stack)
+	slices.SortStableFunc(ordered, func(a, b coupon.Coupon) int {
+		return cmp.Or(couponLevel(a)-couponLevel(b), a.ID-b.ID)
+	})
+
+	totalPrice := totalOf(items)
+	noDiscount := money.Zero(totalPrice.Currency)
+
+	totalDiscount := noDiscount
+	itemDiscounts := make([]money.Money, len(items))
+	for i := range itemDiscounts {
+		itemDiscounts[i] = noDiscount
+	}
+	// remaining is the price of every item after the coupons applied so far
+	remaining := func() []money.Money {
+		amounts := make([]money.Money, len(items))
+		for i, item := range items {
+			amounts[i] = item.Amount().Sub(itemDiscounts[i])
+		}
+		return amounts
+	}
+	applied := make([]DiscountCoupon, 0, len(ordered))
+	for _, coup := range ordered {
+		calc, err := calculatorFor(coup)
+		if err != nil {
+			continue
+		}
+		discount, shares, tier := calc.Stack(items, remaining(), coup, rounding)
+		for i, share := range shares {
+			itemDiscounts[i] = itemDiscounts[i].Add(share)
+		}
+		if discount.IsZero() {
+			continue
+		}
+		totalDiscount = totalDiscount.Add(discount)
+		applied = append(applied, DiscountCoupon{CouponID: coup.ID, Type: coup.Type, Discount: discount, Currency: totalPrice.Currency, Tier: tier})
+	}
+
+	discountedItems := make([]DiscountedItem, len(items))
+	for i, item := range items {
+		discountedItems[i] = item.ToDiscountedItem(itemDiscounts[i])
+	}
+	return DiscountedCart{
+		Items:         discountedItems,
+		TotalPrice:    totalPrice,
+		TotalDiscount: totalDiscount,
+		FinalPrice:    totalPrice.Sub(totalDiscount),
+		Currency:      totalPrice.Currency,
+		Coupons:       applied,
+	}
+}
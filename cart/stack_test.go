@@ -0,0 +1,418 @@
+package cart
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+func TestApplyCoupons(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+
+	items := []PricedItem{
+		{ProductID: 1, Quantity: 2, Price: inr(100)},
+		{ProductID: 2, Quantity: 1, Price: inr(50)},
+		{ProductID: 3, Quantity: 3, Price: inr(10)},
+	}
+	productTen := coupon.Coupon{ID: 1, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 10}, Stackable: true}
+	cartTen := coupon.Coupon{ID: 2, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 100, Discount: 10}}
+	bxgy := coupon.Coupon{ID: 3, Type: "bxgy", Details: coupon.BxGyDetails{
+		BuyProducts:     []coupon.CouponProduct{{ProductID: 1, Quantity: 2}},
+		GetProducts:     []coupon.CouponProduct{{ProductID: 3, Quantity: 1}},
+		RepetitionLimit: 1,
+	}}
+	exclusiveHalf := coupon.Coupon{ID: 4, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 0, Discount: 50}, Exclusive: true}
+	exclusiveTen := coupon.Coupon{ID: 5, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 0, Discount: 10}, Exclusive: true}
+
+	tests := []struct {
+		name             string
+		items            []PricedItem
+		coupons          []coupon.Coupon
+		usages           map[int]coupon.Usage
+		expected         DiscountedCart
+		expectedRejected []int
+	}{
+		{
+			name:    "Product level is applied before cart level",
+			items:   items,
+			coupons: []coupon.Coupon{cartTen, productTen},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(38)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(5)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(3)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(46),
+				FinalPrice:    inr(234),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 1, Type: "product-wise", Discount: inr(20), Currency: money.INR},
+					{CouponID: 2, Type: "cart-wise", Discount: inr(26), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:    "At most one coupon which is not stackable",
+			items:   items,
+			coupons: []coupon.Coupon{productTen, cartTen, bxgy},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(38)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(5)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(3)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(46),
+				FinalPrice:    inr(234),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 1, Type: "product-wise", Discount: inr(20), Currency: money.INR},
+					{CouponID: 2, Type: "cart-wise", Discount: inr(26), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:    "Exclusive coupon is applied alone",
+			items:   items,
+			coupons: []coupon.Coupon{productTen, cartTen, exclusiveHalf},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(100)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(25)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(15)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(140),
+				FinalPrice:    inr(140),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 4, Type: "cart-wise", Discount: inr(140), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:    "Combination beats the exclusive coupon",
+			items:   items,
+			coupons: []coupon.Coupon{exclusiveTen, productTen, bxgy},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(20)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(0)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(10)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(30),
+				FinalPrice:    inr(250),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 1, Type: "product-wise", Discount: inr(20), Currency: money.INR},
+					{CouponID: 3, Type: "bxgy", Discount: inr(10), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:  "Capped product level discount leaves more for the cart level",
+			items: items,
+			coupons: []coupon.Coupon{
+				cartTen,
+				{ID: 12, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 50, MaxDiscount: 30}, Stackable: true},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(47)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(5)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(3)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(55),
+				FinalPrice:    inr(225),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 12, Type: "product-wise", Discount: inr(30), Currency: money.INR},
+					{CouponID: 2, Type: "cart-wise", Discount: inr(25), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name: "Category level is applied on the remaining price",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 2, Price: inr(100), Category: "clothing"},
+				{ProductID: 2, Quantity: 1, Price: inr(50), Category: "clothing"},
+			},
+			coupons: []coupon.Coupon{
+				productTen,
+				{ID: 13, Type: "category-wise", Details: coupon.CategoryWiseDetails{Category: "clothing", Discount: 20}, Stackable: true},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(56)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(10)},
+				},
+				TotalPrice:    inr(250),
+				TotalDiscount: inr(66),
+				FinalPrice:    inr(184),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 1, Type: "product-wise", Discount: inr(20), Currency: money.INR},
+					{CouponID: 13, Type: "category-wise", Discount: inr(46), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name: "Brand level min subtotal is checked on the remaining price",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 2, Price: inr(100), Brand: "Dell"},
+				{ProductID: 2, Quantity: 1, Price: inr(50), Brand: "Dell"},
+			},
+			coupons: []coupon.Coupon{
+				productTen,
+				{ID: 14, Type: "brand-wise", Details: coupon.BrandWiseDetails{Brand: "dell", Discount: 20, MinSubtotal: 240}, Stackable: true},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(40)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(10)},
+				},
+				TotalPrice:    inr(250),
+				TotalDiscount: inr(50),
+				FinalPrice:    inr(200),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 14, Type: "brand-wise", Discount: inr(50), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name: "Volume tier is by quantity and discounts the remaining price",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 10, Price: inr(100)},
+			},
+			coupons: []coupon.Coupon{
+				productTen,
+				{ID: 15, Type: "volume-tier", Stackable: true, Details: coupon.VolumeTierDetails{
+					ProductID: 1,
+					Tiers:     []coupon.VolumeTier{{MinQuantity: 5, Discount: 10}, {MinQuantity: 10, Discount: 20}},
+				}},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 10, Price: inr(100), Discount: inr(280)},
+				},
+				TotalPrice:    inr(1000),
+				TotalDiscount: inr(280),
+				FinalPrice:    inr(720),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 1, Type: "product-wise", Discount: inr(100), Currency: money.INR},
+					{CouponID: 15, Type: "volume-tier", Discount: inr(180), Currency: money.INR, Tier: &coupon.VolumeTier{MinQuantity: 10, Discount: 20}},
+				},
+			},
+		},
+		{
+			name: "Fixed product discount is clamped to the remaining price",
+			items: []PricedItem{
+				{ProductID: 1, Quantity: 1, Price: inr(100)},
+			},
+			coupons: []coupon.Coupon{
+				{ID: 16, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 60, DiscountKind: coupon.DiscountFixed}, Stackable: true},
+				{ID: 18, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: 60, DiscountKind: coupon.DiscountFixed}, Stackable: true},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 1, Price: inr(100), Discount: inr(100)},
+				},
+				TotalPrice:    inr(100),
+				TotalDiscount: inr(100),
+				FinalPrice:    inr(0),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 16, Type: "product-wise", Discount: inr(60), Currency: money.INR},
+					{CouponID: 18, Type: "product-wise", Discount: inr(40), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:  "Item is not discounted below zero",
+			items: items,
+			coupons: []coupon.Coupon{
+				{ID: 6, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 2, Discount: 100}, Stackable: true},
+				{ID: 7, Type: "bxgy", Stackable: true, Details: coupon.BxGyDetails{
+					BuyProducts:     []coupon.CouponProduct{{ProductID: 1, Quantity: 1}},
+					GetProducts:     []coupon.CouponProduct{{ProductID: 2, Quantity: 1}},
+					RepetitionLimit: 1,
+				}},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(0)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(50)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(0)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(50),
+				FinalPrice:    inr(230),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 6, Type: "product-wise", Discount: inr(50), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:  "Inactive, used up and not appliable coupons are left out",
+			items: items,
+			coupons: []coupon.Coupon{
+				{ID: 8, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 0, Discount: 90}, EndsAt: &past},
+				{ID: 9, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 0, Discount: 90}, MaxTotalUses: 1},
+				{ID: 10, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 42, Discount: 90}, Stackable: true},
+				{ID: 11, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 1000, Discount: 90}},
+				{ID: 12, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 0, Discount: 90}, Currency: money.USD},
+				productTen,
+			},
+			usages:           map[int]coupon.Usage{9: {Total: 1}},
+			expectedRejected: []int{8, 9, 10, 11, 12},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(20)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(0)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(0)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(20),
+				FinalPrice:    inr(260),
+				Currency:      money.INR,
+				Coupons: []DiscountCoupon{
+					{CouponID: 1, Type: "product-wise", Discount: inr(20), Currency: money.INR},
+				},
+			},
+		},
+		{
+			name:  "No coupon gives a discount",
+			items: items,
+			coupons: []coupon.Coupon{
+				{ID: 11, Type: "cart-wise", Details: coupon.CartWiseDetails{Threshold: 1000, Discount: 90}},
+			},
+			expected: DiscountedCart{
+				Items: []DiscountedItem{
+					{ProductID: 1, Quantity: 2, Price: inr(100), Discount: inr(0)},
+					{ProductID: 2, Quantity: 1, Price: inr(50), Discount: inr(0)},
+					{ProductID: 3, Quantity: 3, Price: inr(10), Discount: inr(0)},
+				},
+				TotalPrice:    inr(280),
+				TotalDiscount: inr(0),
+				FinalPrice:    inr(280),
+				Currency:      money.INR,
+				Coupons:       []DiscountCoupon{},
+			},
+			expectedRejected: []int{11},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, rejected := ApplyCoupons(tc.items, tc.coupons, now, tc.usages, nil, money.Floor)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("ApplyCoupons() = %+v, want %+v", got, tc.expected)
+			}
+			if !reflect.DeepEqual(rejected, tc.expectedRejected) {
+				t.Errorf("ApplyCoupons() rejected = %v, want %v", rejected, tc.expectedRejected)
+			}
+		})
+	}
+}
+
+func TestApplyCouponsCandidateLimit(t *testing.T) {
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	items := []PricedItem{{ProductID: 1, Quantity: 1, Price: inr(10_000)}}
+	// more stackable and single coupons than the search can try, only the best ones on their own are searched
+	var coupons []coupon.Coupon
+	for i := 1; i <= 3*maxCandidates; i++ {
+		coupons = append(coupons,
+			coupon.Coupon{ID: i, Type: "product-wise", Details: coupon.ProductWiseDetails{ProductID: 1, Discount: i}, Stackable: true},
+			coupon.Coupon{ID: 100 + i, Type: "cart-wise", Details: coupon.CartWiseDetails{Discount: 1}},
+		)
+	}
+
+	got, rejected := ApplyCoupons(items, coupons, now, nil, nil, money.Floor)
+	if len(rejected) != 0 {
+		t.Errorf("ApplyCoupons() rejected = %v, want none", rejected)
+	}
+	applied := make([]int, 0, len(got.Coupons))
+	for _, c := range got.Coupons {
+		applied = append(applied, c.CouponID)
+	}
+	want := make([]int, 0, maxCandidates)
+	for i := 2*maxCandidates + 1; i <= 3*maxCandidates; i++ {
+		want = append(want, i)
+	}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("ApplyCoupons() coupons = %v, want %v", applied, want)
+	}
+}
+
+func TestStackCartValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expected    CouponSelection
+		expectedErr error
+	}{
+		{
+			name:     "Auto",
+			body:     `{"items": [{"product_id": 1, "quantity": 1}], "coupons": "auto"}`,
+			expected: CouponSelection{Auto: true},
+		},
+		{
+			name:     "List of ids",
+			body:     `{"items": [{"product_id": 1, "quantity": 1}], "coupons": [3, 1]}`,
+			expected: CouponSelection{IDs: []int{3, 1}},
+		},
+		{
+			name:        "Unknown keyword",
+			body:        `{"items": [], "coupons": "all"}`,
+			expectedErr: errInvalidSelection,
+		},
+		{
+			name:        "Missing coupons",
+			body:        `{"items": []}`,
+			expectedErr: errInvalidSelection,
+		},
+		{
+			name:        "Duplicate id",
+			body:        `{"items": [], "coupons": [1, 2, 1]}`,
+			expectedErr: errInvalidSelection,
+		},
+		{
+			name:        "Too many ids",
+			body:        `{"items": [], "coupons": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]}`,
+			expectedErr: errInvalidSelection,
+		},
+		{
+			name:        "Invalid quantity",
+			body:        `{"items": [{"product_id": 1, "quantity": 0}], "coupons": "auto"}`,
+			expectedErr: errInvalidQuantity,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var req StackCart
+			err := json.Unmarshal([]byte(tc.body), &req)
+			if err == nil {
+				err = req.Validate()
+			}
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tc.expectedErr)
+			}
+			if err == nil && !reflect.DeepEqual(req.Coupons, tc.expected) {
+				t.Errorf("Coupons = %+v, want %+v", req.Coupons, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package catalogtest is the conformance suite for the catalog.Repository implementations
+//
+// Every implementation should have a test calling RunRepositoryTests, run it with -race
+package catalogtest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/storetest"
+)
+
+// missingID is an ID no repository under test has a product for
+const missingID = 1_000_000
+
+// RunRepositoryTests runs the whole suite, newRepo must return a new repository on every call
+// the repository can have products already, e.g. the seeded ones, but none with the SKUs of the tests
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) catalog.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo catalog.Repository)
+	}{
+		{name: "crud", test: testCRUD},
+		{name: "round trip of all the fields", test: testRoundTrip},
+		{name: "unique case-insensitive skus", test: testSKUs},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+	storetest.RunIDTests(t, products, func(t *testing.T) storetest.Repository[catalog.Product] {
+		return storeRepository(newRepo(t))
+	})
+}
+
+// RunReopenTests checks that a persisted repository keeps the products, open must return the repository over dir
+func RunReopenTests(t *testing.T, open func(t *testing.T, dir string) catalog.Repository) {
+	storetest.RunReopenTests(t, products, func(t *testing.T, dir string) storetest.Repository[catalog.Product] {
+		return storeRepository(open(t, dir))
+	})
+}
+
+var products = storetest.Entity[catalog.Product]{
+	Name:            "product",
+	New:             func(i int) catalog.Product { return testProduct(fmt.Sprintf("ENTITY-%d", i), i) },
+	ID:              func(p catalog.Product) int { return p.ID },
+	ErrDoesNotExist: catalog.ErrDoesNotExist,
+}
+
+func storeRepository(repo catalog.Repository) storetest.Repository[catalog.Product] {
+	return storetest.Repository[catalog.Product]{
+		Create: repo.CreateProduct,
+		Get:    repo.GetProductByID,
+		Update: repo.UpdateProductByID,
+		Delete: repo.DeleteProductByID,
+	}
+}
+
+func testProduct(sku string, price int) catalog.Product {
+	return catalog.Product{SKU: sku, Name: "Test " + sku, Price: price, Category: "test", Brand: "acme", Active: true}
+}
+
+func mustCreate(t *testing.T, repo catalog.Repository, p catalog.Product) catalog.Product {
+	t.Helper()
+	created, err := repo.CreateProduct(p)
+	if err != nil {
+		t.Fatalf("CreateProduct() unexpected error: %v", err)
+	}
+	return created
+}
+
+func testCRUD(t *testing.T, repo catalog.Repository) {
+	first := mustCreate(t, repo, testProduct("CRUD-1", 100))
+	second := mustCreate(t, repo, testProduct("CRUD-2", 200))
+	if first.ID == second.ID {
+		t.Fatalf("CreateProduct() assigned the same id %d twice", first.ID)
+	}
+
+	got, err := repo.GetProductByID(first.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, first) {
+		t.Errorf("GetProductByID() = %+v, want %+v", got, first)
+	}
+
+	update := testProduct("CRUD-1", 150)
+	update.ID = missingID // the id of the path wins over the body
+	updated, err := repo.UpdateProductByID(first.ID, update)
+	if err != nil {
+		t.Fatalf("UpdateProductByID() unexpected error: %v", err)
+	}
+	if updated.ID != first.ID || updated.Price != 150 {
+		t.Errorf("UpdateProductByID() = %+v", updated)
+	}
+	if got, _ := repo.GetProductByID(first.ID); got.Price != 150 {
+		t.Errorf("GetProductByID() after update price = %d, want 150", got.Price)
+	}
+
+	all, err := repo.GetAllProducts()
+	if err != nil {
+		t.Fatalf("GetAllProducts() unexpected error: %v", err)
+	}
+	found := 0
+	for i, p := range all {
+		if i > 0 && all[i-1].ID >= p.ID {
+			t.Errorf("GetAllProducts() is not sorted by id: %+v", all)
+		}
+		if p.ID == first.ID || p.ID == second.ID {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("GetAllProducts() = %+v, want both created products", all)
+	}
+
+	if err := repo.DeleteProductByID(second.ID); err != nil {
+		t.Fatalf("DeleteProductByID() unexpected error: %v", err)
+	}
+	if _, err := repo.GetProductByID(second.ID); !errors.Is(err, catalog.ErrDoesNotExist) {
+		t.Errorf("GetProductByID() after delete error = %v, want %v", err, catalog.ErrDoesNotExist)
+	}
+}
+
+func testRoundTrip(t *testing.T, repo catalog.Repository) {
+	products := []catalog.Product{
+		{
+			SKU: "ROUND-TRIP_1", Name: "Laptop 14\"", Price: 74_999, Prices: map[money.Currency]int{money.USD: 899},
+			Category: "electronics", Brand: "Dell", Active: true,
+		},
+		{SKU: "ROUND-TRIP_2", Name: "Discontinued mug", Price: 0, Active: false},
+	}
+	for _, p := range products {
+		created := mustCreate(t, repo, p)
+		p.ID = created.ID
+		if !reflect.DeepEqual(created, p) {
+			t.Errorf("CreateProduct() = %+v, want %+v", created, p)
+		}
+		got, err := repo.GetProductByID(created.ID)
+		if err != nil {
+			t.Fatalf("GetProductByID() unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("GetProductByID() = %+v, want %+v", got, p)
+		}
+	}
+}
+
+func testSKUs(t *testing.T, repo catalog.Repository) {
+	tee := mustCreate(t, repo, testProduct("tee-red", 500))
+	if tee.SKU != "TEE-RED" {
+		t.Errorf("CreateProduct() sku = %q, want it normalized to %q", tee.SKU, "TEE-RED")
+	}
+	if _, err := repo.CreateProduct(testProduct(" Tee-Red ", 600)); !errors.Is(err, catalog.ErrAlreadyExists) {
+		t.Errorf("CreateProduct() with used sku error = %v, want %v", err, catalog.ErrAlreadyExists)
+	}
+
+	mug := mustCreate(t, repo, testProduct("MUG", 200))
+	if _, err := repo.UpdateProductByID(mug.ID, testProduct("tee-RED", 200)); !errors.Is(err, catalog.ErrAlreadyExists) {
+		t.Errorf("UpdateProductByID() to used sku error = %v, want %v", err, catalog.ErrAlreadyExists)
+	}
+	// keeping its own sku is not a conflict
+	if _, err := repo.UpdateProductByID(tee.ID, testProduct("tee-red", 550)); err != nil {
+		t.Fatalf("UpdateProductByID() with own sku unexpected error: %v", err)
+	}
+	// changing the sku frees the old one
+	if _, err := repo.UpdateProductByID(tee.ID, testProduct("TEE-BLUE", 550)); err != nil {
+		t.Fatalf("UpdateProductByID() with new sku unexpected error: %v", err)
+	}
+	mustCreate(t, repo, testProduct("TEE-RED", 500))
+
+	// deleting frees the sku
+	if err := repo.DeleteProductByID(mug.ID); err != nil {
+		t.Fatalf("DeleteProductByID() unexpected error: %v", err)
+	}
+	mustCreate(t, repo, testProduct("mug", 200))
+}
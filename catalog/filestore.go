@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"path/filepath"
+
+	"github.com/ParasRaba155/monk-commerce-task/filestore"
+)
+
+const (
+	productsFileName = "products.json"
+
+	// formatVersion is the version of the products file the store writes
+	// a file without a version has the prices in rupees, they are scaled to paisa when read
+	formatVersion = 1
+)
+
+// productsFile is the content of the products file
+// the deleted products still hold their ids, so the counter can be ahead of the products
+type productsFile struct {
+	Version  int       `json:"version,omitempty"`
+	NextID   int       `json:"next_id"`
+	Products []Product `json:"products"`
+}
+
+// fileRepository persists the catalog to a JSON file
+//
+// The catalog is small and rarely written, so the whole file is replaced atomically
+// on every write and the embedded in-memory repository serves all the reads.
+type fileRepository struct {
+	*repository
+	file *filestore.JSON[productsFile]
+}
+
+// NewFileRepository opens or creates the catalog in dir, a new catalog starts with the DefaultProducts
+func NewFileRepository(dir string) (*fileRepository, error) {
+	f := &fileRepository{repository: NewRepository()}
+	initial := productsFile{Version: formatVersion, NextID: 1, Products: DefaultProducts()}
+	file, err := filestore.Open(filepath.Join(dir, productsFileName), initial, f.state, f.restore)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	return f, nil
+}
+
+// CreateProduct assigns a new ID, stores and persists the product.
+func (f *fileRepository) CreateProduct(product Product) (Product, error) {
+	var created Product
+	err := f.file.Write(func() (err error) {
+		created, err = f.repository.CreateProduct(product)
+		return err
+	})
+	if err != nil {
+		return Product{}, err
+	}
+	return created, nil
+}
+
+// UpdateProductByID replaces and persists the product with the new details.
+func (f *fileRepository) UpdateProductByID(id int, newProduct Product) (Product, error) {
+	var updated Product
+	err := f.file.Write(func() (err error) {
+		updated, err = f.repository.UpdateProductByID(id, newProduct)
+		return err
+	})
+	if err != nil {
+		return Product{}, err
+	}
+	return updated, nil
+}
+
+// DeleteProductByID removes the product and persists the removal.
+func (f *fileRepository) DeleteProductByID(id int) error {
+	return f.file.Write(func() error {
+		return f.repository.DeleteProductByID(id)
+	})
+}
+
+// state is the content of the file for the products in memory
+func (f *fileRepository) state() productsFile {
+	f.repository.mu.RLock()
+	defer f.repository.mu.RUnlock()
+	state := productsFile{Version: formatVersion, NextID: f.repository.nextID, Products: make([]Product, 0, len(f.repository.products))}
+	for _, p := range f.repository.products {
+		state.Products = append(state.Products, p)
+	}
+	return state
+}
+
+// restore replaces the products in memory with the ones of the file
+func (f *fileRepository) restore(state productsFile) {
+	if state.Version == 0 {
+		for i := range state.Products {
+			state.Products[i].Price *= 100
+		}
+	}
+	f.repository.reset(state.Products, state.NextID)
+}
@@ -0,0 +1,40 @@
+package catalog_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/catalog/catalogtest"
+)
+
+func TestFileRepositoryReopen(t *testing.T) {
+	catalogtest.RunReopenTests(t, func(t *testing.T, dir string) catalog.Repository {
+		repo, err := catalog.NewFileRepository(dir)
+		if err != nil {
+			t.Fatalf("NewFileRepository() unexpected error: %v", err)
+		}
+		return repo
+	})
+}
+
+func TestFileRepositoryScalesPricesInRupees(t *testing.T) {
+	dir := t.TempDir()
+	// the file from before the prices were in paisa has no version
+	data := `{"next_id": 3, "products": [{"id": 1, "sku": "SKU-001", "name": "Product 1", "price": 10, "active": true}]}`
+	if err := os.WriteFile(filepath.Join(dir, "products.json"), []byte(data), 0o644); err != nil {
+		t.Fatalf("write products: %v", err)
+	}
+	repo, err := catalog.NewFileRepository(dir)
+	if err != nil {
+		t.Fatalf("NewFileRepository() unexpected error: %v", err)
+	}
+	got, err := repo.GetProductByID(1)
+	if err != nil {
+		t.Fatalf("GetProductByID() unexpected error: %v", err)
+	}
+	if got.Price != 1000 {
+		t.Errorf("GetProductByID() price = %d, want 1000", got.Price)
+	}
+}
@@ -0,0 +1,124 @@
+package catalog
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ParasRaba155/monk-commerce-task/utils"
+)
+
+type Repository interface {
+	CreateProduct(product Product) (Product, error)
+	GetAllProducts() ([]Product, error)
+	GetProductByID(id int) (Product, error)
+	UpdateProductByID(id int, newProduct Product) (Product, error)
+	DeleteProductByID(id int) error
+}
+
+type Handler struct {
+	Repo Repository
+}
+
+func NewHandler(repo Repository) Handler {
+	return Handler{Repo: repo}
+}
+
+// Create stores the product and responds with it, so the client gets the assigned ID
+func (h Handler) Create(c echo.Context) error {
+	var req ProductReq
+	if err := c.Bind(&req); err != nil {
+		slog.Error("create product bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("create product validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	created, err := h.Repo.CreateProduct(req.ToProduct())
+	if err != nil {
+		slog.Error("create product db", slog.Any("err", err))
+		if errors.Is(err, ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusCreated, utils.GenericSuccess(created))
+}
+
+func (h Handler) Get(c echo.Context) error {
+	products, err := h.Repo.GetAllProducts()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(products))
+}
+
+func (h Handler) GetByID(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	product, err := h.Repo.GetProductByID(id)
+	if err != nil {
+		slog.Error("get product by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(product))
+}
+
+// UpdateByID replaces the product as a whole, same as the coupons
+func (h Handler) UpdateByID(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	var req ProductReq
+	if err := c.Bind(&req); err != nil {
+		slog.Error("update product bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("update product validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	updated, err := h.Repo.UpdateProductByID(id, req.ToProduct())
+	if err != nil {
+		slog.Error("update product by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		if errors.Is(err, ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(updated))
+}
+
+func (h Handler) DeleteByID(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := h.Repo.DeleteProductByID(id); err != nil {
+		slog.Error("delete product by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,101 @@
+// Package catalog to handle the products which can be added to the cart
+//
+// Including DB and endpoints
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+var (
+	errInvalidSKU   = errors.New("invalid sku")
+	errInvalidName  = errors.New("invalid name")
+	errInvalidPrice = errors.New("invalid price")
+
+	// ErrProductInactive is returned for the products which can not be added to the cart
+	ErrProductInactive = errors.New("product is not active")
+	// ErrPriceUnavailable is returned for the products which do not have a price in the currency of the cart
+	ErrPriceUnavailable = errors.New("product price is not available in the currency")
+)
+
+// skuRegex is for the normalized sku, e.g. TSHIRT-RED_XL
+var skuRegex = regexp.MustCompile(`^[A-Z0-9_-]{1,64}$`)
+
+type Product struct {
+	ID int `json:"id"`
+	// SKU is the unique stock keeping unit, it is always stored normalized
+	SKU  string `json:"sku"`
+	Name string `json:"name"`
+	// Price is per unit in the smallest unit of money.DefaultCurrency
+	Price int `json:"price"`
+	// Prices are per unit in the smallest unit of the other currencies the product is sold in
+	Prices   map[money.Currency]int `json:"prices,omitempty"`
+	Category string                 `json:"category,omitempty"`
+	Brand    string                 `json:"brand,omitempty"`
+	// Active products can be added to the cart, inactive ones are kept for the history
+	Active bool `json:"active"`
+}
+
+// NormalizeSKU makes the sku case-insensitive
+func NormalizeSKU(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// Validate the product with the normalized sku
+func (p Product) Validate() error {
+	if !skuRegex.MatchString(p.SKU) {
+		return fmt.Errorf("%w: sku must be 1 to 64 letters, digits, '-' or '_'", errInvalidSKU)
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: name is required field", errInvalidName)
+	}
+	if p.Price < 0 {
+		return fmt.Errorf("%w: price can not be negative", errInvalidPrice)
+	}
+	for currency, price := range p.Prices {
+		if _, err := money.ParseCurrency(string(currency)); err != nil {
+			return fmt.Errorf("%w: %w", errInvalidPrice, err)
+		}
+		if currency == money.DefaultCurrency {
+			return fmt.Errorf("%w: price in %s is the price field", errInvalidPrice, currency)
+		}
+		if price < 0 {
+			return fmt.Errorf("%w: price in %s can not be negative", errInvalidPrice, currency)
+		}
+	}
+	return nil
+}
+
+// PriceIn returns the price per unit in the currency
+// the bool will be false if the product is not sold in the currency
+func (p Product) PriceIn(currency money.Currency) (money.Money, bool) {
+	if currency == money.DefaultCurrency {
+		return money.New(int64(p.Price), currency), true
+	}
+	price, ok := p.Prices[currency]
+	return money.New(int64(price), currency), ok
+}
+
+// DefaultProducts is the product list the service starts with when the products are not persisted
+// they are the 10 products of the original static list, the price of each product is id * 1000 paisa, i.e. ₹10 to ₹100
+func DefaultProducts() []Product {
+	products := make([]Product, 10)
+	for i := range products {
+		id := i + 1
+		products[i] = Product{
+			ID:       id,
+			SKU:      fmt.Sprintf("SKU-%03d", id),
+			Name:     fmt.Sprintf("Product %d", id),
+			Price:    id * 1000,
+			Category: "general",
+			Brand:    "generic",
+			Active:   true,
+		}
+	}
+	return products
+}
@@ -0,0 +1,143 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrDoesNotExist  = errors.New("no such entity")
+	ErrAlreadyExists = errors.New("entity already exists")
+)
+
+// repository is the in-memory db
+// products are stored by product.ID
+// skus is the index of normalized product.SKU -> product.ID
+// mu guards all the fields, so the repository can be shared by concurrent handlers
+type repository struct {
+	mu       sync.RWMutex
+	products map[int]Product
+	skus     map[string]int
+	nextID   int // auto-incrementing ID counter
+}
+
+func NewRepository() *repository {
+	return &repository{
+		products: make(map[int]Product, 100),
+		skus:     make(map[string]int, 100),
+		nextID:   1,
+	}
+}
+
+// NewSeededRepository returns the in-memory db with the DefaultProducts
+func NewSeededRepository() *repository {
+	r := NewRepository()
+	r.reset(DefaultProducts(), 1)
+	return r
+}
+
+// reset replaces all the products, the id counter is kept ahead of the products
+func (r *repository) reset(products []Product, nextID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.products = make(map[int]Product, len(products))
+	r.skus = make(map[string]int, len(products))
+	r.nextID = nextID
+	for _, p := range products {
+		r.products[p.ID] = p.clone()
+		r.skus[p.SKU] = p.ID
+		r.nextID = max(r.nextID, p.ID+1)
+	}
+}
+
+// CreateProduct assigns a new ID and stores the product.
+// It will fail if the sku is already used by another product
+func (r *repository) CreateProduct(product Product) (Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	product.ID = r.nextID
+	product.SKU = NormalizeSKU(product.SKU)
+	if err := r.checkSKU(product.SKU, product.ID); err != nil {
+		return Product{}, err
+	}
+	product.Prices = maps.Clone(product.Prices)
+	r.products[product.ID] = product
+	r.skus[product.SKU] = product.ID
+	r.nextID++
+	return product.clone(), nil
+}
+
+// GetAllProducts returns all products sorted by ID.
+func (r *repository) GetAllProducts() ([]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]Product, 0, len(r.products))
+	for _, p := range r.products {
+		result = append(result, p.clone())
+	}
+	slices.SortFunc(result, func(a, b Product) int { return a.ID - b.ID })
+	return result, nil
+}
+
+// GetProductByID returns the product with the given ID.
+func (r *repository) GetProductByID(id int) (Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.products[id]
+	if !ok {
+		return Product{}, fmt.Errorf("%w: no product with id %d", ErrDoesNotExist, id)
+	}
+	return p.clone(), nil
+}
+
+// UpdateProductByID replaces the product with the new details.
+// It will fail if the new sku is already used by another product
+func (r *repository) UpdateProductByID(id int, newProduct Product) (Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.products[id]
+	if !ok {
+		return Product{}, fmt.Errorf("%w: no product with id %d", ErrDoesNotExist, id)
+	}
+	newProduct.ID = id // enforce correct ID
+	newProduct.SKU = NormalizeSKU(newProduct.SKU)
+	if err := r.checkSKU(newProduct.SKU, id); err != nil {
+		return Product{}, err
+	}
+	delete(r.skus, old.SKU)
+	newProduct.Prices = maps.Clone(newProduct.Prices)
+	r.products[id] = newProduct
+	r.skus[newProduct.SKU] = id
+	return newProduct.clone(), nil
+}
+
+// DeleteProductByID removes the product from the repository.
+func (r *repository) DeleteProductByID(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.products[id]
+	if !ok {
+		return fmt.Errorf("%w: no product with id %d", ErrDoesNotExist, id)
+	}
+	delete(r.skus, p.SKU)
+	delete(r.products, id)
+	return nil
+}
+
+// checkSKU returns error if the normalized sku is used by a product other than id
+// the caller must hold the lock
+func (r *repository) checkSKU(sku string, id int) error {
+	if existingID, ok := r.skus[sku]; ok && existingID != id {
+		return fmt.Errorf("%w: sku %q is used by product %d", ErrAlreadyExists, sku, existingID)
+	}
+	return nil
+}
+
+// clone copies the prices, so the stored product is not shared with the callers
+func (p Product) clone() Product {
+	p.Prices = maps.Clone(p.Prices)
+	return p
+}
@@ -0,0 +1,51 @@
+package catalog_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/catalog/catalogtest"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	catalogtest.RunRepositoryTests(t, func(*testing.T) catalog.Repository {
+		return catalog.NewRepository()
+	})
+}
+
+func TestSeededRepositoryConformance(t *testing.T) {
+	catalogtest.RunRepositoryTests(t, func(*testing.T) catalog.Repository {
+		return catalog.NewSeededRepository()
+	})
+}
+
+func TestSeededRepository(t *testing.T) {
+	repo := catalog.NewSeededRepository()
+	got, err := repo.GetAllProducts()
+	if err != nil {
+		t.Fatalf("GetAllProducts() unexpected error: %v", err)
+	}
+	if want := catalog.DefaultProducts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllProducts() = %+v, want %+v", got, want)
+	}
+
+	// the new products come after the seeded ones
+	created, err := repo.CreateProduct(catalog.Product{SKU: "NEW", Name: "New", Price: 5, Active: true})
+	if err != nil {
+		t.Fatalf("CreateProduct() unexpected error: %v", err)
+	}
+	if created.ID != 11 {
+		t.Errorf("CreateProduct() id = %d, want 11", created.ID)
+	}
+}
+
+func TestFileRepositoryConformance(t *testing.T) {
+	catalogtest.RunRepositoryTests(t, func(t *testing.T) catalog.Repository {
+		repo, err := catalog.NewFileRepository(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileRepository() unexpected error: %v", err)
+		}
+		return repo
+	})
+}
@@ -0,0 +1,54 @@
+package catalog
+
+import (
+	"strings"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+type ProductReq struct {
+	// SKU is case-insensitive
+	SKU   string `json:"sku"`
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+	// Prices are optional, the keys are case-insensitive currency codes
+	Prices   map[string]int `json:"prices,omitempty"`
+	Category string         `json:"category,omitempty"`
+	Brand    string         `json:"brand,omitempty"`
+	// Active is optional, the product is active unless it is false
+	Active *bool `json:"active,omitempty"`
+}
+
+// Validate the product of the request
+func (r ProductReq) Validate() error {
+	return r.ToProduct().Validate()
+}
+
+// ToProduct converts the request into the product entity, the ID is left for the repository
+func (r ProductReq) ToProduct() Product {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return Product{
+		SKU:      NormalizeSKU(r.SKU),
+		Name:     strings.TrimSpace(r.Name),
+		Price:    r.Price,
+		Category: strings.TrimSpace(r.Category),
+		Brand:    strings.TrimSpace(r.Brand),
+		Active:   active,
+		Prices:   normalizePrices(r.Prices),
+	}
+}
+
+// normalizePrices upper-cases the currency codes, the codes are validated with the product
+func normalizePrices(prices map[string]int) map[money.Currency]int {
+	if len(prices) == 0 {
+		return nil
+	}
+	result := make(map[money.Currency]int, len(prices))
+	for code, price := range prices {
+		result[money.Currency(strings.ToUpper(strings.TrimSpace(code)))] = price
+	}
+	return result
+}
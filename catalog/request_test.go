@@ -0,0 +1,57 @@
+package catalog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+func TestProductReq(t *testing.T) {
+	inactive := false
+	tests := []struct {
+		name        string
+		req         ProductReq
+		expected    Product
+		expectedErr error
+	}{
+		{
+			name:     "Active unless given",
+			req:      ProductReq{SKU: " tee-red ", Name: " Red Tee ", Price: 499, Category: " clothing ", Brand: "Acme"},
+			expected: Product{SKU: "TEE-RED", Name: "Red Tee", Price: 499, Category: "clothing", Brand: "Acme", Active: true},
+		},
+		{
+			name:     "Inactive",
+			req:      ProductReq{SKU: "MUG", Name: "Mug", Price: 0, Active: &inactive},
+			expected: Product{SKU: "MUG", Name: "Mug", Price: 0, Active: false},
+		},
+		{
+			name:     "Prices in other currencies",
+			req:      ProductReq{SKU: "MUG", Name: "Mug", Price: 19_900, Prices: map[string]int{" usd ": 299}},
+			expected: Product{SKU: "MUG", Name: "Mug", Price: 19_900, Prices: map[money.Currency]int{money.USD: 299}, Active: true},
+		},
+		{name: "Unsupported currency", req: ProductReq{SKU: "MUG", Name: "Mug", Price: 10, Prices: map[string]int{"EUR": 3}}, expectedErr: errInvalidPrice},
+		{name: "Default currency in prices", req: ProductReq{SKU: "MUG", Name: "Mug", Price: 10, Prices: map[string]int{"inr": 10}}, expectedErr: errInvalidPrice},
+		{name: "Negative price in currency", req: ProductReq{SKU: "MUG", Name: "Mug", Price: 10, Prices: map[string]int{"USD": -1}}, expectedErr: errInvalidPrice},
+		{name: "Missing sku", req: ProductReq{Name: "Mug", Price: 10}, expectedErr: errInvalidSKU},
+		{name: "Invalid sku", req: ProductReq{SKU: "MUG 1", Name: "Mug", Price: 10}, expectedErr: errInvalidSKU},
+		{name: "Missing name", req: ProductReq{SKU: "MUG", Name: "  ", Price: 10}, expectedErr: errInvalidName},
+		{name: "Negative price", req: ProductReq{SKU: "MUG", Name: "Mug", Price: -1}, expectedErr: errInvalidPrice},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.Validate()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tc.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tc.req.ToProduct(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("ToProduct() = %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/sqlstore"
+)
+
+const (
+	storeMemory = "memory"
+	storeFile   = "file"
+	storeSQLite = "sqlite"
+)
+
+// config is read from the environment
+//
+//	COUPON_STORE          memory (default), file or sqlite
+//	COUPON_DATA_DIR       directory for the file store, default ./data
+//	COUPON_SNAPSHOT_EVERY log entries between the snapshots of the file store
+//	COUPON_SQLITE_PATH    database file for the sqlite store, default ./data/coupons.db
+//	COUPON_ROUNDING       rounding of the percentage discounts, half-up (default), half-even or floor
+type config struct {
+	Store         string
+	DataDir       string
+	SnapshotEvery int
+	SQLitePath    string
+	Rounding      money.Rounding
+}
+
+func loadConfig() (config, error) {
+	cfg := config{
+		Store:         getEnv("COUPON_STORE", storeMemory),
+		DataDir:       getEnv("COUPON_DATA_DIR", "data"),
+		SnapshotEvery: coupon.DefaultSnapshotEvery,
+		SQLitePath:    getEnv("COUPON_SQLITE_PATH", filepath.Join("data", "coupons.db")),
+	}
+	if v := os.Getenv("COUPON_SNAPSHOT_EVERY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return config{}, fmt.Errorf("COUPON_SNAPSHOT_EVERY must be a positive number, got %q", v)
+		}
+		cfg.SnapshotEvery = n
+	}
+	if v := os.Getenv("COUPON_ROUNDING"); v != "" {
+		rounding, err := money.ParseRounding(v)
+		if err != nil {
+			return config{}, fmt.Errorf("COUPON_ROUNDING: %w", err)
+		}
+		cfg.Rounding = rounding
+	}
+	return cfg, nil
+}
+
+// stores are the repositories selected by the config
+// the memory store starts with catalog.DefaultProducts and no customers, the other stores persist them
+// Close must be called before exit
+type stores struct {
+	Coupons   coupon.Repository
+	Products  catalog.Repository
+	Customers customer.Repository
+	Close     func() error
+}
+
+func newStores(cfg config) (stores, error) {
+	switch cfg.Store {
+	case storeMemory:
+		return stores{
+			Coupons:   coupon.NewRepository(),
+			Products:  catalog.NewSeededRepository(),
+			Customers: customer.NewRepository(),
+			Close:     func() error { return nil },
+		}, nil
+	case storeFile:
+		repo, err := coupon.NewFileRepository(cfg.DataDir, cfg.SnapshotEvery)
+		if err != nil {
+			return stores{}, err
+		}
+		products, err := catalog.NewFileRepository(cfg.DataDir)
+		if err != nil {
+			repo.Close()
+			return stores{}, err
+		}
+		customers, err := customer.NewFileRepository(cfg.DataDir)
+		if err != nil {
+			repo.Close()
+			return stores{}, err
+		}
+		return stores{
+			Coupons:   repo,
+			Products:  products,
+			Customers: customers,
+			Close:     repo.Close,
+		}, nil
+	case storeSQLite:
+		if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0o755); err != nil {
+			return stores{}, err
+		}
+		store, err := sqlstore.NewStore(cfg.SQLitePath)
+		if err != nil {
+			return stores{}, err
+		}
+		return stores{
+			Coupons:   store,
+			Products:  store,
+			Customers: store,
+			Close:     store.Close,
+		}, nil
+	default:
+		return stores{}, fmt.Errorf("unknown COUPON_STORE %q, must be %q, %q or %q", cfg.Store, storeMemory, storeFile, storeSQLite)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
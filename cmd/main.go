@@ -4,12 +4,15 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"os"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/ParasRaba155/monk-commerce-task/cart"
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
 	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
 )
 
 func main() {
@@ -20,18 +23,55 @@ func main() {
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
-	repo := coupon.NewRepository()
-	couponHandler := coupon.NewHandler(repo)
-	cartHandler := cart.NewHandler(repo)
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	stores, err := newStores(cfg)
+	if err != nil {
+		slog.Error("failed to open stores", "error", err, "store", cfg.Store)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := stores.Close(); err != nil {
+			slog.Error("failed to close stores", "error", err)
+		}
+	}()
+
+	couponHandler := coupon.NewHandler(stores.Coupons)
+	cartHandler := cart.NewHandler(stores.Coupons, stores.Products, stores.Customers)
+	cartHandler.Rounding = cfg.Rounding
+	productHandler := catalog.NewHandler(stores.Products)
+	customerHandler := customer.NewHandler(stores.Customers)
 
 	e.POST("/coupons", couponHandler.Create)
 	e.GET("/coupons", couponHandler.Get)
 	e.GET("/coupons/:id", couponHandler.GetByID)
 	e.PUT("/coupons/:id", couponHandler.UpdateByID)
 	e.DELETE("/coupons/:id", couponHandler.DeleteByID)
+	e.GET("/coupons/:id/redemptions", couponHandler.GetRedemptions)
+	e.POST("/coupons/:id/codes", couponHandler.GenerateCodes)
+	e.GET("/coupons/:id/codes", couponHandler.ExportCodes)
+
+	e.POST("/products", productHandler.Create)
+	e.GET("/products", productHandler.Get)
+	e.GET("/products/:id", productHandler.GetByID)
+	e.PUT("/products/:id", productHandler.UpdateByID)
+	e.DELETE("/products/:id", productHandler.DeleteByID)
+
+	e.POST("/customers", customerHandler.Create)
+	e.GET("/customers", customerHandler.Get)
+	e.GET("/customers/:id", customerHandler.GetByID)
+	e.PUT("/customers/:id", customerHandler.UpdateByID)
+	e.DELETE("/customers/:id", customerHandler.DeleteByID)
 
 	e.POST("/applicable-coupon", cartHandler.ApplicableCoupon)
 	e.POST("/apply-coupon/:id", cartHandler.ApplyCoupon)
+	e.POST("/apply-coupon/code/:code", cartHandler.ApplyCouponByCode)
+	e.POST("/apply-coupons", cartHandler.ApplyCoupons)
+	e.POST("/coupons/:id/evaluate", cartHandler.EvaluateCoupon)
 
 	// Start server
 	if err := e.Start(":8080"); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -0,0 +1,181 @@
+package coupon
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxGeneratedCodes is the maximum number of codes generated in a single request
+	MaxGeneratedCodes = 100_000
+
+	// DefaultCodeAlphabet leaves out 0, O, 1 and I which are easy to misread
+	DefaultCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	DefaultCodeLength   = 8
+	// codeCharacters are all the characters an alphabet can have
+	codeCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	// codeSpaceFactor is how much larger the code space should be than the requested count,
+	// so the random codes rarely collide
+	codeSpaceFactor = 100
+	// maxGenerateAttempts is the number of times a batch is generated again on conflict
+	maxGenerateAttempts = 5
+)
+
+var (
+	ErrCodeRedeemed       = errors.New("code already redeemed")
+	ErrCodeRequired       = errors.New("coupon can only be applied with a code")
+	errInvalidGenerateReq = errors.New("invalid generate codes request")
+)
+
+// CouponCode is a single use code generated for a coupon
+// RedeemedAt is nil until the code is redeemed
+type CouponCode struct {
+	Code       string     `json:"code"`
+	CouponID   int        `json:"coupon_id"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+}
+
+func (c CouponCode) IsRedeemed() bool {
+	return c.RedeemedAt != nil
+}
+
+// GenerateCodesReq is the request for generating single use codes of a coupon
+// a code is the Prefix followed by Length random characters of Alphabet
+type GenerateCodesReq struct {
+	Count    int    `json:"count"`
+	Prefix   string `json:"prefix,omitempty"`
+	Length   int    `json:"length,omitempty"`
+	Alphabet string `json:"alphabet,omitempty"`
+}
+
+// WithDefaults fills the optional fields and normalizes the prefix and alphabet
+func (r GenerateCodesReq) WithDefaults() GenerateCodesReq {
+	r.Prefix = NormalizeCode(r.Prefix)
+	r.Alphabet = NormalizeCode(r.Alphabet)
+	if r.Length == 0 {
+		r.Length = DefaultCodeLength
+	}
+	if r.Alphabet == "" {
+		r.Alphabet = DefaultCodeAlphabet
+	}
+	return r
+}
+
+// Validate the request after WithDefaults
+func (r GenerateCodesReq) Validate() error {
+	if r.Count < 1 || r.Count > MaxGeneratedCodes {
+		return fmt.Errorf("%w: count must be between 1 and %d", errInvalidGenerateReq, MaxGeneratedCodes)
+	}
+	if r.Length < 4 {
+		return fmt.Errorf("%w: length must be at least 4", errInvalidGenerateReq)
+	}
+	if len(r.Alphabet) < 2 {
+		return fmt.Errorf("%w: alphabet must have at least 2 characters", errInvalidGenerateReq)
+	}
+	for i, ch := range r.Alphabet {
+		if !strings.ContainsRune(codeCharacters, ch) {
+			return fmt.Errorf("%w: alphabet can only have letters and digits", errInvalidGenerateReq)
+		}
+		if strings.IndexRune(r.Alphabet, ch) != i {
+			return fmt.Errorf("%w: alphabet has %q more than once", errInvalidGenerateReq, ch)
+		}
+	}
+	// the generated codes are stored alongside the coupon codes, so they follow the same rules
+	if err := ValidateCode(r.Prefix + strings.Repeat(r.Alphabet[:1], r.Length)); err != nil {
+		return fmt.Errorf("%w: prefix and length: %w", errInvalidGenerateReq, err)
+	}
+	codeSpace := float64(r.Length) * math.Log(float64(len(r.Alphabet)))
+	if codeSpace < math.Log(float64(r.Count)*codeSpaceFactor) {
+		return fmt.Errorf("%w: %d codes of length %d from %d characters would collide, increase the length", errInvalidGenerateReq, r.Count, r.Length, len(r.Alphabet))
+	}
+	return nil
+}
+
+// CodeService generates the single use codes of the coupons
+type CodeService struct {
+	Repo Repository
+	// Rand is the source of randomness, crypto/rand unless replaced in tests
+	Rand io.Reader
+}
+
+func NewCodeService(repo Repository) CodeService {
+	return CodeService{Repo: repo, Rand: rand.Reader}
+}
+
+// Generate creates req.Count new unique codes for the coupon
+// the whole batch is generated again if any of the codes is already used by the store
+func (s CodeService) Generate(couponID int, req GenerateCodesReq) ([]CouponCode, error) {
+	req = req.WithDefaults()
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.Repo.GetCouponByID(couponID); err != nil {
+		return nil, err
+	}
+
+	var err error
+	for range maxGenerateAttempts {
+		var codes []string
+		codes, err = s.randomCodes(req)
+		if err != nil {
+			return nil, err
+		}
+		var created []CouponCode
+		created, err = s.Repo.CreateCouponCodes(couponID, codes)
+		if !errors.Is(err, ErrAlreadyExists) {
+			return created, err
+		}
+	}
+	return nil, fmt.Errorf("generate codes after %d attempts: %w", maxGenerateAttempts, err)
+}
+
+// randomCodes returns req.Count distinct codes
+func (s CodeService) randomCodes(req GenerateCodesReq) ([]string, error) {
+	// rejection sampling keeps every character of the alphabet equally likely
+	alphabetLen := len(req.Alphabet)
+	limit := 256 - 256%alphabetLen
+	buf := make([]byte, 4096)
+	pos := len(buf)
+	nextChar := func() (byte, error) {
+		for {
+			if pos == len(buf) {
+				if _, err := io.ReadFull(s.Rand, buf); err != nil {
+					return 0, fmt.Errorf("read random: %w", err)
+				}
+				pos = 0
+			}
+			b := int(buf[pos])
+			pos++
+			if b < limit {
+				return req.Alphabet[b%alphabetLen], nil
+			}
+		}
+	}
+
+	seen := make(map[string]struct{}, req.Count)
+	codes := make([]string, 0, req.Count)
+	var code strings.Builder
+	for len(codes) < req.Count {
+		code.Reset()
+		code.WriteString(req.Prefix)
+		for range req.Length {
+			ch, err := nextChar()
+			if err != nil {
+				return nil, err
+			}
+			code.WriteByte(ch)
+		}
+		if _, ok := seen[code.String()]; ok {
+			continue
+		}
+		seen[code.String()] = struct{}{}
+		codes = append(codes, code.String())
+	}
+	return codes, nil
+}
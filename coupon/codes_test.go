@@ -0,0 +1,107 @@
+package coupon
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// seededRand is a deterministic source of randomness for the code service
+func seededRand(seed byte) *rand.ChaCha8 {
+	return rand.NewChaCha8([32]byte{seed})
+}
+
+func TestGenerateCodesReqValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         GenerateCodesReq
+		expectedErr error
+	}{
+		{name: "defaults", req: GenerateCodesReq{Count: 10}},
+		{name: "custom", req: GenerateCodesReq{Count: 10, Prefix: "diwali-", Length: 6, Alphabet: "abcdef123"}},
+		{name: "zero count", req: GenerateCodesReq{}, expectedErr: errInvalidGenerateReq},
+		{name: "too many", req: GenerateCodesReq{Count: MaxGeneratedCodes + 1}, expectedErr: errInvalidGenerateReq},
+		{name: "short length", req: GenerateCodesReq{Count: 1, Length: 3}, expectedErr: errInvalidGenerateReq},
+		{name: "single character alphabet", req: GenerateCodesReq{Count: 1, Alphabet: "A"}, expectedErr: errInvalidGenerateReq},
+		{name: "repeated character", req: GenerateCodesReq{Count: 1, Alphabet: "ABCA"}, expectedErr: errInvalidGenerateReq},
+		{name: "invalid character", req: GenerateCodesReq{Count: 1, Alphabet: "AB-"}, expectedErr: errInvalidGenerateReq},
+		{name: "invalid prefix", req: GenerateCodesReq{Count: 1, Prefix: "SALE!"}, expectedErr: errInvalidGenerateReq},
+		{name: "code too long", req: GenerateCodesReq{Count: 1, Prefix: "A-VERY-LONG-PREFIX-", Length: 16}, expectedErr: errInvalidGenerateReq},
+		{name: "code space too small", req: GenerateCodesReq{Count: 1000, Length: 4, Alphabet: "AB"}, expectedErr: errInvalidGenerateReq},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.WithDefaults().Validate()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCodeServiceGenerate(t *testing.T) {
+	repo := NewRepository()
+	c, err := repo.CreateCoupon(testCoupon(10))
+	if err != nil {
+		t.Fatalf("CreateCoupon() unexpected error: %v", err)
+	}
+	service := CodeService{Repo: repo, Rand: seededRand(1)}
+
+	const count = 50_000
+	req := GenerateCodesReq{Count: count, Prefix: "bf-", Length: 8, Alphabet: "ABCDEF234"}
+	codes, err := service.Generate(c.ID, req)
+	if err != nil {
+		t.Fatalf("Generate() unexpected error: %v", err)
+	}
+	if len(codes) != count {
+		t.Fatalf("Generate() returned %d codes, want %d", len(codes), count)
+	}
+
+	seen := make(map[string]struct{}, count)
+	for _, code := range codes {
+		if _, ok := seen[code.Code]; ok {
+			t.Fatalf("Generate() returned %q more than once", code.Code)
+		}
+		seen[code.Code] = struct{}{}
+		random, ok := strings.CutPrefix(code.Code, "BF-")
+		if !ok || len(random) != req.Length || strings.Trim(random, req.Alphabet) != "" {
+			t.Fatalf("Generate() code %q does not follow %+v", code.Code, req)
+		}
+		if code.CouponID != c.ID || code.IsRedeemed() {
+			t.Fatalf("Generate() code = %+v", code)
+		}
+	}
+
+	stored, err := repo.GetCouponCodes(c.ID)
+	if err != nil {
+		t.Fatalf("GetCouponCodes() unexpected error: %v", err)
+	}
+	if len(stored) != count {
+		t.Errorf("GetCouponCodes() returned %d codes, want %d", len(stored), count)
+	}
+}
+
+func TestCodeServiceGenerateRetriesConflicts(t *testing.T) {
+	repo := NewRepository()
+	first, _ := repo.CreateCoupon(testCoupon(10))
+	second, _ := repo.CreateCoupon(testCoupon(20))
+	req := GenerateCodesReq{Count: 100}
+
+	if _, err := (CodeService{Repo: repo, Rand: seededRand(7)}).Generate(first.ID, req); err != nil {
+		t.Fatalf("Generate() unexpected error: %v", err)
+	}
+	// the same seed makes the first batch collide with the codes of the first coupon
+	codes, err := (CodeService{Repo: repo, Rand: seededRand(7)}).Generate(second.ID, req)
+	if err != nil {
+		t.Fatalf("Generate() after conflict unexpected error: %v", err)
+	}
+	if len(codes) != req.Count {
+		t.Errorf("Generate() returned %d codes, want %d", len(codes), req.Count)
+	}
+
+	if _, err := (CodeService{Repo: repo, Rand: seededRand(7)}).Generate(1000, req); !errors.Is(err, ErrDoesNotExist) {
+		t.Errorf("Generate() for missing coupon error = %v, want %v", err, ErrDoesNotExist)
+	}
+}
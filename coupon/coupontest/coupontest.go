@@ -0,0 +1,876 @@
+// Package coupontest is the conformance suite for the coupon.Repository implementations
+//
+// Every implementation should have a test calling RunRepositoryTests, run it with -race
+package coupontest
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
+)
+
+// concurrency is the number of goroutines each concurrent test starts
+const concurrency = 300
+
+// RunRepositoryTests runs the whole suite, newRepo must return a new empty repository on every call
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) coupon.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo coupon.Repository)
+	}{
+		{name: "crud", test: testCRUD},
+		{name: "round trip of all the fields", test: testRoundTrip},
+		{name: "missing coupon", test: testMissing},
+		{name: "unique case-insensitive codes", test: testCodes},
+		{name: "single use codes", test: testSingleUseCodes},
+		{name: "update keeps single use codes", test: testUpdateKeepsSingleUseCodes},
+		{name: "redemption limits", test: testRedemptionLimits},
+		{name: "redemptions are recorded all or none", test: testRecordRedemptions},
+		{name: "concurrent create assigns unique ids", test: testConcurrentCreate},
+		{name: "concurrent updates are not lost", test: testConcurrentUpdate},
+		{name: "concurrent increments are not lost", test: testConcurrentIncrement},
+		{name: "concurrent redemptions respect limits", test: testConcurrentRedemption},
+		{name: "concurrent redemptions of a first order coupon", test: testConcurrentFirstOrder},
+		{name: "concurrent mixed operations", test: testConcurrentMixed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+}
+
+func testCoupon(discount int) coupon.Coupon {
+	return coupon.Coupon{
+		Type:    "cart-wise",
+		Details: coupon.CartWiseDetails{Threshold: 10, Discount: discount},
+	}
+}
+
+func mustCreate(t *testing.T, repo coupon.Repository, c coupon.Coupon) coupon.Coupon {
+	t.Helper()
+	created, err := repo.CreateCoupon(c)
+	if err != nil {
+		t.Fatalf("CreateCoupon() unexpected error: %v", err)
+	}
+	return created
+}
+
+// AssertCouponEqual compares the coupons, the timestamps are compared as instants
+// since the stores may not keep the monotonic clock or the *time.Location
+func AssertCouponEqual(t *testing.T, got, want coupon.Coupon) {
+	t.Helper()
+	sameInstant := func(a, b *time.Time) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Equal(*b)
+	}
+	if !sameInstant(got.StartsAt, want.StartsAt) || !sameInstant(got.EndsAt, want.EndsAt) {
+		t.Errorf("coupon %d window = [%v, %v), want [%v, %v)", want.ID, got.StartsAt, got.EndsAt, want.StartsAt, want.EndsAt)
+	}
+	got.StartsAt, got.EndsAt = nil, nil
+	want.StartsAt, want.EndsAt = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("coupon = %+v, want %+v", got, want)
+	}
+}
+
+func testCRUD(t *testing.T, repo coupon.Repository) {
+	first := mustCreate(t, repo, testCoupon(10))
+	second := mustCreate(t, repo, testCoupon(20))
+	// the ids start at 1 in every store, so a client can not depend on the store
+	if first.ID != 1 {
+		t.Errorf("CreateCoupon() first id = %d, want 1", first.ID)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("CreateCoupon() assigned id %d twice", first.ID)
+	}
+
+	got, err := repo.GetCouponByID(second.ID)
+	if err != nil {
+		t.Fatalf("GetCouponByID() unexpected error: %v", err)
+	}
+	AssertCouponEqual(t, got, second)
+
+	update := coupon.Coupon{
+		ID:      12345, // the id from the argument wins
+		Type:    "product-wise",
+		Details: coupon.ProductWiseDetails{ProductID: 4, Discount: 40},
+	}
+	updated, err := repo.UpdateCouponByID(first.ID, update)
+	if err != nil {
+		t.Fatalf("UpdateCouponByID() unexpected error: %v", err)
+	}
+	update.ID = first.ID
+	AssertCouponEqual(t, updated, update)
+	got, err = repo.GetCouponByID(first.ID)
+	if err != nil {
+		t.Fatalf("GetCouponByID() unexpected error: %v", err)
+	}
+	AssertCouponEqual(t, got, update)
+
+	if err := repo.DeleteCouponByID(second.ID); err != nil {
+		t.Fatalf("DeleteCouponByID() unexpected error: %v", err)
+	}
+	if _, err := repo.GetCouponByID(second.ID); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponByID() after delete error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+
+	all, err := repo.GetAllCoupons()
+	if err != nil {
+		t.Fatalf("GetAllCoupons() unexpected error: %v", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("GetAllCoupons() = %+v, want only coupon %d", all, first.ID)
+	}
+	AssertCouponEqual(t, all[0], update)
+
+	// ids are not reused after delete
+	third := mustCreate(t, repo, testCoupon(30))
+	if third.ID == second.ID || third.ID == first.ID {
+		t.Errorf("CreateCoupon() reused id %d", third.ID)
+	}
+}
+
+func testRoundTrip(t *testing.T, repo coupon.Repository) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	startsAt := time.Date(2025, time.October, 20, 9, 30, 0, 0, ist)
+	endsAt := time.Date(2025, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+	coupons := []coupon.Coupon{
+		{
+			Code:               "ROUND-TRIP_10",
+			Type:               "cart-wise",
+			Details:            coupon.CartWiseDetails{Threshold: 100, Discount: 10},
+			StartsAt:           &startsAt,
+			EndsAt:             &endsAt,
+			MaxTotalUses:       100,
+			MaxUsesPerCustomer: 2,
+			Stackable:          true,
+		},
+		{
+			Type:         "product-wise",
+			Details:      coupon.ProductWiseDetails{ProductID: 3, Discount: 25, MaxDiscount: 40},
+			RequiresCode: true,
+		},
+		{
+			Type: "bxgy",
+			Details: coupon.BxGyDetails{
+				BuyProducts:     []coupon.CouponProduct{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 2}},
+				GetProducts:     []coupon.CouponProduct{{ProductID: 3, Quantity: 1}},
+				RepetitionLimit: 3,
+			},
+			EndsAt:    &endsAt,
+			Exclusive: true,
+		},
+		{
+			Type:           "category-wise",
+			Details:        coupon.CategoryWiseDetails{Category: "clothing", Discount: 10, MaxDiscount: 200},
+			FirstOrderOnly: true,
+		},
+		{
+			Type:    "brand-wise",
+			Details: coupon.BrandWiseDetails{Brand: "Dell", Discount: 10, ExcludedProductIDs: []int{4, 7}, MinSubtotal: 500},
+		},
+		{
+			Type: "cart-wise",
+			Details: coupon.CartWiseDetails{
+				Tiers:       []coupon.CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}},
+				MaxDiscount: 300,
+			},
+		},
+		{
+			Type:     "product-wise",
+			Details:  coupon.ProductWiseDetails{ProductID: 7, Discount: 50, DiscountKind: coupon.DiscountFixed},
+			Currency: money.USD,
+		},
+		{
+			Type: "volume-tier",
+			Details: coupon.VolumeTierDetails{
+				Category: "clothing",
+				Tiers:    []coupon.VolumeTier{{MinQuantity: 10, Discount: 10}, {MinQuantity: 20, Discount: 15}},
+			},
+		},
+		{
+			Type:    "category-wise",
+			Details: coupon.CategoryWiseDetails{Category: "shoes", Discount: 5},
+			Conditions: &rule.Rule{All: []rule.Rule{
+				{Condition: rule.Condition{Type: rule.CartTotal, Amount: 1000}},
+				{Not: &rule.Rule{Condition: rule.Condition{Type: rule.DayOfWeek, Days: []string{"sunday"}}}},
+			}},
+			Expression: `count(items, category == "shoes") >= 2`,
+		},
+	}
+	for _, c := range coupons {
+		created := mustCreate(t, repo, c)
+		c.ID = created.ID
+		AssertCouponEqual(t, created, c)
+
+		got, err := repo.GetCouponByID(created.ID)
+		if err != nil {
+			t.Fatalf("GetCouponByID() unexpected error: %v", err)
+		}
+		AssertCouponEqual(t, got, c)
+		if got.StartsAt != nil {
+			if _, offset := got.StartsAt.Zone(); offset != 5*60*60+30*60 {
+				t.Errorf("starts_at lost the timezone offset, got %v", got.StartsAt)
+			}
+		}
+	}
+}
+
+func testMissing(t *testing.T, repo coupon.Repository) {
+	const missingID = 424242
+	if _, err := repo.GetCouponByID(missingID); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponByID() error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if _, err := repo.UpdateCouponByID(missingID, testCoupon(10)); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("UpdateCouponByID() error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if err := repo.DeleteCouponByID(missingID); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("DeleteCouponByID() error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if err := repo.RecordRedemption(coupon.Redemption{CouponID: missingID}); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("RecordRedemption() error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if _, err := repo.GetUsage(missingID, 1); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetUsage() error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if _, err := repo.GetRedemptionsByCouponID(missingID); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetRedemptionsByCouponID() error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+}
+
+func testCodes(t *testing.T, repo coupon.Repository) {
+	withCode := func(code string, discount int) coupon.Coupon {
+		c := testCoupon(discount)
+		c.Code = code
+		return c
+	}
+
+	diwali := mustCreate(t, repo, withCode("Diwali20", 20))
+	if diwali.Code != "DIWALI20" {
+		t.Errorf("CreateCoupon() code = %q, want it normalized to %q", diwali.Code, "DIWALI20")
+	}
+	for _, code := range []string{"DIWALI20", "diwali20", " DiWaLi20 "} {
+		got, err := repo.GetCouponByCode(code)
+		if err != nil {
+			t.Fatalf("GetCouponByCode(%q) unexpected error: %v", code, err)
+		}
+		AssertCouponEqual(t, got, diwali)
+	}
+
+	if _, err := repo.CreateCoupon(withCode("diwali20", 30)); !errors.Is(err, coupon.ErrAlreadyExists) {
+		t.Errorf("CreateCoupon() with used code error = %v, want %v", err, coupon.ErrAlreadyExists)
+	}
+	// coupons without a code do not conflict with each other
+	plain := mustCreate(t, repo, testCoupon(5))
+	mustCreate(t, repo, testCoupon(5))
+	if _, err := repo.GetCouponByCode(""); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponByCode(\"\") error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+
+	if _, err := repo.UpdateCouponByID(plain.ID, withCode("DIWALI20", 5)); !errors.Is(err, coupon.ErrAlreadyExists) {
+		t.Errorf("UpdateCouponByID() to used code error = %v, want %v", err, coupon.ErrAlreadyExists)
+	}
+	// keeping its own code is not a conflict
+	if _, err := repo.UpdateCouponByID(diwali.ID, withCode("diwali20", 25)); err != nil {
+		t.Fatalf("UpdateCouponByID() with own code unexpected error: %v", err)
+	}
+	// changing the code frees the old one
+	if _, err := repo.UpdateCouponByID(diwali.ID, withCode("NEWYEAR", 25)); err != nil {
+		t.Fatalf("UpdateCouponByID() with new code unexpected error: %v", err)
+	}
+	if _, err := repo.GetCouponByCode("DIWALI20"); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponByCode() of the old code error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if got, err := repo.GetCouponByCode("newyear"); err != nil || got.ID != diwali.ID {
+		t.Errorf("GetCouponByCode() of the new code = %+v, %v", got, err)
+	}
+
+	// deleting frees the code
+	if err := repo.DeleteCouponByID(diwali.ID); err != nil {
+		t.Fatalf("DeleteCouponByID() unexpected error: %v", err)
+	}
+	if _, err := repo.GetCouponByCode("NEWYEAR"); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponByCode() after delete error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	mustCreate(t, repo, withCode("NEWYEAR", 10))
+}
+
+func testSingleUseCodes(t *testing.T, repo coupon.Repository) {
+	c := testCoupon(10)
+	c.Code = "SUMMER"
+	c.RequiresCode = true
+	summer := mustCreate(t, repo, c)
+	other := mustCreate(t, repo, testCoupon(20))
+
+	created, err := repo.CreateCouponCodes(summer.ID, []string{"sc-bbbb", "SC-AAAA", "SC-CCCC"})
+	if err != nil {
+		t.Fatalf("CreateCouponCodes() unexpected error: %v", err)
+	}
+	if len(created) != 3 || created[0].Code != "SC-BBBB" || created[0].CouponID != summer.ID || created[0].IsRedeemed() {
+		t.Errorf("CreateCouponCodes() = %+v", created)
+	}
+
+	conflicts := []struct {
+		name     string
+		couponID int
+		codes    []string
+		expected error
+	}{
+		{name: "used single use code", couponID: other.ID, codes: []string{"SC-DDDD", "sc-aaaa"}, expected: coupon.ErrAlreadyExists},
+		{name: "used coupon code", couponID: other.ID, codes: []string{"summer"}, expected: coupon.ErrAlreadyExists},
+		{name: "duplicate in the batch", couponID: other.ID, codes: []string{"SC-EEEE", "sc-eeee"}, expected: coupon.ErrAlreadyExists},
+		{name: "missing coupon", couponID: 1000, codes: []string{"SC-FFFF"}, expected: coupon.ErrDoesNotExist},
+	}
+	for _, tc := range conflicts {
+		if _, err := repo.CreateCouponCodes(tc.couponID, tc.codes); !errors.Is(err, tc.expected) {
+			t.Errorf("%s: CreateCouponCodes() error = %v, want %v", tc.name, err, tc.expected)
+		}
+	}
+	// a failed batch stores none of its codes
+	for _, code := range []string{"SC-DDDD", "SC-EEEE"} {
+		if _, err := repo.GetCouponCode(code); !errors.Is(err, coupon.ErrDoesNotExist) {
+			t.Errorf("GetCouponCode(%q) after failed batch error = %v, want %v", code, err, coupon.ErrDoesNotExist)
+		}
+	}
+	// the coupon codes and single use codes share the namespace
+	update := testCoupon(20)
+	update.Code = "sc-aaaa"
+	if _, err := repo.UpdateCouponByID(other.ID, update); !errors.Is(err, coupon.ErrAlreadyExists) {
+		t.Errorf("UpdateCouponByID() to a single use code error = %v, want %v", err, coupon.ErrAlreadyExists)
+	}
+	if _, err := repo.CreateCoupon(update); !errors.Is(err, coupon.ErrAlreadyExists) {
+		t.Errorf("CreateCoupon() with a single use code error = %v, want %v", err, coupon.ErrAlreadyExists)
+	}
+
+	codes, err := repo.GetCouponCodes(summer.ID)
+	if err != nil {
+		t.Fatalf("GetCouponCodes() unexpected error: %v", err)
+	}
+	want := []string{"SC-AAAA", "SC-BBBB", "SC-CCCC"}
+	if len(codes) != len(want) {
+		t.Fatalf("GetCouponCodes() = %+v, want %v", codes, want)
+	}
+	for i, code := range codes {
+		if code.Code != want[i] {
+			t.Errorf("GetCouponCodes()[%d] = %q, want %q", i, code.Code, want[i])
+		}
+	}
+	if codes, err := repo.GetCouponCodes(other.ID); err != nil || len(codes) != 0 {
+		t.Errorf("GetCouponCodes() of coupon without codes = %+v, %v", codes, err)
+	}
+
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	redeem := func(couponID int, code string) error {
+		return repo.RecordRedemption(coupon.Redemption{
+			CouponID:   couponID,
+			Code:       code,
+			CartTotal:  100,
+			Discount:   10,
+			RedeemedAt: now,
+		})
+	}
+	steps := []struct {
+		couponID int
+		code     string
+		expected error
+	}{
+		{couponID: summer.ID, code: "sc-aaaa"},
+		{couponID: summer.ID, code: "SC-AAAA", expected: coupon.ErrCodeRedeemed},
+		{couponID: other.ID, code: "SC-BBBB", expected: coupon.ErrDoesNotExist},
+		{couponID: summer.ID, code: "SC-ZZZZ", expected: coupon.ErrDoesNotExist},
+		// the coupon code itself can be used any number of times
+		{couponID: summer.ID, code: "summer"},
+		{couponID: summer.ID, code: "SUMMER"},
+	}
+	for i, step := range steps {
+		if err := redeem(step.couponID, step.code); !errors.Is(err, step.expected) {
+			t.Fatalf("step %d: RecordRedemption() with code %q error = %v, want %v", i, step.code, err, step.expected)
+		}
+	}
+
+	redeemed, err := repo.GetCouponCode("sc-aaaa")
+	if err != nil {
+		t.Fatalf("GetCouponCode() unexpected error: %v", err)
+	}
+	if !redeemed.IsRedeemed() || !redeemed.RedeemedAt.Equal(now) {
+		t.Errorf("GetCouponCode() of redeemed code = %+v, want redeemed at %v", redeemed, now)
+	}
+	if notRedeemed, err := repo.GetCouponCode("SC-BBBB"); err != nil || notRedeemed.IsRedeemed() {
+		t.Errorf("GetCouponCode() of unused code = %+v, %v", notRedeemed, err)
+	}
+	redemptions, err := repo.GetRedemptionsByCouponID(summer.ID)
+	if err != nil {
+		t.Fatalf("GetRedemptionsByCouponID() unexpected error: %v", err)
+	}
+	if len(redemptions) != 3 || redemptions[0].Code != "SC-AAAA" || redemptions[1].Code != "SUMMER" {
+		t.Errorf("GetRedemptionsByCouponID() = %+v", redemptions)
+	}
+
+	// deleting the coupon frees its codes
+	if err := repo.DeleteCouponByID(summer.ID); err != nil {
+		t.Fatalf("DeleteCouponByID() unexpected error: %v", err)
+	}
+	if _, err := repo.GetCouponCode("SC-BBBB"); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponCode() after delete error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if _, err := repo.CreateCouponCodes(other.ID, []string{"SC-BBBB"}); err != nil {
+		t.Errorf("CreateCouponCodes() with a freed code unexpected error: %v", err)
+	}
+}
+
+func testUpdateKeepsSingleUseCodes(t *testing.T, repo coupon.Repository) {
+	c := testCoupon(10)
+	c.Code = "CAMPAIGN"
+	campaign := mustCreate(t, repo, c)
+	if _, err := repo.CreateCouponCodes(campaign.ID, []string{"CMP-1", "CMP-2"}); err != nil {
+		t.Fatalf("CreateCouponCodes() unexpected error: %v", err)
+	}
+
+	// changing the code and the details of the coupon is not a new campaign
+	update := testCoupon(15)
+	update.Code = "CAMPAIGN-2"
+	if _, err := repo.UpdateCouponByID(campaign.ID, update); err != nil {
+		t.Fatalf("UpdateCouponByID() unexpected error: %v", err)
+	}
+	codes, err := repo.GetCouponCodes(campaign.ID)
+	if err != nil {
+		t.Fatalf("GetCouponCodes() unexpected error: %v", err)
+	}
+	if len(codes) != 2 || codes[0].Code != "CMP-1" || codes[1].Code != "CMP-2" {
+		t.Errorf("GetCouponCodes() after update = %+v, want CMP-1 and CMP-2", codes)
+	}
+	if singleUse, err := repo.GetCouponCode("cmp-2"); err != nil || singleUse.CouponID != campaign.ID {
+		t.Errorf("GetCouponCode() after update = %+v, %v", singleUse, err)
+	}
+	// the old code is freed, the single use codes are not
+	if _, err := repo.GetCouponByCode("CAMPAIGN"); !errors.Is(err, coupon.ErrDoesNotExist) {
+		t.Errorf("GetCouponByCode() of the old code error = %v, want %v", err, coupon.ErrDoesNotExist)
+	}
+	if _, err := repo.CreateCouponCodes(campaign.ID, []string{"CMP-1"}); !errors.Is(err, coupon.ErrAlreadyExists) {
+		t.Errorf("CreateCouponCodes() with a kept code error = %v, want %v", err, coupon.ErrAlreadyExists)
+	}
+}
+
+func testRedemptionLimits(t *testing.T, repo coupon.Repository) {
+	c := testCoupon(10)
+	c.MaxTotalUses = 3
+	c.MaxUsesPerCustomer = 2
+	created := mustCreate(t, repo, c)
+	other := mustCreate(t, repo, testCoupon(10))
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		couponID    int
+		customerID  int
+		expectedErr error
+	}{
+		{couponID: created.ID, customerID: 1},
+		{couponID: created.ID, customerID: 1},
+		{couponID: created.ID, customerID: 1, expectedErr: coupon.ErrUsageExhausted},
+		{couponID: created.ID, customerID: 0, expectedErr: coupon.ErrCustomerRequired},
+		{couponID: other.ID, customerID: 0},
+		{couponID: created.ID, customerID: 2},
+		{couponID: created.ID, customerID: 2, expectedErr: coupon.ErrUsageExhausted},
+	}
+	for i, step := range steps {
+		err := repo.RecordRedemption(coupon.Redemption{
+			CouponID:   step.couponID,
+			CustomerID: step.customerID,
+			CartTotal:  100,
+			Discount:   10,
+			RedeemedAt: now.Add(time.Duration(i) * time.Minute),
+			Currency:   money.USD,
+		})
+		if !errors.Is(err, step.expectedErr) {
+			t.Fatalf("step %d: RecordRedemption() error = %v, want %v", i, err, step.expectedErr)
+		}
+	}
+
+	usage, err := repo.GetUsage(created.ID, 1)
+	if err != nil {
+		t.Fatalf("GetUsage() unexpected error: %v", err)
+	}
+	if usage != (coupon.Usage{CustomerID: 1, Total: 3, ByCustomer: 2}) {
+		t.Errorf("GetUsage() = %+v", usage)
+	}
+	usage, err = repo.GetUsage(other.ID, 0)
+	if err != nil {
+		t.Fatalf("GetUsage() unexpected error: %v", err)
+	}
+	if usage != (coupon.Usage{CustomerID: 0, Total: 1, ByCustomer: 0}) {
+		t.Errorf("GetUsage() for anonymous customer = %+v", usage)
+	}
+
+	// the batched read agrees with GetUsage and leaves out the deleted coupons
+	deleted := mustCreate(t, repo, testCoupon(5))
+	if err := repo.DeleteCouponByID(deleted.ID); err != nil {
+		t.Fatalf("DeleteCouponByID() unexpected error: %v", err)
+	}
+	usages, err := repo.GetUsages([]int{created.ID, deleted.ID, other.ID}, 1)
+	if err != nil {
+		t.Fatalf("GetUsages() unexpected error: %v", err)
+	}
+	wantUsages := map[int]coupon.Usage{
+		created.ID: {CustomerID: 1, Total: 3, ByCustomer: 2},
+		other.ID:   {CustomerID: 1, Total: 1, ByCustomer: 0},
+	}
+	if !reflect.DeepEqual(usages, wantUsages) {
+		t.Errorf("GetUsages() = %+v, want %+v", usages, wantUsages)
+	}
+	if usages, err := repo.GetUsages(nil, 1); err != nil || len(usages) != 0 {
+		t.Errorf("GetUsages() of no coupons = %+v, %v, want empty", usages, err)
+	}
+
+	redemptions, err := repo.GetRedemptionsByCouponID(created.ID)
+	if err != nil {
+		t.Fatalf("GetRedemptionsByCouponID() unexpected error: %v", err)
+	}
+	wantCustomers := []int{1, 1, 2}
+	if len(redemptions) != len(wantCustomers) {
+		t.Fatalf("GetRedemptionsByCouponID() = %+v, want %d redemptions", redemptions, len(wantCustomers))
+	}
+	for i, r := range redemptions {
+		if r.CouponID != created.ID || r.CustomerID != wantCustomers[i] || r.CartTotal != 100 || r.Discount != 10 || r.Currency != money.USD {
+			t.Errorf("redemption %d = %+v", i, r)
+		}
+		if i > 0 && r.RedeemedAt.Before(redemptions[i-1].RedeemedAt) {
+			t.Errorf("redemptions are not in the recorded order: %+v", redemptions)
+		}
+	}
+}
+
+func testRecordRedemptions(t *testing.T, repo coupon.Repository) {
+	limited := testCoupon(10)
+	limited.MaxTotalUses = 1
+	once := mustCreate(t, repo, limited)
+	plain := mustCreate(t, repo, testCoupon(20))
+	withCodes := mustCreate(t, repo, testCoupon(30))
+	if _, err := repo.CreateCouponCodes(withCodes.ID, []string{"ALL-1"}); err != nil {
+		t.Fatalf("CreateCouponCodes() unexpected error: %v", err)
+	}
+	now := time.Date(2025, time.October, 20, 12, 0, 0, 0, time.UTC)
+	redemption := func(couponID int, code string) coupon.Redemption {
+		return coupon.Redemption{CouponID: couponID, CustomerID: 1, Code: code, CartTotal: 100, Discount: 10, RedeemedAt: now}
+	}
+
+	failed := []struct {
+		name        string
+		redemptions []coupon.Redemption
+		expectedErr error
+	}{
+		{
+			name:        "limit reached inside the batch",
+			redemptions: []coupon.Redemption{redemption(plain.ID, ""), redemption(withCodes.ID, "all-1"), redemption(once.ID, ""), redemption(once.ID, "")},
+			expectedErr: coupon.ErrUsageExhausted,
+		},
+		{
+			name:        "single use code twice",
+			redemptions: []coupon.Redemption{redemption(withCodes.ID, "ALL-1"), redemption(withCodes.ID, "all-1")},
+			expectedErr: coupon.ErrCodeRedeemed,
+		},
+		{
+			name:        "missing coupon",
+			redemptions: []coupon.Redemption{redemption(plain.ID, ""), redemption(424242, "")},
+			expectedErr: coupon.ErrDoesNotExist,
+		},
+	}
+	for _, tc := range failed {
+		if err := repo.RecordRedemptions(tc.redemptions); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s: RecordRedemptions() error = %v, want %v", tc.name, err, tc.expectedErr)
+		}
+	}
+	// nothing of the failed batches is recorded
+	for _, id := range []int{once.ID, plain.ID, withCodes.ID} {
+		if usage, err := repo.GetUsage(id, 1); err != nil || usage.Total != 0 {
+			t.Errorf("GetUsage(%d) after failed batches = %+v, %v, want unused", id, usage, err)
+		}
+	}
+	if singleUse, err := repo.GetCouponCode("ALL-1"); err != nil || singleUse.IsRedeemed() {
+		t.Errorf("GetCouponCode() after failed batches = %+v, %v, want not redeemed", singleUse, err)
+	}
+
+	if err := repo.RecordRedemptions([]coupon.Redemption{redemption(once.ID, ""), redemption(withCodes.ID, "all-1"), redemption(plain.ID, "")}); err != nil {
+		t.Fatalf("RecordRedemptions() unexpected error: %v", err)
+	}
+	for _, id := range []int{once.ID, plain.ID, withCodes.ID} {
+		if usage, err := repo.GetUsage(id, 1); err != nil || usage.Total != 1 || usage.ByCustomer != 1 {
+			t.Errorf("GetUsage(%d) = %+v, %v, want used once", id, usage, err)
+		}
+	}
+	if singleUse, err := repo.GetCouponCode("ALL-1"); err != nil || !singleUse.RedeemedAt.Equal(now) {
+		t.Errorf("GetCouponCode() = %+v, %v, want redeemed at %v", singleUse, err, now)
+	}
+}
+
+func testConcurrentCreate(t *testing.T, repo coupon.Repository) {
+	ids := make(chan int, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := repo.CreateCoupon(testCoupon(i % 100))
+			if err != nil {
+				t.Errorf("CreateCoupon() unexpected error: %v", err)
+				return
+			}
+			ids <- created.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[int]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("CreateCoupon() assigned id %d twice", id)
+		}
+		seen[id] = true
+	}
+
+	all, err := repo.GetAllCoupons()
+	if err != nil {
+		t.Fatalf("GetAllCoupons() unexpected error: %v", err)
+	}
+	if len(all) != concurrency || len(seen) != concurrency {
+		t.Errorf("got %d coupons and %d ids, want %d", len(all), len(seen), concurrency)
+	}
+}
+
+func testConcurrentUpdate(t *testing.T, repo coupon.Repository) {
+	const coupons = 10
+	ids := make([]int, coupons)
+	for i := range ids {
+		ids[i] = mustCreate(t, repo, testCoupon(0)).ID
+	}
+
+	// every goroutine owns a single coupon and a single threshold,
+	// so after all the updates each coupon should have a threshold written for it
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c := testCoupon(i % 100)
+			c.Details = coupon.CartWiseDetails{Threshold: i, Discount: i % 100}
+			if _, err := repo.UpdateCouponByID(ids[i%coupons], c); err != nil {
+				t.Errorf("UpdateCouponByID() unexpected error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := repo.GetCouponByID(ids[i%coupons]); err != nil {
+				t.Errorf("GetCouponByID() unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		c, err := repo.GetCouponByID(id)
+		if err != nil {
+			t.Fatalf("GetCouponByID() unexpected error: %v", err)
+		}
+		if c.ID != id {
+			t.Errorf("GetCouponByID() id = %d, want %d", c.ID, id)
+		}
+		threshold := c.Details.(coupon.CartWiseDetails).Threshold
+		if threshold%coupons != i {
+			t.Errorf("coupon %d has threshold %d written for another coupon", id, threshold)
+		}
+	}
+}
+
+// testConcurrentIncrement increments the usage of a coupon from every goroutine while the coupon is updated,
+// the usage is read, checked against the limit and written under contention, so a lost increment shows in the count
+func testConcurrentIncrement(t *testing.T, repo coupon.Repository) {
+	c := testCoupon(10)
+	c.MaxTotalUses = concurrency
+	created := mustCreate(t, repo, c)
+
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := repo.RecordRedemption(coupon.Redemption{CouponID: created.ID, CustomerID: i + 1, CartTotal: 100, Discount: 10})
+			if err != nil {
+				t.Errorf("RecordRedemption() unexpected error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			update := testCoupon(i % 100)
+			update.MaxTotalUses = concurrency
+			if _, err := repo.UpdateCouponByID(created.ID, update); err != nil {
+				t.Errorf("UpdateCouponByID() unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	usage, err := repo.GetUsage(created.ID, 0)
+	if err != nil {
+		t.Fatalf("GetUsage() unexpected error: %v", err)
+	}
+	if usage.Total != concurrency {
+		t.Errorf("GetUsage() total = %d, want %d", usage.Total, concurrency)
+	}
+	// the limit is reached exactly, so one more increment is refused
+	err = repo.RecordRedemption(coupon.Redemption{CouponID: created.ID, CustomerID: concurrency + 1})
+	if !errors.Is(err, coupon.ErrUsageExhausted) {
+		t.Errorf("RecordRedemption() over the limit error = %v, want %v", err, coupon.ErrUsageExhausted)
+	}
+}
+
+func testConcurrentRedemption(t *testing.T, repo coupon.Repository) {
+	const maxUses = 50
+	c := testCoupon(10)
+	c.MaxTotalUses = maxUses
+	c.MaxUsesPerCustomer = 1
+	created := mustCreate(t, repo, c)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every customer tries twice, only the first one may succeed
+			err := repo.RecordRedemption(coupon.Redemption{
+				CouponID:   created.ID,
+				CustomerID: i%(concurrency/2) + 1,
+				CartTotal:  100,
+				Discount:   10,
+			})
+			if err != nil {
+				if !errors.Is(err, coupon.ErrUsageExhausted) {
+					t.Errorf("RecordRedemption() unexpected error: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != maxUses {
+		t.Errorf("%d redemptions succeeded, want %d", succeeded, maxUses)
+	}
+	redemptions, err := repo.GetRedemptionsByCouponID(created.ID)
+	if err != nil {
+		t.Fatalf("GetRedemptionsByCouponID() unexpected error: %v", err)
+	}
+	customers := map[int]bool{}
+	for _, r := range redemptions {
+		if customers[r.CustomerID] {
+			t.Errorf("customer %d redeemed more than once", r.CustomerID)
+		}
+		customers[r.CustomerID] = true
+	}
+	if len(redemptions) != maxUses {
+		t.Errorf("ledger has %d redemptions, want %d", len(redemptions), maxUses)
+	}
+}
+
+func testConcurrentFirstOrder(t *testing.T, repo coupon.Repository) {
+	const customers = 10
+	c := testCoupon(10)
+	c.FirstOrderOnly = true
+	created := mustCreate(t, repo, c)
+
+	redemption := coupon.Redemption{CouponID: created.ID, CustomerID: 1, CartTotal: 100, Discount: 10}
+	if err := repo.RecordRedemptions([]coupon.Redemption{redemption, redemption}); !errors.Is(err, coupon.ErrNotFirstOrder) {
+		t.Errorf("RecordRedemptions() twice for a customer error = %v, want %v", err, coupon.ErrNotFirstOrder)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded = map[int]int{}
+	)
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the usage has no redemption of the customer until one is recorded, only that one may succeed
+			redemption := coupon.Redemption{CouponID: created.ID, CustomerID: i%customers + 1, CartTotal: 100, Discount: 10}
+			var err error
+			if i%2 == 0 {
+				err = repo.RecordRedemption(redemption)
+			} else {
+				err = repo.RecordRedemptions([]coupon.Redemption{redemption})
+			}
+			if err != nil {
+				if !errors.Is(err, coupon.ErrNotFirstOrder) {
+					t.Errorf("RecordRedemption() unexpected error: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			succeeded[redemption.CustomerID]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for id := 1; id <= customers; id++ {
+		if succeeded[id] != 1 {
+			t.Errorf("customer %d redeemed %d times, want once", id, succeeded[id])
+		}
+	}
+	if usage, err := repo.GetUsage(created.ID, 1); err != nil || usage.Total != customers {
+		t.Errorf("GetUsage() = %+v, %v, want %d redemptions", usage, err, customers)
+	}
+}
+
+func testConcurrentMixed(t *testing.T, repo coupon.Repository) {
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := repo.CreateCoupon(testCoupon(i % 100))
+			if err != nil {
+				t.Errorf("CreateCoupon() unexpected error: %v", err)
+				return
+			}
+			if _, err := repo.GetAllCoupons(); err != nil {
+				t.Errorf("GetAllCoupons() unexpected error: %v", err)
+			}
+			if _, err := repo.UpdateCouponByID(created.ID, testCoupon(i%50)); err != nil {
+				t.Errorf("UpdateCouponByID() unexpected error: %v", err)
+			}
+			// delete every other coupon
+			if i%2 == 0 {
+				if err := repo.DeleteCouponByID(created.ID); err != nil {
+					t.Errorf("DeleteCouponByID() unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	all, err := repo.GetAllCoupons()
+	if err != nil {
+		t.Fatalf("GetAllCoupons() unexpected error: %v", err)
+	}
+	if len(all) != concurrency/2 {
+		t.Errorf("GetAllCoupons() returned %d coupons, want %d", len(all), concurrency/2)
+	}
+}
@@ -0,0 +1,479 @@
+package coupon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ParasRaba155/monk-commerce-task/utils"
+)
+
+const (
+	logFileName      = "coupons.log"
+	snapshotFileName = "coupons.snapshot"
+
+	// DefaultSnapshotEvery is the number of log entries after which the log is compacted
+	DefaultSnapshotEvery = 1000
+
+	// formatVersion is the version of the log entries and the snapshot the store writes
+	// the ones without a version have the amounts in rupees, they are scaled to the minor unit when read
+	formatVersion = 1
+)
+
+var ErrCorruptStore = errors.New("corrupt coupon store")
+
+type logOp string
+
+const (
+	opCreate logOp = "create"
+	opUpdate logOp = "update"
+	opDelete logOp = "delete"
+	opRedeem logOp = "redeem"
+	// opRedeemAll is the redemptions recorded together, they are applied all or none
+	opRedeemAll logOp = "redeem_all"
+	opCodes     logOp = "codes"
+)
+
+// logEntry is a single write in the append only log
+// Seq is increasing, so the entries which are already part of the snapshot can be skipped
+type logEntry struct {
+	Version     int          `json:"version,omitempty"`
+	Seq         uint64       `json:"seq"`
+	Op          logOp        `json:"op"`
+	ID          int          `json:"id,omitempty"`
+	Coupon      *Coupon      `json:"coupon,omitempty"`
+	Redemption  *Redemption  `json:"redemption,omitempty"`
+	Redemptions []Redemption `json:"redemptions,omitempty"`
+	Codes       []CouponCode `json:"codes,omitempty"`
+}
+
+// snapshot is the compacted state of the repository
+type snapshot struct {
+	Version     int          `json:"version,omitempty"`
+	Seq         uint64       `json:"seq"`
+	NextID      int          `json:"next_id"`
+	Coupons     []Coupon     `json:"coupons"`
+	Codes       []CouponCode `json:"codes"`
+	Redemptions []Redemption `json:"redemptions"`
+}
+
+// fileRepository persists the coupons and the redemption ledger to the local disk
+//
+// Every write is appended to the log and synced before it is applied to the embedded
+// in-memory repository, which serves all the reads. Once the log has snapshotEvery entries
+// the state is written to a new snapshot file which atomically replaces the old one
+// and the log is truncated.
+//
+// Each log line carries a crc32 of the entry, a torn line at the end of the log
+// (crash in the middle of a write) is discarded on recovery.
+type fileRepository struct {
+	*repository
+
+	// mu serializes the writers, so the order in the log is the order of the in-memory state
+	mu            sync.Mutex
+	dir           string
+	log           *os.File
+	logSize       int64 // offset after the last complete entry
+	seq           uint64
+	logEntries    int
+	snapshotEvery int
+}
+
+// NewFileRepository opens or creates the store in dir and recovers the state from it
+// snapshotEvery <= 0 will use DefaultSnapshotEvery
+func NewFileRepository(dir string, snapshotEvery int) (*fileRepository, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+
+	f := &fileRepository{
+		repository:    NewRepository(),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+	}
+	if err := f.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+	f.log = log
+	if err := f.replayLog(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close closes the log file, the repository can not be used afterwards
+func (f *fileRepository) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.log.Close()
+}
+
+// CreateCoupon assigns a new ID, persists and stores the coupon.
+func (f *fileRepository) CreateCoupon(coupon Coupon) (Coupon, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.repository.mu.RLock()
+	coupon.ID = f.repository.nextID
+	coupon.Code = NormalizeCode(coupon.Code)
+	err := f.repository.checkCode(coupon.Code, coupon.ID)
+	f.repository.mu.RUnlock()
+	if err != nil {
+		return Coupon{}, err
+	}
+
+	if err := f.write(logEntry{Op: opCreate, Coupon: &coupon}); err != nil {
+		return Coupon{}, err
+	}
+	return coupon, nil
+}
+
+// UpdateCouponByID persists and replaces the coupon with the new details.
+func (f *fileRepository) UpdateCouponByID(id int, newCoupon Coupon) (Coupon, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.repository.GetCouponByID(id); err != nil {
+		return Coupon{}, err
+	}
+	newCoupon.ID = id // enforce correct ID
+	newCoupon.Code = NormalizeCode(newCoupon.Code)
+	f.repository.mu.RLock()
+	err := f.repository.checkCode(newCoupon.Code, id)
+	f.repository.mu.RUnlock()
+	if err != nil {
+		return Coupon{}, err
+	}
+	if err := f.write(logEntry{Op: opUpdate, Coupon: &newCoupon}); err != nil {
+		return Coupon{}, err
+	}
+	return newCoupon, nil
+}
+
+// DeleteCouponByID persists the removal and removes the coupon from the repository.
+func (f *fileRepository) DeleteCouponByID(id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.repository.GetCouponByID(id); err != nil {
+		return err
+	}
+	return f.write(logEntry{Op: opDelete, ID: id})
+}
+
+// RecordRedemption persists and appends the redemption to the ledger
+// It will fail if the redemption would exceed the usage limits of the coupon
+func (f *fileRepository) RecordRedemption(redemption Redemption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// writers are serialized by f.mu, so nothing can change between the check and the write
+	redemption.Code = NormalizeCode(redemption.Code)
+	f.repository.mu.RLock()
+	err := f.repository.checkRedemption(redemption)
+	f.repository.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return f.write(logEntry{Op: opRedeem, Redemption: &redemption})
+}
+
+// RecordRedemptions persists all the redemptions in a single log entry and appends them to the ledger
+// It will fail without recording any of them if one would exceed the usage limits of its coupon
+func (f *fileRepository) RecordRedemptions(redemptions []Redemption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	redemptions = normalizeRedemptions(redemptions)
+	// the check adds and takes back the redemptions, so it needs the write lock
+	f.repository.mu.Lock()
+	err := f.repository.checkRedemptions(redemptions)
+	f.repository.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return f.write(logEntry{Op: opRedeemAll, Redemptions: redemptions})
+}
+
+// CreateCouponCodes persists and stores the single use codes for the coupon
+// It will fail without storing any code if a code is already used
+func (f *fileRepository) CreateCouponCodes(couponID int, codes []string) ([]CouponCode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.repository.mu.RLock()
+	created, err := f.repository.checkNewCodes(couponID, codes)
+	f.repository.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.write(logEntry{Op: opCodes, Codes: created}); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// write appends the entry to the log, applies it and compacts the log if required
+// the caller must hold f.mu
+func (f *fileRepository) write(entry logEntry) error {
+	entry.Version = formatVersion
+	entry.Seq = f.seq + 1
+	line, err := encodeLogEntry(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := f.log.Write(line); err != nil {
+		f.rollback()
+		return fmt.Errorf("append to log: %w", err)
+	}
+	if err := f.log.Sync(); err != nil {
+		f.rollback()
+		return fmt.Errorf("sync log: %w", err)
+	}
+	f.logSize += int64(len(line))
+	f.seq = entry.Seq
+	f.logEntries++
+	f.repository.apply(entry)
+
+	if f.logEntries >= f.snapshotEvery {
+		// the entry is already durable in the log, a failed compaction is retried on the next write
+		if err := f.compact(); err != nil {
+			slog.Error("coupon store compaction", slog.Any("err", err))
+		}
+	}
+	return nil
+}
+
+// rollback removes a partially written entry, so the next entry does not follow a torn one
+// the caller must hold f.mu
+func (f *fileRepository) rollback() {
+	if err := f.log.Truncate(f.logSize); err != nil {
+		slog.Error("coupon store rollback truncate", slog.Any("err", err))
+	}
+	if _, err := f.log.Seek(f.logSize, io.SeekStart); err != nil {
+		slog.Error("coupon store rollback seek", slog.Any("err", err))
+	}
+}
+
+// compact writes the current state to the snapshot and truncates the log
+// the caller must hold f.mu
+func (f *fileRepository) compact() error {
+	f.repository.mu.RLock()
+	snap := snapshot{
+		Version:     formatVersion,
+		Seq:         f.seq,
+		NextID:      f.repository.nextID,
+		Coupons:     make([]Coupon, 0, len(f.repository.coupons)),
+		Codes:       make([]CouponCode, 0, len(f.repository.singleUseCodes)),
+		Redemptions: f.repository.redemptions,
+	}
+	for _, c := range f.repository.coupons {
+		snap.Coupons = append(snap.Coupons, c)
+	}
+	for _, code := range f.repository.singleUseCodes {
+		snap.Codes = append(snap.Codes, code)
+	}
+	data, err := json.Marshal(snap)
+	f.repository.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	// the snapshot is replaced atomically, so a crash never leaves a partial snapshot
+	if err := utils.WriteFileAtomic(filepath.Join(f.dir, snapshotFileName), data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	// a crash before the truncate is fine, since the entries up to snap.Seq are skipped on replay
+	if err := f.log.Truncate(0); err != nil {
+		return fmt.Errorf("truncate log: %w", err)
+	}
+	if _, err := f.log.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek log: %w", err)
+	}
+	f.logSize = 0
+	f.logEntries = 0
+	return nil
+}
+
+// loadSnapshot restores the state from the snapshot file if there is one
+func (f *fileRepository) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(f.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("%w: snapshot: %w", ErrCorruptStore, err)
+	}
+	if snap.Version == 0 {
+		snap.scaleAmounts(minorPerMajor)
+	}
+	f.seq = snap.Seq
+	for _, c := range snap.Coupons {
+		f.repository.put(c)
+	}
+	f.repository.addCodes(snap.Codes)
+	// the deleted coupons still hold their ids, so the counter can be ahead of the coupons
+	f.repository.nextID = snap.NextID
+	f.repository.redemptions = append(f.repository.redemptions, snap.Redemptions...)
+	return nil
+}
+
+// replayLog applies the log entries which are newer than the snapshot
+// a torn entry at the end of the log is truncated, any other corrupt entry is an error
+func (f *fileRepository) replayLog() error {
+	reader := bufio.NewReader(f.log)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				slog.Warn("coupon store discarding torn log entry", slog.Int64("offset", offset))
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read log: %w", err)
+		}
+
+		entry, err := decodeLogEntry(line)
+		if err != nil {
+			// only the last entry can be torn by a crash
+			if _, peekErr := reader.Peek(1); !errors.Is(peekErr, io.EOF) {
+				return fmt.Errorf("%w: log entry at offset %d: %w", ErrCorruptStore, offset, err)
+			}
+			slog.Warn("coupon store discarding torn log entry", slog.Int64("offset", offset), slog.Any("err", err))
+			break
+		}
+		offset += int64(len(line))
+		f.logEntries++
+		if entry.Seq <= f.seq {
+			continue
+		}
+		f.seq = entry.Seq
+		f.repository.apply(entry)
+	}
+
+	if err := f.log.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate log: %w", err)
+	}
+	if _, err := f.log.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek log: %w", err)
+	}
+	f.logSize = offset
+	return nil
+}
+
+// apply the log entry on the in-memory state
+func (r *repository) apply(entry logEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch entry.Op {
+	case opCreate, opUpdate:
+		r.put(*entry.Coupon)
+	case opDelete:
+		r.remove(entry.ID)
+	case opRedeem:
+		r.addRedemption(*entry.Redemption)
+	case opRedeemAll:
+		for _, redemption := range entry.Redemptions {
+			r.addRedemption(redemption)
+		}
+	case opCodes:
+		r.addCodes(entry.Codes)
+	}
+}
+
+// encodeLogEntry encodes the entry as a line of `<crc32 in hex> <json>\n`
+func encodeLogEntry(entry logEntry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("marshal log entry: %w", err)
+	}
+	return fmt.Appendf(nil, "%08x %s\n", crc32.ChecksumIEEE(data), data), nil
+}
+
+// decodeLogEntry decodes and verifies a line encoded by encodeLogEntry
+func decodeLogEntry(line []byte) (logEntry, error) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	checksum, data, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return logEntry{}, fmt.Errorf("missing checksum")
+	}
+	if string(checksum) != fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)) {
+		return logEntry{}, fmt.Errorf("checksum mismatch")
+	}
+
+	var entry logEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return logEntry{}, err
+	}
+	switch entry.Op {
+	case opCreate, opUpdate:
+		if entry.Coupon == nil {
+			return logEntry{}, fmt.Errorf("%s without coupon", entry.Op)
+		}
+	case opRedeem:
+		if entry.Redemption == nil {
+			return logEntry{}, fmt.Errorf("%s without redemption", entry.Op)
+		}
+	case opRedeemAll:
+		if len(entry.Redemptions) == 0 {
+			return logEntry{}, fmt.Errorf("%s without redemptions", entry.Op)
+		}
+	case opDelete, opCodes:
+	default:
+		return logEntry{}, fmt.Errorf("unknown op %q", entry.Op)
+	}
+	if entry.Version == 0 {
+		entry.scaleAmounts(minorPerMajor)
+	}
+	return entry, nil
+}
+
+// scaleAmounts multiplies the amounts of the entry by factor
+func (e *logEntry) scaleAmounts(factor int) {
+	if e.Coupon != nil {
+		scaled := e.Coupon.scaledAmounts(factor)
+		e.Coupon = &scaled
+	}
+	if e.Redemption != nil {
+		scaled := e.Redemption.scaledAmounts(factor)
+		e.Redemption = &scaled
+	}
+	for i, redemption := range e.Redemptions {
+		e.Redemptions[i] = redemption.scaledAmounts(factor)
+	}
+}
+
+// scaleAmounts multiplies the amounts of the snapshot by factor
+func (s *snapshot) scaleAmounts(factor int) {
+	for i, c := range s.Coupons {
+		s.Coupons[i] = c.scaledAmounts(factor)
+	}
+	for i, redemption := range s.Redemptions {
+		s.Redemptions[i] = redemption.scaledAmounts(factor)
+	}
+}
@@ -0,0 +1,351 @@
+package coupon
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTestFileRepository(t *testing.T, dir string, snapshotEvery int) *fileRepository {
+	t.Helper()
+	repo, err := NewFileRepository(dir, snapshotEvery)
+	if err != nil {
+		t.Fatalf("NewFileRepository() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func testCoupon(discount int) Coupon {
+	return Coupon{
+		Type:    "cart-wise",
+		Details: CartWiseDetails{Threshold: 10, Discount: discount},
+	}
+}
+
+// populate runs a fixed set of writes and returns the id of the redeemed coupon
+func populate(t *testing.T, repo Repository) int {
+	t.Helper()
+	startsAt := time.Date(2025, time.October, 1, 0, 0, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+	coupons := []Coupon{
+		{Code: "FESTIVE", Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}, StartsAt: &startsAt},
+		{Type: "product-wise", Details: ProductWiseDetails{ProductID: 3, Discount: 20}, MaxTotalUses: 5},
+		{Type: "bxgy", Details: BxGyDetails{
+			BuyProducts:     []CouponProduct{{ProductID: 1, Quantity: 2}},
+			GetProducts:     []CouponProduct{{ProductID: 2, Quantity: 1}},
+			RepetitionLimit: 2,
+		}},
+	}
+	ids := make([]int, len(coupons))
+	for i, c := range coupons {
+		created, err := repo.CreateCoupon(c)
+		if err != nil {
+			t.Fatalf("CreateCoupon() unexpected error: %v", err)
+		}
+		ids[i] = created.ID
+	}
+	if _, err := repo.UpdateCouponByID(ids[0], Coupon{Code: "festive15", Type: "cart-wise", Details: CartWiseDetails{Threshold: 200, Discount: 15}}); err != nil {
+		t.Fatalf("UpdateCouponByID() unexpected error: %v", err)
+	}
+	if _, err := repo.CreateCouponCodes(ids[1], []string{"ONCE-A", "ONCE-B"}); err != nil {
+		t.Fatalf("CreateCouponCodes() unexpected error: %v", err)
+	}
+	// the update after the codes keeps them, also when the log is replayed
+	if _, err := repo.UpdateCouponByID(ids[1], Coupon{Type: "product-wise", Details: ProductWiseDetails{ProductID: 3, Discount: 25}, MaxTotalUses: 5}); err != nil {
+		t.Fatalf("UpdateCouponByID() unexpected error: %v", err)
+	}
+	// the codes of the deleted coupon are dropped
+	if _, err := repo.CreateCouponCodes(ids[2], []string{"GONE-A"}); err != nil {
+		t.Fatalf("CreateCouponCodes() unexpected error: %v", err)
+	}
+	if err := repo.DeleteCouponByID(ids[2]); err != nil {
+		t.Fatalf("DeleteCouponByID() unexpected error: %v", err)
+	}
+	for customerID := 1; customerID <= 3; customerID++ {
+		code := ""
+		if customerID == 1 {
+			code = "ONCE-A"
+		}
+		err := repo.RecordRedemption(Redemption{
+			CouponID:   ids[1],
+			CustomerID: customerID,
+			Code:       code,
+			CartTotal:  100,
+			Discount:   20,
+			RedeemedAt: startsAt.Add(time.Duration(customerID) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("RecordRedemption() unexpected error: %v", err)
+		}
+	}
+	err := repo.RecordRedemptions([]Redemption{
+		{CouponID: ids[0], CustomerID: 4, CartTotal: 300, Discount: 45, RedeemedAt: startsAt},
+		{CouponID: ids[1], CustomerID: 4, Code: "once-b", CartTotal: 300, Discount: 20, RedeemedAt: startsAt},
+	})
+	if err != nil {
+		t.Fatalf("RecordRedemptions() unexpected error: %v", err)
+	}
+	return ids[1]
+}
+
+// assertSameState compares everything visible through the Repository interface
+func assertSameState(t *testing.T, want, got Repository, couponID int) {
+	t.Helper()
+	sortByID := func(coupons []Coupon) {
+		slices.SortFunc(coupons, func(a, b Coupon) int { return a.ID - b.ID })
+	}
+	wantCoupons, _ := want.GetAllCoupons()
+	gotCoupons, err := got.GetAllCoupons()
+	if err != nil {
+		t.Fatalf("GetAllCoupons() unexpected error: %v", err)
+	}
+	sortByID(wantCoupons)
+	sortByID(gotCoupons)
+	if len(wantCoupons) != len(gotCoupons) {
+		t.Fatalf("GetAllCoupons() = %+v, want %+v", gotCoupons, wantCoupons)
+	}
+	for i := range wantCoupons {
+		w, g := wantCoupons[i], gotCoupons[i]
+		// time.Time keeps the monotonic clock and location pointer, compare the instants
+		if (w.StartsAt == nil) != (g.StartsAt == nil) || (w.StartsAt != nil && !w.StartsAt.Equal(*g.StartsAt)) {
+			t.Errorf("coupon %d starts_at = %v, want %v", w.ID, g.StartsAt, w.StartsAt)
+		}
+		w.StartsAt, g.StartsAt = nil, nil
+		if !reflect.DeepEqual(w, g) {
+			t.Errorf("coupon = %+v, want %+v", g, w)
+		}
+	}
+
+	wantRedemptions, _ := want.GetRedemptionsByCouponID(couponID)
+	gotRedemptions, err := got.GetRedemptionsByCouponID(couponID)
+	if err != nil {
+		t.Fatalf("GetRedemptionsByCouponID() unexpected error: %v", err)
+	}
+	if len(wantRedemptions) != len(gotRedemptions) {
+		t.Fatalf("GetRedemptionsByCouponID() = %+v, want %+v", gotRedemptions, wantRedemptions)
+	}
+	for i := range wantRedemptions {
+		w, g := wantRedemptions[i], gotRedemptions[i]
+		if !w.RedeemedAt.Equal(g.RedeemedAt) {
+			t.Errorf("redemption redeemed_at = %v, want %v", g.RedeemedAt, w.RedeemedAt)
+		}
+		w.RedeemedAt, g.RedeemedAt = time.Time{}, time.Time{}
+		if w != g {
+			t.Errorf("redemption = %+v, want %+v", g, w)
+		}
+	}
+
+	wantCodes, _ := want.GetCouponCodes(couponID)
+	gotCodes, err := got.GetCouponCodes(couponID)
+	if err != nil {
+		t.Fatalf("GetCouponCodes() unexpected error: %v", err)
+	}
+	if len(wantCodes) != len(gotCodes) {
+		t.Fatalf("GetCouponCodes() = %+v, want %+v", gotCodes, wantCodes)
+	}
+	for i := range wantCodes {
+		w, g := wantCodes[i], gotCodes[i]
+		if w.Code != g.Code || w.CouponID != g.CouponID || w.IsRedeemed() != g.IsRedeemed() ||
+			(w.IsRedeemed() && !w.RedeemedAt.Equal(*g.RedeemedAt)) {
+			t.Errorf("code = %+v, want %+v", g, w)
+		}
+	}
+}
+
+func TestFileRepositoryRecovery(t *testing.T) {
+	tests := []struct {
+		name          string
+		snapshotEvery int
+	}{
+		{name: "log only", snapshotEvery: DefaultSnapshotEvery},
+		{name: "snapshot only", snapshotEvery: 1},
+		{name: "snapshot and log", snapshotEvery: 4},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			memory := NewRepository()
+			couponID := populate(t, memory)
+
+			repo := openTestFileRepository(t, dir, tc.snapshotEvery)
+			populate(t, repo)
+			if err := repo.Close(); err != nil {
+				t.Fatalf("Close() unexpected error: %v", err)
+			}
+
+			reopened := openTestFileRepository(t, dir, tc.snapshotEvery)
+			assertSameState(t, memory, reopened, couponID)
+
+			// the code index is rebuilt as well
+			if _, err := reopened.GetCouponByCode("FESTIVE15"); err != nil {
+				t.Errorf("GetCouponByCode() after recovery unexpected error: %v", err)
+			}
+			if _, err := reopened.CreateCoupon(Coupon{Code: "Festive15", Type: "cart-wise", Details: CartWiseDetails{}}); !errors.Is(err, ErrAlreadyExists) {
+				t.Errorf("CreateCoupon() with recovered code error = %v, want %v", err, ErrAlreadyExists)
+			}
+
+			// the single use codes are recovered as well
+			if _, err := reopened.CreateCoupon(Coupon{Code: "once-b", Type: "cart-wise", Details: CartWiseDetails{}}); !errors.Is(err, ErrAlreadyExists) {
+				t.Errorf("CreateCoupon() with recovered single use code error = %v, want %v", err, ErrAlreadyExists)
+			}
+			if codes, err := reopened.GetCouponCodes(couponID); err != nil || len(codes) != 2 {
+				t.Errorf("GetCouponCodes() after recovery = %+v, %v, want ONCE-A and ONCE-B", codes, err)
+			}
+			if _, err := reopened.GetCouponCode("GONE-A"); !errors.Is(err, ErrDoesNotExist) {
+				t.Errorf("GetCouponCode() of deleted coupon after recovery error = %v, want %v", err, ErrDoesNotExist)
+			}
+
+			// the id counter is recovered as well
+			created, err := reopened.CreateCoupon(testCoupon(5))
+			if err != nil {
+				t.Fatalf("CreateCoupon() unexpected error: %v", err)
+			}
+			if created.ID != 4 {
+				t.Errorf("CreateCoupon() after recovery id = %d, want 4", created.ID)
+			}
+		})
+	}
+}
+
+func TestFileRepositoryTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	memory := NewRepository()
+	couponID := populate(t, memory)
+
+	repo := openTestFileRepository(t, dir, DefaultSnapshotEvery)
+	populate(t, repo)
+	repo.Close()
+
+	// simulate a crash in the middle of appending an entry
+	line, err := encodeLogEntry(logEntry{Seq: 100, Op: opDelete, ID: couponID})
+	if err != nil {
+		t.Fatalf("encodeLogEntry() unexpected error: %v", err)
+	}
+	log, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	log.Write(line[:len(line)/2])
+	log.Close()
+
+	reopened := openTestFileRepository(t, dir, DefaultSnapshotEvery)
+	assertSameState(t, memory, reopened, couponID)
+
+	// new writes go after the last complete entry and survive another restart
+	if err := reopened.DeleteCouponByID(couponID); err != nil {
+		t.Fatalf("DeleteCouponByID() unexpected error: %v", err)
+	}
+	memory.DeleteCouponByID(couponID)
+	reopened.Close()
+
+	assertSameState(t, memory, openTestFileRepository(t, dir, DefaultSnapshotEvery), 1)
+}
+
+func TestFileRepositoryCrashBeforeLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	memory := NewRepository()
+	couponID := populate(t, memory)
+
+	repo := openTestFileRepository(t, dir, DefaultSnapshotEvery)
+	populate(t, repo)
+
+	// the snapshot is written but the crash happens before the log is truncated
+	logPath := filepath.Join(dir, logFileName)
+	logData, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if err := repo.compact(); err != nil {
+		t.Fatalf("compact() unexpected error: %v", err)
+	}
+	repo.Close()
+	if err := os.WriteFile(logPath, logData, 0o644); err != nil {
+		t.Fatalf("restore log: %v", err)
+	}
+
+	// the entries already in the snapshot must not be applied twice
+	assertSameState(t, memory, openTestFileRepository(t, dir, DefaultSnapshotEvery), couponID)
+}
+
+func TestFileRepositoryCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	repo := openTestFileRepository(t, dir, DefaultSnapshotEvery)
+	populate(t, repo)
+	repo.Close()
+
+	// a damaged entry which is followed by other entries is not a torn write
+	logPath := filepath.Join(dir, logFileName)
+	logData, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	logData[len(logData)/3] ^= 0xff
+	if err := os.WriteFile(logPath, logData, 0o644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	if _, err := NewFileRepository(dir, DefaultSnapshotEvery); !errors.Is(err, ErrCorruptStore) {
+		t.Errorf("NewFileRepository() error = %v, want %v", err, ErrCorruptStore)
+	}
+}
+
+func TestFileRepositoryScalesAmountsInRupees(t *testing.T) {
+	dir := t.TempDir()
+	redeemedAt := time.Date(2025, time.October, 20, 9, 30, 0, 0, time.UTC)
+	// the snapshot and the first entry are from before the amounts were in paisa, they have no version
+	snap, err := json.Marshal(snapshot{
+		Seq:         1,
+		NextID:      2,
+		Coupons:     []Coupon{{ID: 1, Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10, MaxDiscount: 50}}},
+		Redemptions: []Redemption{{CouponID: 1, CustomerID: 1, CartTotal: 250, Discount: 25, RedeemedAt: redeemedAt}},
+	})
+	if err != nil {
+		t.Fatalf("marshal snapshot: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotFileName), snap, 0o644); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	var log []byte
+	for _, entry := range []logEntry{
+		{Seq: 2, Op: opCreate, Coupon: &Coupon{ID: 2, Type: "product-wise", Details: ProductWiseDetails{ProductID: 7, Discount: 5, DiscountKind: DiscountFixed}}},
+		{Version: formatVersion, Seq: 3, Op: opCreate, Coupon: &Coupon{ID: 3, Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}}},
+	} {
+		line, err := encodeLogEntry(entry)
+		if err != nil {
+			t.Fatalf("encodeLogEntry() unexpected error: %v", err)
+		}
+		log = append(log, line...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, logFileName), log, 0o644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	repo := openTestFileRepository(t, dir, DefaultSnapshotEvery)
+	expected := map[int]CouponDetails{
+		1: CartWiseDetails{Threshold: 10_000, Discount: 10, MaxDiscount: 5_000},
+		2: ProductWiseDetails{ProductID: 7, Discount: 500, DiscountKind: DiscountFixed},
+		3: CartWiseDetails{Threshold: 100, Discount: 10},
+	}
+	for id, details := range expected {
+		got, err := repo.GetCouponByID(id)
+		if err != nil {
+			t.Fatalf("GetCouponByID(%d) unexpected error: %v", id, err)
+		}
+		if !reflect.DeepEqual(got.Details, details) {
+			t.Errorf("GetCouponByID(%d) details = %+v, want %+v", id, got.Details, details)
+		}
+	}
+	redemptions, err := repo.GetRedemptionsByCouponID(1)
+	if err != nil {
+		t.Fatalf("GetRedemptionsByCouponID() unexpected error: %v", err)
+	}
+	if len(redemptions) != 1 || redemptions[0].CartTotal != 25_000 || redemptions[0].Discount != 2_500 {
+		t.Errorf("GetRedemptionsByCouponID() = %+v, want cart total 25000 and discount 2500", redemptions)
+	}
+}
@@ -1,9 +1,13 @@
 package coupon
 
 import (
+	"encoding/csv"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
@@ -11,23 +15,38 @@ import (
 )
 
 type Repository interface {
-	CreateCoupon(coupon Coupon) error
+	CreateCoupon(coupon Coupon) (Coupon, error)
 	GetAllCoupons() ([]Coupon, error)
 	GetCouponByID(id int) (Coupon, error)
+	GetCouponByCode(code string) (Coupon, error)
 	UpdateCouponByID(id int, newCoupon Coupon) (Coupon, error)
 	DeleteCouponByID(id int) error
+
+	RecordRedemption(redemption Redemption) error
+	// RecordRedemptions records all the redemptions or none of them
+	RecordRedemptions(redemptions []Redemption) error
+	GetUsage(couponID, customerID int) (Usage, error)
+	// GetUsages leaves out the coupons which do not exist
+	GetUsages(couponIDs []int, customerID int) (map[int]Usage, error)
+	GetRedemptionsByCouponID(couponID int) ([]Redemption, error)
+
+	CreateCouponCodes(couponID int, codes []string) ([]CouponCode, error)
+	GetCouponCodes(couponID int) ([]CouponCode, error)
+	GetCouponCode(code string) (CouponCode, error)
 }
 
 type Handler struct {
 	// Repo will give us a abstraction over db/repository layer
 	// mostly the handler directly is not bulky and instead a additional service layer
 	// is created to handle the business logic, however we will have bulky Handler methods for this case
-	Repo Repository
+	Repo  Repository
+	Codes CodeService
 }
 
 func NewHandler(repo Repository) Handler {
 	return Handler{
-		Repo: repo,
+		Repo:  repo,
+		Codes: NewCodeService(repo),
 	}
 }
 
@@ -43,10 +62,13 @@ func (h Handler) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
 	}
 
-	h.Repo.CreateCoupon(Coupon{
-		Type:    CouponType(req.Type),
-		Details: req.Details,
-	})
+	if _, err := h.Repo.CreateCoupon(req.ToCoupon()); err != nil {
+		slog.Error("create coupon db", slog.Any("err", err))
+		if errors.Is(err, ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
 	return c.JSON(http.StatusCreated, utils.GenericSuccess("coupon created"))
 }
 
@@ -95,15 +117,15 @@ func (h Handler) UpdateByID(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
 	}
 
-	updated, err := h.Repo.UpdateCouponByID(id, Coupon{
-		Type:    CouponType(req.Type),
-		Details: req.Details,
-	})
+	updated, err := h.Repo.UpdateCouponByID(id, req.ToCoupon())
 	if err != nil {
 		slog.Error("update coupon by id db", slog.Any("err", err), slog.Int("id", id))
 		if errors.Is(err, ErrDoesNotExist) {
 			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
 		}
+		if errors.Is(err, ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, utils.GenericFailure(err))
+		}
 		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
 	}
 
@@ -126,3 +148,89 @@ func (h Handler) DeleteByID(c echo.Context) error {
 	}
 	return c.JSON(http.StatusNoContent, nil)
 }
+
+func (h Handler) GetRedemptions(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	redemptions, err := h.Repo.GetRedemptionsByCouponID(id)
+	if err != nil {
+		slog.Error("get redemptions by coupon id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(redemptions))
+}
+
+// GenerateCodes creates single use codes for the coupon, the codes can be exported with ExportCodes
+func (h Handler) GenerateCodes(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	var req GenerateCodesReq
+	if err := c.Bind(&req); err != nil {
+		slog.Error("generate codes bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	codes, err := h.Codes.Generate(id, req)
+	if err != nil {
+		slog.Error("generate codes", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) || errors.Is(err, errInvalidGenerateReq) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		if errors.Is(err, ErrAlreadyExists) {
+			return c.JSON(http.StatusConflict, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusCreated, utils.GenericSuccess(map[string]any{
+		"coupon_id": id,
+		"generated": len(codes),
+	}))
+}
+
+// ExportCodes writes the single use codes of the coupon as csv for distribution
+func (h Handler) ExportCodes(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	codes, err := h.Repo.GetCouponCodes(id)
+	if err != nil {
+		slog.Error("export codes db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="coupon-%d-codes.csv"`, id))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	if err := w.Write([]string{"code", "coupon_id", "redeemed", "redeemed_at"}); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		redeemedAt := ""
+		if code.IsRedeemed() {
+			redeemedAt = code.RedeemedAt.Format(time.RFC3339)
+		}
+		record := []string{code.Code, strconv.Itoa(code.CouponID), strconv.FormatBool(code.IsRedeemed()), redeemedAt}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
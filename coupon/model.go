@@ -4,8 +4,17 @@
 package coupon
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/expr"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
 )
 
 type CouponType string
@@ -13,19 +22,81 @@ type CouponType string
 var (
 	errInvalidThreshold   = errors.New("invalid threshold")
 	errInvalidDiscount    = errors.New("invalid discount")
+	errInvalidMaxDiscount = errors.New("invalid max discount")
 	errInvalidProductList = errors.New("invalid product list")
+	errInvalidCategory    = errors.New("invalid category")
+	errInvalidBrand       = errors.New("invalid brand")
+	errInvalidSubtotal    = errors.New("invalid min subtotal")
+	errInvalidTiers       = errors.New("invalid tiers")
+	errInvalidKind        = errors.New("invalid discount kind")
 	errInvalidRepition    = errors.New("invalid repetition limit")
+	errInvalidValidity    = errors.New("invalid validity window")
+	errInvalidUsageLimit  = errors.New("invalid usage limit")
+	errInvalidCode        = errors.New("invalid code")
+	errInvalidStacking    = errors.New("invalid stacking")
+	errInvalidDetails     = errors.New("invalid details")
 )
 
-// couponTypes for all the possible couponTypes
-//
-// NOTE: We have added limited couponTypes here, we can add more types in this slice
-// In real world this would have been kept it in a separate db table/collection
-// And slice would be better choice since we want it to be extensible
-var couponTypes = [...]CouponType{
-	"cart-wise",
-	"product-wise",
-	"bxgy",
+// DiscountKind is how the discount of the cart-wise and product-wise coupons is read
+type DiscountKind string
+
+const (
+	// DiscountPercentage is the discount in percent of the amount, it is the default
+	DiscountPercentage DiscountKind = "percentage"
+	// DiscountFixed is the flat discount in the smallest unit of the currency, e.g. 200 off
+	DiscountFixed DiscountKind = "fixed"
+)
+
+// validate the kind with the discount, the fixed discount can not be more than limit
+// a negative limit means the amount the discount applies to is not known before the cart
+func (k DiscountKind) validate(discount, limit int) error {
+	switch k {
+	case "", DiscountPercentage:
+		if discount < 0 || discount > 100 {
+			return fmt.Errorf("%w, discount must be between 0 and 100%%", errInvalidDiscount)
+		}
+	case DiscountFixed:
+		if discount < 0 {
+			return fmt.Errorf("%w, discount can not be negative", errInvalidDiscount)
+		}
+		if limit >= 0 && discount > limit {
+			return fmt.Errorf("%w, fixed discount %d can not be more than the threshold %d", errInvalidDiscount, discount, limit)
+		}
+	default:
+		return fmt.Errorf("%w: %q, must be %q or %q", errInvalidKind, k, DiscountPercentage, DiscountFixed)
+	}
+	return nil
+}
+
+// DiscountOn gives the discount of the kind on the amount, the percentage is rounded with the rounding
+// and the fixed discount is clamped to the amount
+func (k DiscountKind) DiscountOn(discount int, amount money.Money, rounding money.Rounding) money.Money {
+	if k == DiscountFixed {
+		return money.New(max(min(int64(discount), amount.Amount), 0), amount.Currency)
+	}
+	return amount.Percent(discount, rounding)
+}
+
+// codeRegex is for the normalized code, e.g. DIWALI20 or NEW-YEAR_2026
+var codeRegex = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// the built in coupon types, more types can be added with Register
+const (
+	TypeCartWise     CouponType = "cart-wise"
+	TypeProductWise  CouponType = "product-wise"
+	TypeBxGy         CouponType = "bxgy"
+	TypeCategoryWise CouponType = "category-wise"
+	TypeBrandWise    CouponType = "brand-wise"
+	TypeVolumeTier   CouponType = "volume-tier"
+)
+
+func init() {
+	Register(Definition{Type: TypeCartWise, Decode: DecodeAs[CartWiseDetails]})
+	Register(Definition{Type: TypeProductWise, Decode: DecodeAs[ProductWiseDetails]})
+	Register(Definition{Type: TypeBxGy, Decode: DecodeAs[BxGyDetails]})
+	Register(Definition{Type: TypeCategoryWise, Decode: DecodeAs[CategoryWiseDetails]})
+	Register(Definition{Type: TypeBrandWise, Decode: DecodeAs[BrandWiseDetails]})
+	Register(Definition{Type: TypeVolumeTier, Decode: DecodeAs[VolumeTierDetails]})
 }
 
 type CouponDetails interface {
@@ -33,39 +104,108 @@ type CouponDetails interface {
 	ValidateCoupon() error
 }
 
+// CartWiseTier is the discount for the cart total of at least Threshold
+type CartWiseTier struct {
+	Threshold int `json:"threshold"`
+	Discount  int `json:"discount"`
+}
+
+// CartWiseDetails is either a single Threshold and Discount, or the Tiers,
+// e.g. 5% over 500, 10% over 1000 and 15% over 2000
 type CartWiseDetails struct {
 	Threshold int `json:"threshold"`
 	Discount  int `json:"discount"`
+	// Tiers are ordered by strictly increasing Threshold, the highest reached tier is applied
+	Tiers []CartWiseTier `json:"tiers,omitempty"`
+	// DiscountKind of all the tiers, empty is percentage
+	DiscountKind DiscountKind `json:"discount_kind,omitempty"`
+	// MaxDiscount caps the percentage discount, i.e. 10% off upto 100, zero means no cap
+	MaxDiscount int `json:"max_discount,omitempty"`
 }
 
 func (CartWiseDetails) GetCouponType() CouponType {
-	return couponTypes[0]
+	return TypeCartWise
 }
 
 func (c CartWiseDetails) ValidateCoupon() error {
-	if c.Threshold < 0 {
-		return fmt.Errorf("%w, threshold must be positive", errInvalidThreshold)
+	if len(c.Tiers) > 0 && (c.Threshold != 0 || c.Discount != 0) {
+		return fmt.Errorf("%w: either threshold and discount or tiers can be set", errInvalidTiers)
 	}
-	if c.Discount < 0 || c.Discount > 100 {
-		return fmt.Errorf("%w, discount must be between 0 and 100%%", errInvalidDiscount)
+	tiers := c.EffectiveTiers()
+	for i, tier := range tiers {
+		if tier.Threshold < 0 {
+			return fmt.Errorf("%w, threshold must be positive", errInvalidThreshold)
+		}
+		if i > 0 && tier.Threshold <= tiers[i-1].Threshold {
+			return fmt.Errorf("%w: threshold must be strictly increasing, %d after %d", errInvalidTiers, tier.Threshold, tiers[i-1].Threshold)
+		}
+		// the cart total is at least the threshold, so the fixed discount is never more than the total
+		if err := c.DiscountKind.validate(tier.Discount, tier.Threshold); err != nil {
+			return err
+		}
+	}
+	return validateMaxDiscount(c.DiscountKind, c.MaxDiscount)
+}
+
+// validateMaxDiscount checks the cap, it is only for the percentage discount
+func validateMaxDiscount(kind DiscountKind, maxDiscount int) error {
+	if maxDiscount < 0 {
+		return fmt.Errorf("%w, max discount can not be negative", errInvalidMaxDiscount)
+	}
+	if kind == DiscountFixed && maxDiscount != 0 {
+		return fmt.Errorf("%w, max discount is only for the percentage discount", errInvalidMaxDiscount)
 	}
 	return nil
 }
 
+func (c CartWiseDetails) hasAmounts() bool {
+	return c.Threshold > 0 || len(c.Tiers) > 0 || c.DiscountKind == DiscountFixed || c.MaxDiscount > 0
+}
+
+// EffectiveTiers returns the tiers, the single threshold and discount is the only tier without Tiers
+func (c CartWiseDetails) EffectiveTiers() []CartWiseTier {
+	if len(c.Tiers) > 0 {
+		return c.Tiers
+	}
+	return []CartWiseTier{{Threshold: c.Threshold, Discount: c.Discount}}
+}
+
+// TierFor returns the highest tier the cart total reaches
+// It will return false if the total is below the threshold of the first tier
+func (c CartWiseDetails) TierFor(total money.Money) (CartWiseTier, bool) {
+	tiers := c.EffectiveTiers()
+	for i := len(tiers) - 1; i >= 0; i-- {
+		if total.Amount >= int64(tiers[i].Threshold) {
+			return tiers[i], true
+		}
+	}
+	return CartWiseTier{}, false
+}
+
 type ProductWiseDetails struct {
 	ProductID int `json:"product_id"`
-	Discount  int `json:"discount"`
+	// Discount is on the whole quantity of the product in the cart
+	Discount int `json:"discount"`
+	// DiscountKind is empty for percentage
+	DiscountKind DiscountKind `json:"discount_kind,omitempty"`
+	// MaxDiscount caps the percentage discount, i.e. 10% off upto 100, zero means no cap
+	MaxDiscount int `json:"max_discount,omitempty"`
 }
 
 func (ProductWiseDetails) GetCouponType() CouponType {
-	return couponTypes[1]
+	return TypeProductWise
+}
+
+func (c ProductWiseDetails) hasAmounts() bool {
+	return c.DiscountKind == DiscountFixed || c.MaxDiscount > 0
 }
 
 func (c ProductWiseDetails) ValidateCoupon() error {
-	if c.Discount < 0 || c.Discount > 100 {
-		return fmt.Errorf("%w, discount must be between 0 and 100%%", errInvalidDiscount)
+	// the price of the product is only known with the cart, the calculation clamps a fixed discount to it
+	if err := c.DiscountKind.validate(c.Discount, -1); err != nil {
+		return err
 	}
-	return nil
+	return validateMaxDiscount(c.DiscountKind, c.MaxDiscount)
 }
 
 type BxGyDetails struct {
@@ -75,7 +215,7 @@ type BxGyDetails struct {
 }
 
 func (BxGyDetails) GetCouponType() CouponType {
-	return couponTypes[2]
+	return TypeBxGy
 }
 
 func (c BxGyDetails) ValidateCoupon() error {
@@ -101,13 +241,254 @@ func (c BxGyDetails) ValidateCoupon() error {
 	return nil
 }
 
+// CategoryWiseDetails is the discount on all the items of the category, e.g. 10% off on clothing
+// the category is matched case-insensitive against the category of the products in the catalog
+type CategoryWiseDetails struct {
+	Category string `json:"category"`
+	Discount int    `json:"discount"`
+	// MaxDiscount caps the discount on all the items together, zero means no cap
+	MaxDiscount int `json:"max_discount,omitempty"`
+}
+
+func (c CategoryWiseDetails) hasAmounts() bool {
+	return c.MaxDiscount > 0
+}
+
+func (CategoryWiseDetails) GetCouponType() CouponType {
+	return TypeCategoryWise
+}
+
+func (c CategoryWiseDetails) ValidateCoupon() error {
+	if strings.TrimSpace(c.Category) == "" {
+		return fmt.Errorf("%w: category is required field", errInvalidCategory)
+	}
+	if c.Discount < 0 || c.Discount > 100 {
+		return fmt.Errorf("%w, discount must be between 0 and 100%%", errInvalidDiscount)
+	}
+	if c.MaxDiscount < 0 {
+		return fmt.Errorf("%w, max discount can not be negative", errInvalidMaxDiscount)
+	}
+	return nil
+}
+
+// BrandWiseDetails is the discount on all the items of the brand except the excluded products,
+// e.g. 10% off on all Dell purchases except the clearance ones
+// the brand is matched case-insensitive against the brand of the products in the catalog
+type BrandWiseDetails struct {
+	Brand    string `json:"brand"`
+	Discount int    `json:"discount"`
+	// MaxDiscount caps the discount on all the items together, zero means no cap
+	MaxDiscount int `json:"max_discount,omitempty"`
+	// ExcludedProductIDs are the products of the brand which are not discounted
+	ExcludedProductIDs []int `json:"excluded_product_ids,omitempty"`
+	// MinSubtotal is the total the discounted items of the brand need to reach
+	MinSubtotal int `json:"min_subtotal,omitempty"`
+}
+
+func (BrandWiseDetails) GetCouponType() CouponType {
+	return TypeBrandWise
+}
+
+func (c BrandWiseDetails) hasAmounts() bool {
+	return c.MaxDiscount > 0 || c.MinSubtotal > 0
+}
+
+func (c BrandWiseDetails) ValidateCoupon() error {
+	if strings.TrimSpace(c.Brand) == "" {
+		return fmt.Errorf("%w: brand is required field", errInvalidBrand)
+	}
+	if c.Discount < 0 || c.Discount > 100 {
+		return fmt.Errorf("%w, discount must be between 0 and 100%%", errInvalidDiscount)
+	}
+	if c.MaxDiscount < 0 {
+		return fmt.Errorf("%w, max discount can not be negative", errInvalidMaxDiscount)
+	}
+	if c.MinSubtotal < 0 {
+		return fmt.Errorf("%w, min subtotal can not be negative", errInvalidSubtotal)
+	}
+	for i, id := range c.ExcludedProductIDs {
+		if id < 1 {
+			return fmt.Errorf("%w: excluded product id must be positive", errInvalidProductList)
+		}
+		if slices.Index(c.ExcludedProductIDs, id) != i {
+			return fmt.Errorf("%w: product %d is excluded more than once", errInvalidProductList, id)
+		}
+	}
+	return nil
+}
+
+// VolumeTier is the discount for buying at least MinQuantity
+// a tier runs upto the MinQuantity of the next tier
+type VolumeTier struct {
+	MinQuantity int `json:"min_quantity"`
+	Discount    int `json:"discount"`
+}
+
+// VolumeTierDetails is the discount depending on the quantity bought, e.g. 10% off on 10+, 15% off on 20+
+// the quantity is of the product, or of all the items of the category, exactly one of them is set
+type VolumeTierDetails struct {
+	ProductID int    `json:"product_id,omitempty"`
+	Category  string `json:"category,omitempty"`
+	// Tiers are ordered by strictly increasing MinQuantity
+	Tiers []VolumeTier `json:"tiers"`
+	// MaxDiscount caps the discount on all the items together, zero means no cap
+	MaxDiscount int `json:"max_discount,omitempty"`
+}
+
+func (VolumeTierDetails) GetCouponType() CouponType {
+	return TypeVolumeTier
+}
+
+func (c VolumeTierDetails) hasAmounts() bool {
+	return c.MaxDiscount > 0
+}
+
+func (c VolumeTierDetails) ValidateCoupon() error {
+	hasCategory := strings.TrimSpace(c.Category) != ""
+	if c.ProductID < 0 || (c.ProductID == 0) == !hasCategory {
+		return fmt.Errorf("%w: exactly one of product id and category is required", errInvalidProductList)
+	}
+	if len(c.Tiers) == 0 {
+		return fmt.Errorf("%w: at least one tier is required", errInvalidTiers)
+	}
+	for i, tier := range c.Tiers {
+		if tier.MinQuantity < 1 {
+			return fmt.Errorf("%w: min quantity must be positive", errInvalidTiers)
+		}
+		// tiers are open ended, so strictly increasing min quantities can not overlap
+		if i > 0 && tier.MinQuantity <= c.Tiers[i-1].MinQuantity {
+			return fmt.Errorf("%w: min quantity must be strictly increasing, %d after %d", errInvalidTiers, tier.MinQuantity, c.Tiers[i-1].MinQuantity)
+		}
+		if tier.Discount < 0 || tier.Discount > 100 {
+			return fmt.Errorf("%w, discount must be between 0 and 100%%", errInvalidDiscount)
+		}
+	}
+	if c.MaxDiscount < 0 {
+		return fmt.Errorf("%w, max discount can not be negative", errInvalidMaxDiscount)
+	}
+	return nil
+}
+
+// TierFor returns the highest tier the quantity reaches
+// It will return false if the quantity is below the first tier
+func (c VolumeTierDetails) TierFor(quantity int) (VolumeTier, bool) {
+	for i := len(c.Tiers) - 1; i >= 0; i-- {
+		if quantity >= c.Tiers[i].MinQuantity {
+			return c.Tiers[i], true
+		}
+	}
+	return VolumeTier{}, false
+}
+
 type CouponProduct struct {
 	ProductID int `json:"product_id"`
 	Quantity  int `json:"quantity"`
 }
 
 type Coupon struct {
-	ID      int
-	Type    CouponType
-	Details CouponDetails
+	// ID, Type and Details keep their Go names on the wire, the clients of GET /coupons read them
+	ID int
+	// Code is the optional human readable unique code, it is always stored normalized
+	Code string `json:"code,omitempty"`
+	// RequiresCode coupons are not listed as applicable and can not be applied by ID,
+	// only with Code or one of their generated single use codes
+	RequiresCode bool `json:"requires_code,omitempty"`
+	Type         CouponType
+	Details      CouponDetails
+	// StartsAt and EndsAt bound the validity window of the coupon
+	// nil on either side keeps that side of the window open
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	// MaxTotalUses and MaxUsesPerCustomer limit the redemptions of the coupon
+	// zero means there is no limit
+	MaxTotalUses       int `json:"max_total_uses,omitempty"`
+	MaxUsesPerCustomer int `json:"max_uses_per_customer,omitempty"`
+	// Stackable coupons can be combined with any other coupon which is not exclusive,
+	// a combination can have at most one coupon which is not stackable
+	Stackable bool `json:"stackable,omitempty"`
+	// Exclusive coupons can never be combined with another coupon
+	Exclusive bool `json:"exclusive,omitempty"`
+	// FirstOrderOnly coupons are only for the customers without any completed order,
+	// they are never applicable to an anonymous cart
+	FirstOrderOnly bool `json:"first_order_only,omitempty"`
+	// Currency of the amounts of the coupon, e.g. the fixed discount or threshold
+	// it is optional, see AppliesIn
+	Currency money.Currency `json:"currency,omitempty"`
+	// Conditions is the optional eligibility rule, the cart has to meet it before any discount
+	Conditions *rule.Rule `json:"conditions,omitempty"`
+	// Expression is the optional eligibility expression, e.g. cart.total > 1000, the cart has to meet it too
+	Expression string `json:"expression,omitempty"`
+}
+
+// amountDetails are the details which can have amounts, the amounts are in the currency of the coupon
+type amountDetails interface {
+	hasAmounts() bool
+}
+
+// AppliesIn reports whether the coupon can be applied to the cart of the currency
+// a coupon without currency has its amounts in money.DefaultCurrency,
+// and a coupon without any amount, e.g. a plain percentage, applies in every currency
+// the cart total of the conditions and the amounts read by the expression are amounts too
+func (c Coupon) AppliesIn(currency money.Currency) bool {
+	if c.Currency != "" {
+		return c.Currency == currency
+	}
+	if c.Conditions != nil && c.Conditions.HasAmounts() {
+		return currency == money.DefaultCurrency
+	}
+	if c.Expression != "" {
+		if program, err := expr.CompileCached(c.Expression); err != nil || program.HasAmounts() {
+			return currency == money.DefaultCurrency
+		}
+	}
+	if d, ok := c.Details.(amountDetails); ok && d.hasAmounts() {
+		return currency == money.DefaultCurrency
+	}
+	return true
+}
+
+// NormalizeCode makes the code case-insensitive, shoppers can type diwali20 for DIWALI20
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidateCode checks the normalized code, empty code is valid since the code is optional
+func ValidateCode(code string) error {
+	if code != "" && !codeRegex.MatchString(code) {
+		return fmt.Errorf("%w: code must be 3 to 32 letters, digits, '-' or '_'", errInvalidCode)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the details into the concrete type for the coupon type
+func (c *Coupon) UnmarshalJSON(data []byte) error {
+	// alias does not have the UnmarshalJSON method, and the outer Details shadows the alias one
+	type alias Coupon
+	var raw struct {
+		alias
+		Details json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	details, err := DecodeDetails(raw.Type, raw.Details)
+	if err != nil {
+		return err
+	}
+	*c = Coupon(raw.alias)
+	c.Details = details
+	return nil
+}
+
+// IsActiveAt reports whether the coupon can be used at the given time
+// the window includes StartsAt and excludes EndsAt
+func (c Coupon) IsActiveAt(t time.Time) bool {
+	if c.StartsAt != nil && t.Before(*c.StartsAt) {
+		return false
+	}
+	if c.EndsAt != nil && !t.Before(*c.EndsAt) {
+		return false
+	}
+	return true
 }
@@ -0,0 +1,252 @@
+package coupon
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
+)
+
+func TestValidateCoupon(t *testing.T) {
+	tests := []struct {
+		name        string
+		details     CouponDetails
+		expectedErr error
+	}{
+		{name: "Cart wise without cap", details: CartWiseDetails{Threshold: 100, Discount: 10}},
+		{name: "Cart wise with cap", details: CartWiseDetails{Threshold: 100, Discount: 10, MaxDiscount: 50}},
+		{name: "Cart wise negative cap", details: CartWiseDetails{Threshold: 100, Discount: 10, MaxDiscount: -1}, expectedErr: errInvalidMaxDiscount},
+		{name: "Cart wise discount above 100%", details: CartWiseDetails{Threshold: 100, Discount: 101}, expectedErr: errInvalidDiscount},
+		{name: "Cart wise tiers", details: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}}}},
+		{name: "Cart wise tiers with threshold", details: CartWiseDetails{Threshold: 100, Tiers: []CartWiseTier{{Threshold: 500, Discount: 5}}}, expectedErr: errInvalidTiers},
+		{name: "Cart wise overlapping tiers", details: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 500, Discount: 10}}}, expectedErr: errInvalidTiers},
+		{name: "Cart wise decreasing tiers", details: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 1000, Discount: 10}, {Threshold: 500, Discount: 5}}}, expectedErr: errInvalidTiers},
+		{name: "Cart wise tier negative threshold", details: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: -1, Discount: 5}}}, expectedErr: errInvalidThreshold},
+		{name: "Cart wise tier discount above 100%", details: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 500, Discount: 105}}}, expectedErr: errInvalidDiscount},
+		{name: "Cart wise fixed", details: CartWiseDetails{Threshold: 1500, Discount: 200, DiscountKind: DiscountFixed}},
+		{name: "Cart wise fixed equal to threshold", details: CartWiseDetails{Threshold: 200, Discount: 200, DiscountKind: DiscountFixed}},
+		{name: "Cart wise fixed above threshold", details: CartWiseDetails{Threshold: 100, Discount: 200, DiscountKind: DiscountFixed}, expectedErr: errInvalidDiscount},
+		{name: "Cart wise fixed tier above its threshold", details: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 500, Discount: 50}, {Threshold: 1000, Discount: 1100}}, DiscountKind: DiscountFixed}, expectedErr: errInvalidDiscount},
+		{name: "Cart wise fixed with cap", details: CartWiseDetails{Threshold: 1500, Discount: 200, DiscountKind: DiscountFixed, MaxDiscount: 100}, expectedErr: errInvalidMaxDiscount},
+		{name: "Cart wise unknown kind", details: CartWiseDetails{Threshold: 100, Discount: 10, DiscountKind: "bogus"}, expectedErr: errInvalidKind},
+		{name: "Product wise fixed above 100", details: ProductWiseDetails{ProductID: 7, Discount: 500, DiscountKind: DiscountFixed}},
+		{name: "Product wise fixed negative", details: ProductWiseDetails{ProductID: 7, Discount: -50, DiscountKind: DiscountFixed}, expectedErr: errInvalidDiscount},
+		{name: "Product wise explicit percentage above 100", details: ProductWiseDetails{ProductID: 7, Discount: 500, DiscountKind: DiscountPercentage}, expectedErr: errInvalidDiscount},
+		{name: "Product wise with cap", details: ProductWiseDetails{ProductID: 1, Discount: 20, MaxDiscount: 50}},
+		{name: "Category wise", details: CategoryWiseDetails{Category: "clothing", Discount: 10, MaxDiscount: 100}},
+		{name: "Category wise without category", details: CategoryWiseDetails{Category: "  ", Discount: 10}, expectedErr: errInvalidCategory},
+		{name: "Category wise discount above 100%", details: CategoryWiseDetails{Category: "clothing", Discount: 110}, expectedErr: errInvalidDiscount},
+		{name: "Brand wise", details: BrandWiseDetails{Brand: "Dell", Discount: 10, ExcludedProductIDs: []int{3, 4}, MinSubtotal: 1000}},
+		{name: "Brand wise without brand", details: BrandWiseDetails{Discount: 10}, expectedErr: errInvalidBrand},
+		{name: "Brand wise negative min subtotal", details: BrandWiseDetails{Brand: "Dell", Discount: 10, MinSubtotal: -1}, expectedErr: errInvalidSubtotal},
+		{name: "Brand wise invalid excluded product", details: BrandWiseDetails{Brand: "Dell", Discount: 10, ExcludedProductIDs: []int{0}}, expectedErr: errInvalidProductList},
+		{name: "Brand wise product excluded twice", details: BrandWiseDetails{Brand: "Dell", Discount: 10, ExcludedProductIDs: []int{3, 3}}, expectedErr: errInvalidProductList},
+		{name: "Volume tier of product", details: VolumeTierDetails{ProductID: 1, Tiers: []VolumeTier{{MinQuantity: 10, Discount: 10}, {MinQuantity: 20, Discount: 15}}}},
+		{name: "Volume tier of category", details: VolumeTierDetails{Category: "clothing", Tiers: []VolumeTier{{MinQuantity: 3, Discount: 5}}, MaxDiscount: 100}},
+		{name: "Volume tier without target", details: VolumeTierDetails{Tiers: []VolumeTier{{MinQuantity: 3, Discount: 5}}}, expectedErr: errInvalidProductList},
+		{name: "Volume tier of product and category", details: VolumeTierDetails{ProductID: 1, Category: "clothing", Tiers: []VolumeTier{{MinQuantity: 3, Discount: 5}}}, expectedErr: errInvalidProductList},
+		{name: "Volume tier without tiers", details: VolumeTierDetails{ProductID: 1}, expectedErr: errInvalidTiers},
+		{name: "Volume tier zero min quantity", details: VolumeTierDetails{ProductID: 1, Tiers: []VolumeTier{{MinQuantity: 0, Discount: 5}}}, expectedErr: errInvalidTiers},
+		{name: "Volume tier overlapping tiers", details: VolumeTierDetails{ProductID: 1, Tiers: []VolumeTier{{MinQuantity: 10, Discount: 10}, {MinQuantity: 10, Discount: 15}}}, expectedErr: errInvalidTiers},
+		{name: "Volume tier decreasing tiers", details: VolumeTierDetails{ProductID: 1, Tiers: []VolumeTier{{MinQuantity: 20, Discount: 15}, {MinQuantity: 10, Discount: 10}}}, expectedErr: errInvalidTiers},
+		{name: "Volume tier discount above 100%", details: VolumeTierDetails{ProductID: 1, Tiers: []VolumeTier{{MinQuantity: 10, Discount: 101}}}, expectedErr: errInvalidDiscount},
+		{name: "Product wise negative cap", details: ProductWiseDetails{ProductID: 1, Discount: 20, MaxDiscount: -50}, expectedErr: errInvalidMaxDiscount},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.details.ValidateCoupon()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("ValidateCoupon() error = %v, want %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVolumeTierFor(t *testing.T) {
+	details := VolumeTierDetails{ProductID: 1, Tiers: []VolumeTier{{MinQuantity: 10, Discount: 10}, {MinQuantity: 20, Discount: 15}}}
+	tests := []struct {
+		quantity     int
+		expectedTier VolumeTier
+		expectedOK   bool
+	}{
+		{quantity: 9},
+		{quantity: 10, expectedTier: VolumeTier{MinQuantity: 10, Discount: 10}, expectedOK: true},
+		{quantity: 19, expectedTier: VolumeTier{MinQuantity: 10, Discount: 10}, expectedOK: true},
+		{quantity: 20, expectedTier: VolumeTier{MinQuantity: 20, Discount: 15}, expectedOK: true},
+		{quantity: 500, expectedTier: VolumeTier{MinQuantity: 20, Discount: 15}, expectedOK: true},
+	}
+
+	for _, tc := range tests {
+		tier, ok := details.TierFor(tc.quantity)
+		if tier != tc.expectedTier || ok != tc.expectedOK {
+			t.Errorf("TierFor(%d) = %+v, %v, want %+v, %v", tc.quantity, tier, ok, tc.expectedTier, tc.expectedOK)
+		}
+	}
+}
+
+func TestCartWiseTierFor(t *testing.T) {
+	tiered := CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}, {Threshold: 2000, Discount: 15}}}
+	single := CartWiseDetails{Threshold: 100, Discount: 10}
+	tests := []struct {
+		name         string
+		details      CartWiseDetails
+		total        int
+		expectedTier CartWiseTier
+		expectedOK   bool
+	}{
+		{name: "Below the first tier", details: tiered, total: 499},
+		{name: "First tier", details: tiered, total: 500, expectedTier: CartWiseTier{Threshold: 500, Discount: 5}, expectedOK: true},
+		{name: "Between tiers", details: tiered, total: 1999, expectedTier: CartWiseTier{Threshold: 1000, Discount: 10}, expectedOK: true},
+		{name: "Above the last tier", details: tiered, total: 5000, expectedTier: CartWiseTier{Threshold: 2000, Discount: 15}, expectedOK: true},
+		{name: "Single threshold", details: single, total: 100, expectedTier: CartWiseTier{Threshold: 100, Discount: 10}, expectedOK: true},
+		{name: "Below single threshold", details: single, total: 99},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tier, ok := tc.details.TierFor(money.New(int64(tc.total), money.INR))
+			if tier != tc.expectedTier || ok != tc.expectedOK {
+				t.Errorf("TierFor(%d) = %+v, %v, want %+v, %v", tc.total, tier, ok, tc.expectedTier, tc.expectedOK)
+			}
+		})
+	}
+}
+
+func TestDecodeCartWiseDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected CartWiseDetails
+	}{
+		{
+			name:     "Single threshold",
+			data:     `{"threshold": 100, "discount": 10}`,
+			expected: CartWiseDetails{Threshold: 100, Discount: 10},
+		},
+		{
+			name:     "Tiers",
+			data:     `{"tiers": [{"threshold": 500, "discount": 5}, {"threshold": 1000, "discount": 10}], "max_discount": 300}`,
+			expected: CartWiseDetails{Tiers: []CartWiseTier{{Threshold: 500, Discount: 5}, {Threshold: 1000, Discount: 10}}, MaxDiscount: 300},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeDetails("cart-wise", json.RawMessage(tc.data))
+			if err != nil {
+				t.Fatalf("DecodeDetails() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("DecodeDetails() = %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDiscountOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     DiscountKind
+		discount int
+		amount   int64
+		rounding money.Rounding
+		expected int64
+	}{
+		{name: "Default is percentage", discount: 10, amount: 255, rounding: money.Floor, expected: 25},
+		{name: "Percentage rounded half up", kind: DiscountPercentage, discount: 10, amount: 255, rounding: money.HalfUp, expected: 26},
+		{name: "Percentage rounded half even", kind: DiscountPercentage, discount: 10, amount: 255, rounding: money.HalfEven, expected: 26},
+		{name: "Percentage floor", kind: DiscountPercentage, discount: 50, amount: 99, rounding: money.Floor, expected: 49},
+		{name: "Fixed", kind: DiscountFixed, discount: 200, amount: 1500, expected: 200},
+		{name: "Fixed equal to the amount", kind: DiscountFixed, discount: 200, amount: 200, expected: 200},
+		{name: "Fixed is clamped to the amount", kind: DiscountFixed, discount: 200, amount: 150, expected: 150},
+		{name: "Fixed on nothing", kind: DiscountFixed, discount: 200, amount: 0, expected: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.kind.DiscountOn(tc.discount, money.New(tc.amount, money.INR), tc.rounding)
+			if expected := money.New(tc.expected, money.INR); got != expected {
+				t.Errorf("DiscountOn() = %v, want %v", got, expected)
+			}
+		})
+	}
+}
+
+func TestAppliesIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		coupon   Coupon
+		expected map[money.Currency]bool
+	}{
+		{
+			name:     "Percentage applies in every currency",
+			coupon:   Coupon{Details: CategoryWiseDetails{Category: "books", Discount: 10}},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: true},
+		},
+		{
+			name:     "Buy x get y applies in every currency",
+			coupon:   Coupon{Details: BxGyDetails{RepetitionLimit: 1}},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: true},
+		},
+		{
+			name:     "Amounts without currency are in the default currency",
+			coupon:   Coupon{Details: CartWiseDetails{Threshold: 100, Discount: 10}},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: false},
+		},
+		{
+			name:     "Cap without currency is in the default currency",
+			coupon:   Coupon{Details: CategoryWiseDetails{Category: "books", Discount: 10, MaxDiscount: 50}},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: false},
+		},
+		{
+			name:     "Fixed discount in its currency",
+			coupon:   Coupon{Details: ProductWiseDetails{ProductID: 1, Discount: 5, DiscountKind: DiscountFixed}, Currency: money.USD},
+			expected: map[money.Currency]bool{money.INR: false, money.USD: true},
+		},
+		{
+			name:     "Declared currency limits a percentage",
+			coupon:   Coupon{Details: ProductWiseDetails{ProductID: 1, Discount: 5}, Currency: money.INR},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: false},
+		},
+		{
+			name: "Cart total condition without currency is in the default currency",
+			coupon: Coupon{
+				Details:    ProductWiseDetails{ProductID: 1, Discount: 5},
+				Conditions: &rule.Rule{Condition: rule.Condition{Type: rule.CartTotal, Amount: 1000}},
+			},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: false},
+		},
+		{
+			name: "Conditions without amounts apply in every currency",
+			coupon: Coupon{
+				Details:    ProductWiseDetails{ProductID: 1, Discount: 5},
+				Conditions: &rule.Rule{Condition: rule.Condition{Type: rule.ItemCount, Quantity: 2}},
+			},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: true},
+		},
+		{
+			name:     "Expression reading the cart total without currency is in the default currency",
+			coupon:   Coupon{Details: ProductWiseDetails{ProductID: 1, Discount: 5}, Expression: `cart.total > 1000`},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: false},
+		},
+		{
+			name:     "Expression without amounts applies in every currency",
+			coupon:   Coupon{Details: ProductWiseDetails{ProductID: 1, Discount: 5}, Expression: `cart.item_count >= 3`},
+			expected: map[money.Currency]bool{money.INR: true, money.USD: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for currency, expected := range tc.expected {
+				if got := tc.coupon.AppliesIn(currency); got != expected {
+					t.Errorf("AppliesIn(%s) = %v, want %v", currency, got, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package coupon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+var (
+	ErrUsageExhausted   = errors.New("coupon usage exhausted")
+	ErrCustomerRequired = errors.New("customer is required")
+	ErrNotFirstOrder    = errors.New("coupon is only for the first order")
+)
+
+// Redemption is a single use of a coupon, the ledger is the list of all the redemptions
+type Redemption struct {
+	CouponID int `json:"coupon_id"`
+	// CustomerID is zero for anonymous customers
+	CustomerID int `json:"customer_id"`
+	// Code is the coupon code or the single use code the coupon was applied with, if any
+	Code       string    `json:"code,omitempty"`
+	CartTotal  int       `json:"cart_total"`
+	Discount   int       `json:"discount"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+	// Currency of the cart total and discount
+	Currency money.Currency `json:"currency"`
+}
+
+// Usage is the number of redemptions of a coupon so far, in total and by a single customer
+type Usage struct {
+	CustomerID int
+	Total      int
+	ByCustomer int
+}
+
+// RemainingUses returns how many more times the coupon can be redeemed by the customer of the usage
+// the bool will be false if the coupon does not have any usage limit
+func (c Coupon) RemainingUses(u Usage) (int, bool) {
+	remaining, limited := 0, false
+	if c.MaxTotalUses > 0 {
+		remaining, limited = max(c.MaxTotalUses-u.Total, 0), true
+	}
+	if c.MaxUsesPerCustomer > 0 {
+		// anonymous customer can not be tracked, so they do not get any use of the per customer limit
+		perCustomer := 0
+		if u.CustomerID != 0 {
+			perCustomer = max(c.MaxUsesPerCustomer-u.ByCustomer, 0)
+		}
+		if !limited || perCustomer < remaining {
+			remaining = perCustomer
+		}
+		limited = true
+	}
+	return remaining, limited
+}
+
+// CheckUsage returns error if the coupon can not be redeemed once more with the given usage
+func (c Coupon) CheckUsage(u Usage) error {
+	if c.MaxUsesPerCustomer > 0 && u.CustomerID == 0 {
+		return fmt.Errorf("%w: coupon %d is limited per customer", ErrCustomerRequired, c.ID)
+	}
+	if remaining, limited := c.RemainingUses(u); limited && remaining == 0 {
+		return fmt.Errorf("%w: coupon %d has no remaining uses", ErrUsageExhausted, c.ID)
+	}
+	return nil
+}
+
+// CheckFirstOrder returns error if the coupon is only for the first order and the customer of the usage
+// has already redeemed it, the stores check it with the usage so concurrent redemptions can not both pass
+func (c Coupon) CheckFirstOrder(u Usage) error {
+	if c.FirstOrderOnly && u.ByCustomer > 0 {
+		return fmt.Errorf("%w: coupon %d was already redeemed by customer %d", ErrNotFirstOrder, c.ID, u.CustomerID)
+	}
+	return nil
+}
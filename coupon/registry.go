@@ -0,0 +1,79 @@
+package coupon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ErrUnknownType is returned for the coupon types which are not registered
+var ErrUnknownType = errors.New("unknown coupon type")
+
+// Definition is a coupon type, a new type is added by registering its definition once
+// the details of the type validate themselves with ValidateCoupon
+type Definition struct {
+	Type CouponType
+	// Decode unmarshals the json details into the concrete details of the type
+	Decode func(data json.RawMessage) (CouponDetails, error)
+}
+
+var registry = struct {
+	mu          sync.RWMutex
+	definitions map[CouponType]Definition
+	// types are in the order of registration, so the listing is deterministic
+	types []CouponType
+}{definitions: make(map[CouponType]Definition)}
+
+// Register adds the coupon type, it is meant to be called from an init function
+// It will panic if the type is empty, has no decoder or is already registered
+func Register(def Definition) {
+	if def.Type == "" || def.Decode == nil {
+		panic("coupon: Register of a type without name or decoder")
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.definitions[def.Type]; ok {
+		panic(fmt.Sprintf("coupon: Register of type %q twice", def.Type))
+	}
+	registry.definitions[def.Type] = def
+	registry.types = append(registry.types, def.Type)
+}
+
+// Lookup returns the definition of the registered coupon type
+func Lookup(couponType CouponType) (Definition, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	def, ok := registry.definitions[couponType]
+	if !ok {
+		return Definition{}, fmt.Errorf("%w: %q", ErrUnknownType, couponType)
+	}
+	return def, nil
+}
+
+// Types returns the registered coupon types in the order they were registered
+func Types() []CouponType {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return slices.Clone(registry.types)
+}
+
+// DecodeAs is the decoder of the types with the details T
+func DecodeAs[T CouponDetails](data json.RawMessage) (CouponDetails, error) {
+	var d T
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DecodeDetails unmarshal the details into the concrete type of the given coupon type
+// the stores use it to read back the details they have persisted as json
+func DecodeDetails(couponType CouponType, data json.RawMessage) (CouponDetails, error) {
+	def, err := Lookup(couponType)
+	if err != nil {
+		return nil, err
+	}
+	return def.Decode(data)
+}
@@ -0,0 +1,78 @@
+package coupon
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/expr"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
+)
+
+func TestRegistry(t *testing.T) {
+	builtIn := []CouponType{TypeCartWise, TypeProductWise, TypeBxGy, TypeCategoryWise, TypeBrandWise, TypeVolumeTier}
+	if got := Types(); !slices.Equal(got[:len(builtIn)], builtIn) {
+		t.Errorf("Types() = %v, want to start with %v", got, builtIn)
+	}
+
+	if _, err := Lookup("bogus"); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Lookup() error = %v, want %v", err, ErrUnknownType)
+	}
+	if _, err := DecodeDetails("bogus", []byte(`{}`)); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("DecodeDetails() error = %v, want %v", err, ErrUnknownType)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() of a registered type did not panic")
+		}
+	}()
+	Register(Definition{Type: TypeCartWise, Decode: DecodeAs[CartWiseDetails]})
+}
+
+func TestCreateCouponReqValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         CreateCouponReq
+		expectedErr error
+	}{
+		{name: "Registered type", req: CreateCouponReq{Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}}},
+		{name: "Unknown type", req: CreateCouponReq{Type: "bogus", Details: CartWiseDetails{Threshold: 100, Discount: 10}}, expectedErr: ErrUnknownType},
+		{name: "Details of another type", req: CreateCouponReq{Type: "bxgy", Details: CartWiseDetails{Threshold: 100, Discount: 10}}, expectedErr: errInvalidDetails},
+		{
+			name: "Valid conditions",
+			req: CreateCouponReq{Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}, Conditions: &rule.Rule{
+				Any: []rule.Rule{{Condition: rule.Condition{Type: rule.ItemCount, Quantity: 2}}},
+			}},
+		},
+		{
+			name: "Invalid conditions",
+			req: CreateCouponReq{Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}, Conditions: &rule.Rule{
+				Any: []rule.Rule{},
+			}},
+			expectedErr: rule.ErrInvalidRule,
+		},
+		{
+			name: "Valid expression",
+			req:  CreateCouponReq{Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}, Expression: `count(items, category == "shoes") >= 2`},
+		},
+		{
+			name:        "Expression with syntax error",
+			req:         CreateCouponReq{Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}, Expression: `cart.total >`},
+			expectedErr: expr.ErrSyntax,
+		},
+		{
+			name:        "Expression with type error",
+			req:         CreateCouponReq{Type: "cart-wise", Details: CartWiseDetails{Threshold: 100, Discount: 10}, Expression: `cart.total + 1`},
+			expectedErr: expr.ErrType,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.req.Validate(); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
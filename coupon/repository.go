@@ -3,36 +3,62 @@ package coupon
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 )
 
 var (
-	ErrDoesNotExist = errors.New("no such entity")
+	ErrDoesNotExist  = errors.New("no such entity")
+	ErrAlreadyExists = errors.New("entity already exists")
 )
 
 // repository is the in-memory db
 // coupons are stored by coupon.ID
+// codes is the index of normalized coupon.Code -> coupon.ID
+// singleUseCodes are the generated codes by CouponCode.Code, they share the namespace with codes
+// couponCodes is the index of coupon.ID -> the CouponCode.Code of its single use codes
+// redemptions is the append only ledger of coupon uses
+// mu guards all the fields, so the repository can be shared by concurrent handlers
 type repository struct {
-	coupons map[int]Coupon
-	nextID  int // auto-incrementing ID counter
+	mu             sync.RWMutex
+	coupons        map[int]Coupon
+	codes          map[string]int
+	singleUseCodes map[string]CouponCode
+	couponCodes    map[int][]string
+	redemptions    []Redemption
+	nextID         int // auto-incrementing ID counter, starts at 1 like the sqlite store
 }
 
 func NewRepository() *repository {
 	return &repository{
-		coupons: make(map[int]Coupon, 100),
-		nextID:  0,
+		coupons:        make(map[int]Coupon, 100),
+		codes:          make(map[string]int, 100),
+		singleUseCodes: make(map[string]CouponCode, 100),
+		couponCodes:    make(map[int][]string, 100),
+		redemptions:    make([]Redemption, 0, 100),
+		nextID:         1,
 	}
 }
 
 // CreateCoupon assigns a new ID and stores the coupon.
-func (r *repository) CreateCoupon(coupon Coupon) error {
+// It will fail if the code is already used by another coupon
+func (r *repository) CreateCoupon(coupon Coupon) (Coupon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	coupon.ID = r.nextID
-	r.coupons[coupon.ID] = coupon
-	r.nextID++
-	return nil
+	coupon.Code = NormalizeCode(coupon.Code)
+	if err := r.checkCode(coupon.Code, coupon.ID); err != nil {
+		return Coupon{}, err
+	}
+	r.put(coupon)
+	return coupon, nil
 }
 
 // GetAllCoupons returns all coupons currently in the repository.
 func (r *repository) GetAllCoupons() ([]Coupon, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	result := make([]Coupon, 0, len(r.coupons))
 	for _, c := range r.coupons {
 		result = append(result, c)
@@ -42,6 +68,8 @@ func (r *repository) GetAllCoupons() ([]Coupon, error) {
 
 // GetCouponByID returns the coupon with the given ID.
 func (r *repository) GetCouponByID(id int) (Coupon, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	c, ok := r.coupons[id]
 	if !ok {
 		return Coupon{}, fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, id)
@@ -49,23 +77,322 @@ func (r *repository) GetCouponByID(id int) (Coupon, error) {
 	return c, nil
 }
 
+// GetCouponByCode returns the coupon with the given code, the code is case-insensitive.
+func (r *repository) GetCouponByCode(code string) (Coupon, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.codes[NormalizeCode(code)]
+	if !ok || code == "" {
+		return Coupon{}, fmt.Errorf("%w: no coupon with code %q", ErrDoesNotExist, code)
+	}
+	return r.coupons[id], nil
+}
+
 // UpdateCouponByID replaces the coupon with the new details.
+// It will fail if the new code is already used by another coupon
 func (r *repository) UpdateCouponByID(id int, newCoupon Coupon) (Coupon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	_, ok := r.coupons[id]
 	if !ok {
 		return Coupon{}, fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, id)
 	}
 	newCoupon.ID = id // enforce correct ID
-	r.coupons[id] = newCoupon
+	newCoupon.Code = NormalizeCode(newCoupon.Code)
+	if err := r.checkCode(newCoupon.Code, id); err != nil {
+		return Coupon{}, err
+	}
+	r.put(newCoupon)
 	return newCoupon, nil
 }
 
 // DeleteCouponByID removes the coupon from the repository.
 func (r *repository) DeleteCouponByID(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	_, ok := r.coupons[id]
 	if !ok {
 		return fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, id)
 	}
+	r.remove(id)
+	return nil
+}
+
+// checkCode returns error if the normalized code is used by a coupon other than id
+// the caller must hold the lock
+func (r *repository) checkCode(code string, id int) error {
+	if code == "" {
+		return nil
+	}
+	if existingID, ok := r.codes[code]; ok && existingID != id {
+		return fmt.Errorf("%w: code %q is used by coupon %d", ErrAlreadyExists, code, existingID)
+	}
+	if existing, ok := r.singleUseCodes[code]; ok {
+		return fmt.Errorf("%w: code %q is a single use code of coupon %d", ErrAlreadyExists, code, existing.CouponID)
+	}
+	return nil
+}
+
+// put stores the coupon and keeps the code index and the id counter in sync
+// the single use codes of the coupon are kept, an update does not change them
+// the caller must hold the lock
+func (r *repository) put(coupon Coupon) {
+	if old, ok := r.coupons[coupon.ID]; ok && old.Code != "" {
+		delete(r.codes, old.Code)
+	}
+	r.coupons[coupon.ID] = coupon
+	if coupon.Code != "" {
+		r.codes[coupon.Code] = coupon.ID
+	}
+	r.nextID = max(r.nextID, coupon.ID+1)
+}
+
+// remove deletes the coupon, its code from the index and its single use codes
+// the caller must hold the lock
+func (r *repository) remove(id int) {
+	old, ok := r.coupons[id]
+	if !ok {
+		return
+	}
+	if old.Code != "" {
+		delete(r.codes, old.Code)
+	}
+	for _, code := range r.couponCodes[id] {
+		delete(r.singleUseCodes, code)
+	}
+	delete(r.couponCodes, id)
 	delete(r.coupons, id)
+}
+
+// RecordRedemption appends the redemption to the ledger
+// It will fail if the redemption would exceed the usage limits of the coupon
+// the limits are checked and the redemption is appended under the same lock
+func (r *repository) RecordRedemption(redemption Redemption) error {
+	return r.RecordRedemptions([]Redemption{redemption})
+}
+
+// RecordRedemptions appends all the redemptions to the ledger or none of them
+// It will fail if any redemption would exceed the usage limits of its coupon, counting the ones before it
+func (r *repository) RecordRedemptions(redemptions []Redemption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	redemptions = normalizeRedemptions(redemptions)
+	if err := r.checkRedemptions(redemptions); err != nil {
+		return err
+	}
+	for _, redemption := range redemptions {
+		r.addRedemption(redemption)
+	}
 	return nil
 }
+
+// normalizeRedemptions returns a copy of the redemptions with the normalized codes
+func normalizeRedemptions(redemptions []Redemption) []Redemption {
+	normalized := slices.Clone(redemptions)
+	for i := range normalized {
+		normalized[i].Code = NormalizeCode(normalized[i].Code)
+	}
+	return normalized
+}
+
+// checkRedemptions returns error if any of the redemptions can not be recorded after the ones before it
+// the redemptions are added to check the next ones and are taken back, so the state is left unchanged
+// the caller must hold the write lock
+func (r *repository) checkRedemptions(redemptions []Redemption) error {
+	start := len(r.redemptions)
+	defer r.undoRedemptions(start)
+	for _, redemption := range redemptions {
+		if err := r.checkRedemption(redemption); err != nil {
+			return err
+		}
+		r.addRedemption(redemption)
+	}
+	return nil
+}
+
+// undoRedemptions takes back the redemptions added after start and the single use codes they redeemed
+// the caller must hold the write lock
+func (r *repository) undoRedemptions(start int) {
+	for _, redemption := range r.redemptions[start:] {
+		if singleUse, ok := r.singleUseCodes[redemption.Code]; ok {
+			singleUse.RedeemedAt = nil
+			r.singleUseCodes[redemption.Code] = singleUse
+		}
+	}
+	r.redemptions = r.redemptions[:start]
+}
+
+// checkRedemption returns error if the redemption can not be recorded
+// a single use code must belong to the coupon and must not be redeemed already
+// the caller must hold the lock
+func (r *repository) checkRedemption(redemption Redemption) error {
+	c, ok := r.coupons[redemption.CouponID]
+	if !ok {
+		return fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, redemption.CouponID)
+	}
+	if redemption.Code != "" && redemption.Code != c.Code {
+		singleUse, ok := r.singleUseCodes[redemption.Code]
+		if !ok || singleUse.CouponID != c.ID {
+			return fmt.Errorf("%w: no code %q for coupon %d", ErrDoesNotExist, redemption.Code, c.ID)
+		}
+		if singleUse.IsRedeemed() {
+			return fmt.Errorf("%w: %q", ErrCodeRedeemed, redemption.Code)
+		}
+	}
+	usage := r.usage(redemption.CouponID, redemption.CustomerID)
+	if err := c.CheckUsage(usage); err != nil {
+		return err
+	}
+	return c.CheckFirstOrder(usage)
+}
+
+// addRedemption appends to the ledger and marks the single use code as redeemed
+// the caller must hold the lock
+func (r *repository) addRedemption(redemption Redemption) {
+	if singleUse, ok := r.singleUseCodes[redemption.Code]; ok {
+		redeemedAt := redemption.RedeemedAt
+		singleUse.RedeemedAt = &redeemedAt
+		r.singleUseCodes[redemption.Code] = singleUse
+	}
+	r.redemptions = append(r.redemptions, redemption)
+}
+
+// GetUsage returns the usage of the coupon overall and by the given customer
+func (r *repository) GetUsage(couponID, customerID int) (Usage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.coupons[couponID]; !ok {
+		return Usage{}, fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, couponID)
+	}
+	return r.usage(couponID, customerID), nil
+}
+
+// GetUsages returns the map of couponID -> usage of the coupons overall and by the given customer
+// the coupons which do not exist, e.g. deleted after they were listed, are left out
+func (r *repository) GetUsages(couponIDs []int, customerID int) (map[int]Usage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	usages := make(map[int]Usage, len(couponIDs))
+	for _, id := range couponIDs {
+		if _, ok := r.coupons[id]; ok {
+			usages[id] = Usage{CustomerID: customerID}
+		}
+	}
+	for _, redemption := range r.redemptions {
+		u, ok := usages[redemption.CouponID]
+		if !ok {
+			continue
+		}
+		u.Total++
+		if customerID != 0 && redemption.CustomerID == customerID {
+			u.ByCustomer++
+		}
+		usages[redemption.CouponID] = u
+	}
+	return usages, nil
+}
+
+// GetRedemptionsByCouponID returns the ledger entries of the coupon in the order they were recorded
+func (r *repository) GetRedemptionsByCouponID(couponID int) ([]Redemption, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.coupons[couponID]; !ok {
+		return nil, fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, couponID)
+	}
+	result := make([]Redemption, 0)
+	for _, redemption := range r.redemptions {
+		if redemption.CouponID == couponID {
+			result = append(result, redemption)
+		}
+	}
+	return result, nil
+}
+
+// usage counts the redemptions of the coupon, anonymous redemptions are not counted per customer
+// the caller must hold the lock
+func (r *repository) usage(couponID, customerID int) Usage {
+	u := Usage{CustomerID: customerID}
+	for _, redemption := range r.redemptions {
+		if redemption.CouponID != couponID {
+			continue
+		}
+		u.Total++
+		if customerID != 0 && redemption.CustomerID == customerID {
+			u.ByCustomer++
+		}
+	}
+	return u
+}
+
+// CreateCouponCodes stores the single use codes for the coupon
+// It will fail without storing any code if a code is already used
+func (r *repository) CreateCouponCodes(couponID int, codes []string) ([]CouponCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created, err := r.checkNewCodes(couponID, codes)
+	if err != nil {
+		return nil, err
+	}
+	r.addCodes(created)
+	return created, nil
+}
+
+// GetCouponCodes returns the single use codes of the coupon sorted by code
+func (r *repository) GetCouponCodes(couponID int) ([]CouponCode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.coupons[couponID]; !ok {
+		return nil, fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, couponID)
+	}
+	result := make([]CouponCode, 0, len(r.couponCodes[couponID]))
+	for _, code := range r.couponCodes[couponID] {
+		result = append(result, r.singleUseCodes[code])
+	}
+	slices.SortFunc(result, func(a, b CouponCode) int { return strings.Compare(a.Code, b.Code) })
+	return result, nil
+}
+
+// GetCouponCode returns the single use code, the code is case-insensitive
+func (r *repository) GetCouponCode(code string) (CouponCode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	singleUse, ok := r.singleUseCodes[NormalizeCode(code)]
+	if !ok {
+		return CouponCode{}, fmt.Errorf("%w: no single use code %q", ErrDoesNotExist, code)
+	}
+	return singleUse, nil
+}
+
+// checkNewCodes normalizes the codes and makes sure that none of them is used
+// the caller must hold the lock
+func (r *repository) checkNewCodes(couponID int, codes []string) ([]CouponCode, error) {
+	if _, ok := r.coupons[couponID]; !ok {
+		return nil, fmt.Errorf("%w: no coupon with id %d", ErrDoesNotExist, couponID)
+	}
+	created := make([]CouponCode, len(codes))
+	seen := make(map[string]struct{}, len(codes))
+	for i, code := range codes {
+		code = NormalizeCode(code)
+		if code == "" {
+			return nil, fmt.Errorf("%w: single use code can not be empty", errInvalidCode)
+		}
+		if err := r.checkCode(code, -1); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[code]; ok {
+			return nil, fmt.Errorf("%w: code %q is repeated", ErrAlreadyExists, code)
+		}
+		seen[code] = struct{}{}
+		created[i] = CouponCode{Code: code, CouponID: couponID}
+	}
+	return created, nil
+}
+
+// addCodes stores the checked single use codes
+// the caller must hold the lock
+func (r *repository) addCodes(codes []CouponCode) {
+	for _, code := range codes {
+		r.singleUseCodes[code.Code] = code
+		r.couponCodes[code.CouponID] = append(r.couponCodes[code.CouponID], code.Code)
+	}
+}
@@ -0,0 +1,25 @@
+package coupon_test
+
+import (
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/coupon/coupontest"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	coupontest.RunRepositoryTests(t, func(*testing.T) coupon.Repository {
+		return coupon.NewRepository()
+	})
+}
+
+func TestFileRepositoryConformance(t *testing.T) {
+	coupontest.RunRepositoryTests(t, func(t *testing.T) coupon.Repository {
+		repo, err := coupon.NewFileRepository(t.TempDir(), 100)
+		if err != nil {
+			t.Fatalf("NewFileRepository() unexpected error: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	})
+}
@@ -3,16 +3,42 @@ package coupon
 import (
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/expr"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+	"github.com/ParasRaba155/monk-commerce-task/rule"
 )
 
 type CreateCouponReq struct {
-	Type    string        `json:"type"`
-	Details CouponDetails `json:"details"`
+	// Code is optional and case-insensitive
+	Code         string        `json:"code,omitempty"`
+	RequiresCode bool          `json:"requires_code,omitempty"`
+	Type         string        `json:"type"`
+	Details      CouponDetails `json:"details"`
+	// StartsAt and EndsAt are RFC3339 timestamps, so they always carry a timezone
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	// MaxTotalUses and MaxUsesPerCustomer are optional, zero means unlimited
+	MaxTotalUses       int  `json:"max_total_uses,omitempty"`
+	MaxUsesPerCustomer int  `json:"max_uses_per_customer,omitempty"`
+	Stackable          bool `json:"stackable,omitempty"`
+	Exclusive          bool `json:"exclusive,omitempty"`
+	FirstOrderOnly     bool `json:"first_order_only,omitempty"`
+	// Currency is optional and case-insensitive, it is required to limit a coupon with amounts to a currency other than the default
+	Currency string `json:"currency,omitempty"`
+	// Conditions is the optional eligibility rule of the coupon
+	Conditions *rule.Rule `json:"conditions,omitempty"`
+	// Expression is the optional eligibility expression, it is compiled on create so it is never invalid later
+	Expression string `json:"expression,omitempty"`
 }
 
 // UnmarshalJSON for custom unmarshal for handling coupondetails
 func (r *CreateCouponReq) UnmarshalJSON(data []byte) error {
+	// alias does not have the UnmarshalJSON method, and the outer fields shadow the alias ones
+	type alias CreateCouponReq
 	var raw struct {
+		alias
 		Type    CouponType      `json:"type"`
 		Details json.RawMessage `json:"details"`
 	}
@@ -21,37 +47,18 @@ func (r *CreateCouponReq) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	*r = CreateCouponReq(raw.alias)
 	r.Type = string(raw.Type)
 
 	if raw.Type == "" || raw.Details == nil {
 		return fmt.Errorf("invalid body, required field 'type' and 'details'")
 	}
 
-	switch raw.Type {
-	case couponTypes[0]:
-		var d CartWiseDetails
-		if err := json.Unmarshal(raw.Details, &d); err != nil {
-			return err
-		}
-		r.Details = d
-
-	case couponTypes[1]:
-		var d ProductWiseDetails
-		if err := json.Unmarshal(raw.Details, &d); err != nil {
-			return err
-		}
-		r.Details = d
-
-	case couponTypes[2]:
-		var d BxGyDetails
-		if err := json.Unmarshal(raw.Details, &d); err != nil {
-			return err
-		}
-		r.Details = d
-
-	default:
-		return fmt.Errorf("unsupported coupon type: %s", raw.Type)
+	details, err := DecodeDetails(raw.Type, raw.Details)
+	if err != nil {
+		return err
 	}
+	r.Details = details
 
 	return nil
 }
@@ -64,5 +71,65 @@ func (r CreateCouponReq) Validate() error {
 	if r.Details == nil {
 		return fmt.Errorf("details is required field")
 	}
+	if _, err := Lookup(CouponType(r.Type)); err != nil {
+		return err
+	}
+	if r.Details.GetCouponType() != CouponType(r.Type) {
+		return fmt.Errorf("%w: details of type %q for a %q coupon", errInvalidDetails, r.Details.GetCouponType(), r.Type)
+	}
+	if r.StartsAt != nil && r.EndsAt != nil && !r.EndsAt.After(*r.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", errInvalidValidity)
+	}
+	if err := ValidateCode(NormalizeCode(r.Code)); err != nil {
+		return err
+	}
+	if r.MaxTotalUses < 0 || r.MaxUsesPerCustomer < 0 {
+		return fmt.Errorf("%w: usage limits can not be negative", errInvalidUsageLimit)
+	}
+	if r.Stackable && r.Exclusive {
+		return fmt.Errorf("%w: coupon can not be both stackable and exclusive", errInvalidStacking)
+	}
+	if r.Currency != "" {
+		if _, err := money.ParseCurrency(r.Currency); err != nil {
+			return err
+		}
+	}
+	if r.Conditions != nil {
+		if err := r.Conditions.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Expression != "" {
+		if _, err := expr.Compile(r.Expression); err != nil {
+			return err
+		}
+	}
 	return r.Details.ValidateCoupon()
 }
+
+// ToCoupon converts the request into the coupon entity, the ID is left for the repository
+func (r CreateCouponReq) ToCoupon() Coupon {
+	return Coupon{
+		Code:         NormalizeCode(r.Code),
+		RequiresCode: r.RequiresCode,
+		Type:         CouponType(r.Type),
+		Details:      r.Details,
+		StartsAt:     r.StartsAt,
+		EndsAt:       r.EndsAt,
+
+		MaxTotalUses:       r.MaxTotalUses,
+		MaxUsesPerCustomer: r.MaxUsesPerCustomer,
+		Stackable:          r.Stackable,
+		Exclusive:          r.Exclusive,
+		FirstOrderOnly:     r.FirstOrderOnly,
+		Currency:           currencyOf(r.Currency),
+		Conditions:         r.Conditions,
+		Expression:         r.Expression,
+	}
+}
+
+// currencyOf returns the currency of the validated code, empty for no code
+func currencyOf(code string) money.Currency {
+	currency, _ := money.ParseCurrency(code)
+	return currency
+}
@@ -0,0 +1,67 @@
+package coupon
+
+import "slices"
+
+// minorPerMajor is the number of minor units in a major unit, e.g. paisa in a rupee
+// the amounts were in rupees before they were in the minor unit, the file store scales its older entries by it
+const minorPerMajor = 100
+
+// scalableDetails are the details with amounts, the percentages and the quantities are not scaled
+type scalableDetails interface {
+	scaledAmounts(factor int) CouponDetails
+}
+
+// scaledAmounts returns the coupon with its amounts multiplied by factor
+func (c Coupon) scaledAmounts(factor int) Coupon {
+	if d, ok := c.Details.(scalableDetails); ok {
+		c.Details = d.scaledAmounts(factor)
+	}
+	return c
+}
+
+// scaledAmounts returns the redemption with its amounts multiplied by factor
+func (r Redemption) scaledAmounts(factor int) Redemption {
+	r.CartTotal *= factor
+	r.Discount *= factor
+	return r
+}
+
+func (c CartWiseDetails) scaledAmounts(factor int) CouponDetails {
+	discountFactor := 1
+	if c.DiscountKind == DiscountFixed {
+		discountFactor = factor
+	}
+	c.Threshold *= factor
+	c.Discount *= discountFactor
+	c.Tiers = slices.Clone(c.Tiers)
+	for i := range c.Tiers {
+		c.Tiers[i].Threshold *= factor
+		c.Tiers[i].Discount *= discountFactor
+	}
+	c.MaxDiscount *= factor
+	return c
+}
+
+func (c ProductWiseDetails) scaledAmounts(factor int) CouponDetails {
+	if c.DiscountKind == DiscountFixed {
+		c.Discount *= factor
+	}
+	c.MaxDiscount *= factor
+	return c
+}
+
+func (c CategoryWiseDetails) scaledAmounts(factor int) CouponDetails {
+	c.MaxDiscount *= factor
+	return c
+}
+
+func (c BrandWiseDetails) scaledAmounts(factor int) CouponDetails {
+	c.MaxDiscount *= factor
+	c.MinSubtotal *= factor
+	return c
+}
+
+func (c VolumeTierDetails) scaledAmounts(factor int) CouponDetails {
+	c.MaxDiscount *= factor
+	return c
+}
@@ -0,0 +1,151 @@
+// Package customertest is the conformance suite for the customer.Repository implementations
+//
+// Every implementation should have a test calling RunRepositoryTests, run it with -race
+package customertest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/storetest"
+)
+
+// missingID is an ID no repository under test has a customer for
+const missingID = 1_000_000
+
+// RunRepositoryTests runs the whole suite, newRepo must return a new empty repository on every call
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) customer.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo customer.Repository)
+	}{
+		{name: "crud", test: testCRUD},
+		{name: "round trip of all the fields", test: testRoundTrip},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+	storetest.RunIDTests(t, customers, func(t *testing.T) storetest.Repository[customer.Customer] {
+		return storeRepository(newRepo(t))
+	})
+}
+
+// RunReopenTests checks that a persisted repository keeps the customers, open must return the repository over dir
+func RunReopenTests(t *testing.T, open func(t *testing.T, dir string) customer.Repository) {
+	storetest.RunReopenTests(t, customers, func(t *testing.T, dir string) storetest.Repository[customer.Customer] {
+		return storeRepository(open(t, dir))
+	})
+}
+
+var customers = storetest.Entity[customer.Customer]{
+	Name:            "customer",
+	New:             testCustomer,
+	ID:              func(c customer.Customer) int { return c.ID },
+	ErrDoesNotExist: customer.ErrDoesNotExist,
+	AssertEqual:     AssertCustomerEqual,
+}
+
+func storeRepository(repo customer.Repository) storetest.Repository[customer.Customer] {
+	return storetest.Repository[customer.Customer]{
+		Create: repo.CreateCustomer,
+		Get:    repo.GetCustomerByID,
+		Update: repo.UpdateCustomerByID,
+		Delete: repo.DeleteCustomerByID,
+	}
+}
+
+var createdAt = time.Date(2025, time.October, 20, 9, 30, 0, 0, time.UTC)
+
+func testCustomer(orderCount int) customer.Customer {
+	return customer.Customer{CreatedAt: createdAt, OrderCount: orderCount, Segments: []string{"vip"}, LifetimeSpend: orderCount * 1_000}
+}
+
+func mustCreate(t *testing.T, repo customer.Repository, c customer.Customer) customer.Customer {
+	t.Helper()
+	created, err := repo.CreateCustomer(c)
+	if err != nil {
+		t.Fatalf("CreateCustomer() unexpected error: %v", err)
+	}
+	return created
+}
+
+// AssertCustomerEqual compares the customers, the created dates are compared as instants
+// since the stores may not keep the monotonic clock or the *time.Location
+func AssertCustomerEqual(t *testing.T, got, want customer.Customer) {
+	t.Helper()
+	if !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("customer %d created at %v, want %v", want.ID, got.CreatedAt, want.CreatedAt)
+	}
+	got.CreatedAt, want.CreatedAt = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("customer = %+v, want %+v", got, want)
+	}
+}
+
+func testCRUD(t *testing.T, repo customer.Repository) {
+	first := mustCreate(t, repo, testCustomer(1))
+	second := mustCreate(t, repo, testCustomer(2))
+	if first.ID == second.ID {
+		t.Fatalf("CreateCustomer() assigned the same id %d twice", first.ID)
+	}
+
+	got, err := repo.GetCustomerByID(first.ID)
+	if err != nil {
+		t.Fatalf("GetCustomerByID() unexpected error: %v", err)
+	}
+	AssertCustomerEqual(t, got, first)
+
+	update := testCustomer(5)
+	update.ID = missingID // the id of the path wins over the body
+	update.CreatedAt = time.Time{}
+	updated, err := repo.UpdateCustomerByID(first.ID, update)
+	if err != nil {
+		t.Fatalf("UpdateCustomerByID() unexpected error: %v", err)
+	}
+	// the zero created date keeps the one of the customer
+	want := testCustomer(5)
+	want.ID = first.ID
+	AssertCustomerEqual(t, updated, want)
+	if got, _ := repo.GetCustomerByID(first.ID); got.OrderCount != 5 || !got.CreatedAt.Equal(createdAt) {
+		t.Errorf("GetCustomerByID() after update = %+v, want 5 orders created at %v", got, createdAt)
+	}
+
+	all, err := repo.GetAllCustomers()
+	if err != nil {
+		t.Fatalf("GetAllCustomers() unexpected error: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != first.ID || all[1].ID != second.ID {
+		t.Errorf("GetAllCustomers() = %+v, want both created customers sorted by id", all)
+	}
+
+	if err := repo.DeleteCustomerByID(second.ID); err != nil {
+		t.Fatalf("DeleteCustomerByID() unexpected error: %v", err)
+	}
+	if _, err := repo.GetCustomerByID(second.ID); !errors.Is(err, customer.ErrDoesNotExist) {
+		t.Errorf("GetCustomerByID() after delete error = %v, want %v", err, customer.ErrDoesNotExist)
+	}
+}
+
+func testRoundTrip(t *testing.T, repo customer.Repository) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	customers := []customer.Customer{
+		{CreatedAt: time.Date(2024, time.January, 2, 15, 4, 5, 123_000_000, ist), OrderCount: 12, Segments: []string{"vip", "early-adopter"}, LifetimeSpend: 1_234_567},
+		{CreatedAt: createdAt},
+	}
+	for _, c := range customers {
+		created := mustCreate(t, repo, c)
+		c.ID = created.ID
+		AssertCustomerEqual(t, created, c)
+
+		got, err := repo.GetCustomerByID(created.ID)
+		if err != nil {
+			t.Fatalf("GetCustomerByID() unexpected error: %v", err)
+		}
+		AssertCustomerEqual(t, got, c)
+	}
+}
@@ -0,0 +1,85 @@
+package customer
+
+import (
+	"path/filepath"
+
+	"github.com/ParasRaba155/monk-commerce-task/filestore"
+)
+
+const customersFileName = "customers.json"
+
+// customersFile is the content of the customers file
+// the deleted customers still hold their ids, so the counter can be ahead of the customers
+type customersFile struct {
+	NextID    int        `json:"next_id"`
+	Customers []Customer `json:"customers"`
+}
+
+// fileRepository persists the customers to a JSON file
+//
+// The whole file is replaced atomically on every write and the embedded in-memory
+// repository serves all the reads, same as the catalog of the file store.
+type fileRepository struct {
+	*repository
+	file *filestore.JSON[customersFile]
+}
+
+// NewFileRepository opens or creates the customers in dir
+func NewFileRepository(dir string) (*fileRepository, error) {
+	f := &fileRepository{repository: NewRepository()}
+	file, err := filestore.Open(filepath.Join(dir, customersFileName), customersFile{NextID: 1}, f.state, f.restore)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	return f, nil
+}
+
+// CreateCustomer assigns a new ID, stores and persists the customer.
+func (f *fileRepository) CreateCustomer(customer Customer) (Customer, error) {
+	var created Customer
+	err := f.file.Write(func() (err error) {
+		created, err = f.repository.CreateCustomer(customer)
+		return err
+	})
+	if err != nil {
+		return Customer{}, err
+	}
+	return created, nil
+}
+
+// UpdateCustomerByID replaces and persists the customer with the new details.
+func (f *fileRepository) UpdateCustomerByID(id int, newCustomer Customer) (Customer, error) {
+	var updated Customer
+	err := f.file.Write(func() (err error) {
+		updated, err = f.repository.UpdateCustomerByID(id, newCustomer)
+		return err
+	})
+	if err != nil {
+		return Customer{}, err
+	}
+	return updated, nil
+}
+
+// DeleteCustomerByID removes the customer and persists the removal.
+func (f *fileRepository) DeleteCustomerByID(id int) error {
+	return f.file.Write(func() error {
+		return f.repository.DeleteCustomerByID(id)
+	})
+}
+
+// state is the content of the file for the customers in memory
+func (f *fileRepository) state() customersFile {
+	f.repository.mu.RLock()
+	defer f.repository.mu.RUnlock()
+	state := customersFile{NextID: f.repository.nextID, Customers: make([]Customer, 0, len(f.repository.customers))}
+	for _, c := range f.repository.customers {
+		state.Customers = append(state.Customers, c)
+	}
+	return state
+}
+
+// restore replaces the customers in memory with the ones of the file
+func (f *fileRepository) restore(state customersFile) {
+	f.repository.reset(state.Customers, state.NextID)
+}
@@ -0,0 +1,18 @@
+package customer_test
+
+import (
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/customer/customertest"
+)
+
+func TestFileRepositoryReopen(t *testing.T) {
+	customertest.RunReopenTests(t, func(t *testing.T, dir string) customer.Repository {
+		repo, err := customer.NewFileRepository(dir)
+		if err != nil {
+			t.Fatalf("NewFileRepository() unexpected error: %v", err)
+		}
+		return repo
+	})
+}
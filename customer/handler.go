@@ -0,0 +1,125 @@
+package customer
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ParasRaba155/monk-commerce-task/utils"
+)
+
+type Repository interface {
+	CreateCustomer(customer Customer) (Customer, error)
+	GetAllCustomers() ([]Customer, error)
+	GetCustomerByID(id int) (Customer, error)
+	UpdateCustomerByID(id int, newCustomer Customer) (Customer, error)
+	DeleteCustomerByID(id int) error
+}
+
+type Handler struct {
+	Repo Repository
+	// Clock gives the created date of the customers created without one
+	Clock func() time.Time
+}
+
+func NewHandler(repo Repository) Handler {
+	return Handler{Repo: repo, Clock: time.Now}
+}
+
+// Create stores the customer and responds with it, so the client gets the assigned ID
+func (h Handler) Create(c echo.Context) error {
+	var req CustomerReq
+	if err := c.Bind(&req); err != nil {
+		slog.Error("create customer bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("create customer validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	customer := req.ToCustomer()
+	if customer.CreatedAt.IsZero() {
+		customer.CreatedAt = h.Clock().UTC()
+	}
+	created, err := h.Repo.CreateCustomer(customer)
+	if err != nil {
+		slog.Error("create customer db", slog.Any("err", err))
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusCreated, utils.GenericSuccess(created))
+}
+
+func (h Handler) Get(c echo.Context) error {
+	customers, err := h.Repo.GetAllCustomers()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(customers))
+}
+
+func (h Handler) GetByID(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	customer, err := h.Repo.GetCustomerByID(id)
+	if err != nil {
+		slog.Error("get customer by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(customer))
+}
+
+// UpdateByID replaces the customer as a whole, same as the products
+func (h Handler) UpdateByID(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	var req CustomerReq
+	if err := c.Bind(&req); err != nil {
+		slog.Error("update customer bind error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := req.Validate(); err != nil {
+		slog.Error("update customer validate error", slog.Any("err", err))
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	updated, err := h.Repo.UpdateCustomerByID(id, req.ToCustomer())
+	if err != nil {
+		slog.Error("update customer by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusOK, utils.GenericSuccess(updated))
+}
+
+func (h Handler) DeleteByID(c echo.Context) error {
+	id, err := utils.ParamIDHelper(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+	}
+
+	if err := h.Repo.DeleteCustomerByID(id); err != nil {
+		slog.Error("delete customer by id db", slog.Any("err", err), slog.Int("id", id))
+		if errors.Is(err, ErrDoesNotExist) {
+			return c.JSON(http.StatusBadRequest, utils.GenericFailure(err))
+		}
+		return c.JSON(http.StatusInternalServerError, utils.GenericFailure(err))
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
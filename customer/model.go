@@ -0,0 +1,69 @@
+// Package customer to handle the customers of the carts
+//
+// Including DB and endpoints
+package customer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidOrderCount = errors.New("invalid order count")
+	errInvalidSpend      = errors.New("invalid lifetime spend")
+	errInvalidSegment    = errors.New("invalid segment")
+)
+
+// segmentRegex is for the normalized segment, e.g. vip or early-adopter
+var segmentRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+type Customer struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// OrderCount is the number of the completed orders of the customer
+	OrderCount int `json:"order_count"`
+	// Segments are unique and always stored normalized
+	Segments []string `json:"segments,omitempty"`
+	// LifetimeSpend is the total of the completed orders in the smallest unit of money.DefaultCurrency
+	LifetimeSpend int `json:"lifetime_spend"`
+}
+
+// NormalizeSegments makes the segments case-insensitive and drops the duplicates, the order is kept
+func NormalizeSegments(segments []string) []string {
+	if len(segments) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		segment = strings.ToLower(strings.TrimSpace(segment))
+		if !slices.Contains(result, segment) {
+			result = append(result, segment)
+		}
+	}
+	return result
+}
+
+// Validate the customer with the normalized segments
+func (c Customer) Validate() error {
+	if c.OrderCount < 0 {
+		return fmt.Errorf("%w: order count can not be negative", errInvalidOrderCount)
+	}
+	if c.LifetimeSpend < 0 {
+		return fmt.Errorf("%w: lifetime spend can not be negative", errInvalidSpend)
+	}
+	for _, segment := range c.Segments {
+		if !segmentRegex.MatchString(segment) {
+			return fmt.Errorf("%w: %q, segment must be 1 to 32 letters, digits, '-' or '_'", errInvalidSegment, segment)
+		}
+	}
+	return nil
+}
+
+// InSegment reports whether the customer is in the segment, the segment is case-insensitive
+func (c Customer) InSegment(segment string) bool {
+	return slices.Contains(c.Segments, strings.ToLower(strings.TrimSpace(segment)))
+}
@@ -0,0 +1,107 @@
+package customer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var ErrDoesNotExist = errors.New("no such entity")
+
+// repository is the in-memory db
+// customers are stored by customer.ID
+// mu guards all the fields, so the repository can be shared by concurrent handlers
+type repository struct {
+	mu        sync.RWMutex
+	customers map[int]Customer
+	nextID    int // auto-incrementing ID counter
+}
+
+func NewRepository() *repository {
+	return &repository{
+		customers: make(map[int]Customer, 100),
+		nextID:    1,
+	}
+}
+
+// CreateCustomer assigns a new ID and stores the customer.
+func (r *repository) CreateCustomer(customer Customer) (Customer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	customer.ID = r.nextID
+	customer.Segments = slices.Clone(customer.Segments)
+	r.customers[customer.ID] = customer
+	r.nextID++
+	return customer.clone(), nil
+}
+
+// GetAllCustomers returns all customers sorted by ID.
+func (r *repository) GetAllCustomers() ([]Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]Customer, 0, len(r.customers))
+	for _, c := range r.customers {
+		result = append(result, c.clone())
+	}
+	slices.SortFunc(result, func(a, b Customer) int { return a.ID - b.ID })
+	return result, nil
+}
+
+// GetCustomerByID returns the customer with the given ID.
+func (r *repository) GetCustomerByID(id int) (Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.customers[id]
+	if !ok {
+		return Customer{}, fmt.Errorf("%w: no customer with id %d", ErrDoesNotExist, id)
+	}
+	return c.clone(), nil
+}
+
+// UpdateCustomerByID replaces the customer with the new details.
+// a zero CreatedAt keeps the created date of the customer
+func (r *repository) UpdateCustomerByID(id int, newCustomer Customer) (Customer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.customers[id]
+	if !ok {
+		return Customer{}, fmt.Errorf("%w: no customer with id %d", ErrDoesNotExist, id)
+	}
+	newCustomer.ID = id // enforce correct ID
+	if newCustomer.CreatedAt.IsZero() {
+		newCustomer.CreatedAt = old.CreatedAt
+	}
+	newCustomer.Segments = slices.Clone(newCustomer.Segments)
+	r.customers[id] = newCustomer
+	return newCustomer.clone(), nil
+}
+
+// DeleteCustomerByID removes the customer from the repository.
+func (r *repository) DeleteCustomerByID(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.customers[id]; !ok {
+		return fmt.Errorf("%w: no customer with id %d", ErrDoesNotExist, id)
+	}
+	delete(r.customers, id)
+	return nil
+}
+
+// reset replaces all the customers, the id counter is kept ahead of the customers
+func (r *repository) reset(customers []Customer, nextID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.customers = make(map[int]Customer, len(customers))
+	r.nextID = nextID
+	for _, c := range customers {
+		r.customers[c.ID] = c.clone()
+		r.nextID = max(r.nextID, c.ID+1)
+	}
+}
+
+// clone copies the segments, so the stored customer is not shared with the callers
+func (c Customer) clone() Customer {
+	c.Segments = slices.Clone(c.Segments)
+	return c
+}
@@ -0,0 +1,24 @@
+package customer_test
+
+import (
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/customer/customertest"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	customertest.RunRepositoryTests(t, func(*testing.T) customer.Repository {
+		return customer.NewRepository()
+	})
+}
+
+func TestFileRepositoryConformance(t *testing.T) {
+	customertest.RunRepositoryTests(t, func(t *testing.T) customer.Repository {
+		repo, err := customer.NewFileRepository(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileRepository() unexpected error: %v", err)
+		}
+		return repo
+	})
+}
@@ -0,0 +1,33 @@
+package customer
+
+import "time"
+
+type CustomerReq struct {
+	// CreatedAt is optional, e.g. for the customers imported along with their history,
+	// the customer is created now without it and keeps its created date on update
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	OrderCount int        `json:"order_count,omitempty"`
+	// Segments are optional and case-insensitive
+	Segments      []string `json:"segments,omitempty"`
+	LifetimeSpend int      `json:"lifetime_spend,omitempty"`
+}
+
+// Validate the customer of the request
+func (r CustomerReq) Validate() error {
+	return r.ToCustomer().Validate()
+}
+
+// ToCustomer converts the request into the customer entity, the ID is left for the repository
+// CreatedAt is zero when the request does not have it
+func (r CustomerReq) ToCustomer() Customer {
+	var createdAt time.Time
+	if r.CreatedAt != nil {
+		createdAt = *r.CreatedAt
+	}
+	return Customer{
+		CreatedAt:     createdAt,
+		OrderCount:    r.OrderCount,
+		Segments:      NormalizeSegments(r.Segments),
+		LifetimeSpend: r.LifetimeSpend,
+	}
+}
@@ -0,0 +1,44 @@
+package customer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCustomerReq(t *testing.T) {
+	createdAt := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		req         CustomerReq
+		expected    Customer
+		expectedErr error
+	}{
+		{name: "New customer", req: CustomerReq{}, expected: Customer{}},
+		{
+			name:     "Imported customer",
+			req:      CustomerReq{CreatedAt: &createdAt, OrderCount: 3, Segments: []string{" VIP ", "staff", "vip"}, LifetimeSpend: 4_500},
+			expected: Customer{CreatedAt: createdAt, OrderCount: 3, Segments: []string{"vip", "staff"}, LifetimeSpend: 4_500},
+		},
+		{name: "Negative order count", req: CustomerReq{OrderCount: -1}, expectedErr: errInvalidOrderCount},
+		{name: "Negative lifetime spend", req: CustomerReq{LifetimeSpend: -1}, expectedErr: errInvalidSpend},
+		{name: "Blank segment", req: CustomerReq{Segments: []string{"vip", " "}}, expectedErr: errInvalidSegment},
+		{name: "Invalid segment", req: CustomerReq{Segments: []string{"big spender"}}, expectedErr: errInvalidSegment},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.Validate()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tc.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tc.req.ToCustomer(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("ToCustomer() = %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package expr
+
+import "sync"
+
+// maxCached is the most programs the cache keeps, the cache starts over when it is full
+// the stored coupons have far fewer expressions, so it only starts over if they churn a lot
+const maxCached = 4096
+
+var cache = programCache{programs: make(map[string]*Program)}
+
+// programCache is the compiled programs by source, the programs are immutable so they are shared
+type programCache struct {
+	mu       sync.RWMutex
+	programs map[string]*Program
+}
+
+// CompileCached is Compile for the expressions which are evaluated again and again, e.g. the stored coupons
+// the program of a source is compiled once, the errors are not cached
+func CompileCached(source string) (*Program, error) {
+	cache.mu.RLock()
+	program, ok := cache.programs[source]
+	cache.mu.RUnlock()
+	if ok {
+		return program, nil
+	}
+	program, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if len(cache.programs) >= maxCached {
+		cache.programs = make(map[string]*Program)
+	}
+	cache.programs[source] = program
+	return program, nil
+}
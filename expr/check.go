@@ -0,0 +1,194 @@
+package expr
+
+import "fmt"
+
+// typ is the type of an expression, items is only an argument of the item functions
+type typ int
+
+const (
+	typeInvalid typ = iota
+	typeInt
+	typeBool
+	typeString
+	typeItems
+)
+
+func (t typ) String() string {
+	switch t {
+	case typeInt:
+		return "int"
+	case typeBool:
+		return "bool"
+	case typeString:
+		return "string"
+	case typeItems:
+		return "items"
+	default:
+		return "invalid"
+	}
+}
+
+// cartVars are the variables of the cart
+var cartVars = map[string]typ{
+	"items":            typeItems,
+	"cart.total":       typeInt,
+	"cart.item_count":  typeInt,
+	"cart.currency":    typeString,
+	"cart.day_of_week": typeString,
+	// the customer variables are zero for an anonymous cart
+	"customer.order_count":    typeInt,
+	"customer.lifetime_spend": typeInt,
+}
+
+// itemVars are the variables of the item inside the predicate of an item function
+var itemVars = map[string]typ{
+	"product_id": typeInt,
+	"category":   typeString,
+	"brand":      typeString,
+	"quantity":   typeInt,
+	"price":      typeInt,
+}
+
+// itemFunc is a function over the items, the second argument is evaluated for every item
+type itemFunc struct {
+	// arg is the type of the second argument
+	arg    typ
+	result typ
+}
+
+var itemFuncs = map[string]itemFunc{
+	// count is the number of units of the items matching the predicate
+	"count": {arg: typeBool, result: typeInt},
+	// sum is the sum of the argument over the items
+	"sum": {arg: typeInt, result: typeInt},
+	"any": {arg: typeBool, result: typeBool},
+	"all": {arg: typeBool, result: typeBool},
+}
+
+// check returns the type of the node, inItem is true inside the predicate of an item function
+func check(n node, inItem bool) (typ, error) {
+	switch n := n.(type) {
+	case intLit:
+		return typeInt, nil
+	case stringLit:
+		return typeString, nil
+	case boolLit:
+		return typeBool, nil
+	case ident:
+		if t, ok := cartVars[n.name]; ok {
+			if t == typeItems && inItem {
+				return typeInvalid, typeErrorf(n, "items can not be used inside an item function")
+			}
+			return t, nil
+		}
+		if t, ok := itemVars[n.name]; ok {
+			if !inItem {
+				return typeInvalid, typeErrorf(n, "%s can only be used inside an item function, e.g. count(items, %s ...)", n.name, n.name)
+			}
+			return t, nil
+		}
+		return typeInvalid, typeErrorf(n, "unknown variable %s", n.name)
+	case unary:
+		x, err := check(n.x, inItem)
+		if err != nil {
+			return typeInvalid, err
+		}
+		want := typeBool
+		if n.op == "-" {
+			want = typeInt
+		}
+		if x != want {
+			return typeInvalid, typeErrorf(n, "operator %s needs %s, found %s", n.op, want, x)
+		}
+		return want, nil
+	case binary:
+		return checkBinary(n, inItem)
+	case call:
+		return checkCall(n, inItem)
+	default:
+		return typeInvalid, typeErrorf(n, "unsupported expression")
+	}
+}
+
+func checkBinary(n binary, inItem bool) (typ, error) {
+	x, err := check(n.x, inItem)
+	if err != nil {
+		return typeInvalid, err
+	}
+	y, err := check(n.y, inItem)
+	if err != nil {
+		return typeInvalid, err
+	}
+	switch n.op {
+	case "&&", "||":
+		if x != typeBool || y != typeBool {
+			return typeInvalid, typeErrorf(n, "operator %s needs bool operands, found %s and %s", n.op, x, y)
+		}
+		return typeBool, nil
+	case "==", "!=":
+		if x != y || x == typeItems {
+			return typeInvalid, typeErrorf(n, "can not compare %s with %s", x, y)
+		}
+		return typeBool, nil
+	case "<", "<=", ">", ">=":
+		if x != typeInt || y != typeInt {
+			return typeInvalid, typeErrorf(n, "operator %s needs int operands, found %s and %s", n.op, x, y)
+		}
+		return typeBool, nil
+	default:
+		if x != typeInt || y != typeInt {
+			return typeInvalid, typeErrorf(n, "operator %s needs int operands, found %s and %s", n.op, x, y)
+		}
+		return typeInt, nil
+	}
+}
+
+// stringFuncs are the functions of a single string, by their result
+var stringFuncs = map[string]typ{
+	"lower": typeString,
+	// has_segment is whether the customer is in the segment
+	"has_segment": typeBool,
+}
+
+func checkCall(n call, inItem bool) (typ, error) {
+	if result, ok := stringFuncs[n.name]; ok {
+		if len(n.args) != 1 {
+			return typeInvalid, typeErrorf(n, "%s takes 1 argument, found %d", n.name, len(n.args))
+		}
+		arg, err := check(n.args[0], inItem)
+		if err != nil {
+			return typeInvalid, err
+		}
+		if arg != typeString {
+			return typeInvalid, typeErrorf(n, "%s needs a string, found %s", n.name, arg)
+		}
+		return result, nil
+	}
+
+	f, ok := itemFuncs[n.name]
+	if !ok {
+		return typeInvalid, typeErrorf(n, "unknown function %s", n.name)
+	}
+	if len(n.args) != 2 {
+		return typeInvalid, typeErrorf(n, "%s takes 2 arguments, found %d", n.name, len(n.args))
+	}
+	items, err := check(n.args[0], inItem)
+	if err != nil {
+		return typeInvalid, err
+	}
+	if items != typeItems {
+		return typeInvalid, typeErrorf(n, "first argument of %s must be items, found %s", n.name, items)
+	}
+	arg, err := check(n.args[1], true)
+	if err != nil {
+		return typeInvalid, err
+	}
+	if arg != f.arg {
+		return typeInvalid, typeErrorf(n, "second argument of %s must be %s, found %s", n.name, f.arg, arg)
+	}
+	return f.result, nil
+}
+
+func typeErrorf(n node, format string, args ...any) error {
+	return fmt.Errorf("%w at %d: %s", ErrType, n.position(), fmt.Sprintf(format, args...))
+}
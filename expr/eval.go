@@ -0,0 +1,179 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// value is the result of a node, the field of its type is set
+type value struct {
+	i int64
+	b bool
+	s string
+}
+
+// evaluator evaluates the checked syntax tree, the types are not checked again
+type evaluator struct {
+	env       Env
+	itemCount int64
+	steps     int
+	// item is the current item inside the predicate of an item function
+	item *Item
+}
+
+func (e *evaluator) eval(n node) (value, error) {
+	e.steps++
+	if e.steps > maxSteps {
+		return value{}, fmt.Errorf("%w: more than %d steps", ErrStepLimit, maxSteps)
+	}
+	switch n := n.(type) {
+	case intLit:
+		return value{i: n.value}, nil
+	case stringLit:
+		return value{s: n.value}, nil
+	case boolLit:
+		return value{b: n.value}, nil
+	case ident:
+		return e.variable(n.name), nil
+	case unary:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return value{}, err
+		}
+		if n.op == "-" {
+			return value{i: -x.i}, nil
+		}
+		return value{b: !x.b}, nil
+	case binary:
+		return e.evalBinary(n)
+	case call:
+		return e.evalCall(n)
+	default:
+		return value{}, fmt.Errorf("unsupported expression at %d", n.position())
+	}
+}
+
+func (e *evaluator) variable(name string) value {
+	switch name {
+	case "cart.total":
+		return value{i: e.env.Total}
+	case "cart.item_count":
+		return value{i: e.itemCount}
+	case "cart.currency":
+		return value{s: e.env.Currency}
+	case "cart.day_of_week":
+		return value{s: strings.ToLower(e.env.Now.Weekday().String())}
+	case "customer.order_count":
+		return value{i: int64(e.env.Customer.OrderCount)}
+	case "customer.lifetime_spend":
+		return value{i: e.env.Customer.LifetimeSpend}
+	case "product_id":
+		return value{i: int64(e.item.ProductID)}
+	case "category":
+		return value{s: e.item.Category}
+	case "brand":
+		return value{s: e.item.Brand}
+	case "quantity":
+		return value{i: int64(e.item.Quantity)}
+	case "price":
+		return value{i: e.item.Price}
+	default:
+		// items is only read by the item functions
+		return value{}
+	}
+}
+
+func (e *evaluator) evalBinary(n binary) (value, error) {
+	x, err := e.eval(n.x)
+	if err != nil {
+		return value{}, err
+	}
+	// && and || short circuit
+	switch {
+	case n.op == "&&" && !x.b:
+		return value{b: false}, nil
+	case n.op == "||" && x.b:
+		return value{b: true}, nil
+	}
+	y, err := e.eval(n.y)
+	if err != nil {
+		return value{}, err
+	}
+	switch n.op {
+	case "&&", "||":
+		return value{b: y.b}, nil
+	case "==":
+		return value{b: x == y}, nil
+	case "!=":
+		return value{b: x != y}, nil
+	case "<":
+		return value{b: x.i < y.i}, nil
+	case "<=":
+		return value{b: x.i <= y.i}, nil
+	case ">":
+		return value{b: x.i > y.i}, nil
+	case ">=":
+		return value{b: x.i >= y.i}, nil
+	case "+":
+		return value{i: x.i + y.i}, nil
+	case "-":
+		return value{i: x.i - y.i}, nil
+	case "*":
+		return value{i: x.i * y.i}, nil
+	case "/", "%":
+		if y.i == 0 {
+			return value{}, fmt.Errorf("%w at %d", errDivisionByZero, n.pos)
+		}
+		if n.op == "/" {
+			return value{i: x.i / y.i}, nil
+		}
+		return value{i: x.i % y.i}, nil
+	default:
+		return value{}, fmt.Errorf("unsupported operator %s at %d", n.op, n.pos)
+	}
+}
+
+func (e *evaluator) evalCall(n call) (value, error) {
+	switch n.name {
+	case "lower", "has_segment":
+		arg, err := e.eval(n.args[0])
+		if err != nil {
+			return value{}, err
+		}
+		if n.name == "has_segment" {
+			return value{b: slices.Contains(e.env.Customer.Segments, strings.ToLower(arg.s))}, nil
+		}
+		return value{s: strings.ToLower(arg.s)}, nil
+	}
+
+	var result value
+	if n.name == "all" {
+		result.b = true
+	}
+	for i := range e.env.Items {
+		e.item = &e.env.Items[i]
+		arg, err := e.eval(n.args[1])
+		e.item = nil
+		if err != nil {
+			return value{}, err
+		}
+		switch n.name {
+		case "count":
+			if arg.b {
+				result.i += int64(e.env.Items[i].Quantity)
+			}
+		case "sum":
+			result.i += arg.i
+		case "any":
+			if arg.b {
+				return value{b: true}, nil
+			}
+		case "all":
+			if !arg.b {
+				return value{b: false}, nil
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,133 @@
+// Package expr is the small expression language of the coupon conditions, e.g.
+//
+//	cart.total > 1000 && count(items, category == "shoes") >= 2
+//
+// An expression is compiled once, which parses and type checks it, and is then evaluated on the cart.
+// The language has no loops, no assignment and no access to anything but the cart and its customer,
+// and the evaluation stops after maxSteps, so an expression can not run away with the server.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSyntax is returned by Compile for the expressions which can not be parsed
+	ErrSyntax = errors.New("syntax error")
+	// ErrType is returned by Compile for the expressions which are not well typed or not boolean
+	ErrType = errors.New("type error")
+	// ErrStepLimit is returned by Eval for the evaluations which take more than maxSteps
+	ErrStepLimit = errors.New("expression step limit exceeded")
+
+	errDivisionByZero = errors.New("division by zero")
+)
+
+const (
+	// maxLength is the longest source of an expression
+	maxLength = 1024
+	// maxDepth is the deepest an expression can be nested
+	maxDepth = 32
+	// maxSteps is the most nodes an evaluation can visit, the predicates count once per item
+	maxSteps = 10_000
+)
+
+// Item is the cart item the expression sees
+type Item struct {
+	ProductID int
+	Category  string
+	Brand     string
+	Quantity  int
+	// Price is the price of a unit in the minor unit of the currency
+	Price int64
+}
+
+// Customer is the customer of the cart the expression sees, the zero value is an anonymous customer
+type Customer struct {
+	OrderCount int
+	// LifetimeSpend is the spend of the customer in the minor unit of the default currency
+	LifetimeSpend int64
+	// Segments are lower case
+	Segments []string
+}
+
+// Env is the cart the expression is evaluated on
+type Env struct {
+	// Total is the cart total in the minor unit of the currency
+	Total    int64
+	Currency string
+	Items    []Item
+	Customer Customer
+	// Now is the time of the cart, the day of week is in its location
+	Now time.Time
+}
+
+// Program is a compiled expression, it is safe for concurrent use
+type Program struct {
+	source string
+	root   node
+	// hasAmounts is found once by Compile, see HasAmounts
+	hasAmounts bool
+}
+
+// Compile parses and type checks the source, the expression has to be boolean
+func Compile(source string) (*Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("%w: empty expression", ErrSyntax)
+	}
+	if len(source) > maxLength {
+		return nil, fmt.Errorf("%w: expression is longer than %d bytes", ErrSyntax, maxLength)
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := check(root, false)
+	if err != nil {
+		return nil, err
+	}
+	if typ != typeBool {
+		return nil, fmt.Errorf("%w: expression is %s, must be bool", ErrType, typ)
+	}
+	return &Program{source: source, root: root, hasAmounts: hasAmounts(root)}, nil
+}
+
+// String returns the source of the program
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the program on the cart
+// It will return an error if the evaluation takes more than maxSteps or divides by zero
+func (p *Program) Eval(env Env) (bool, error) {
+	e := evaluator{env: env}
+	for _, item := range env.Items {
+		e.itemCount += int64(item.Quantity)
+	}
+	v, err := e.eval(p.root)
+	if err != nil {
+		return false, err
+	}
+	return v.b, nil
+}
+
+// HasAmounts reports whether the program reads an amount, i.e. cart.total, price or customer.lifetime_spend
+func (p *Program) HasAmounts() bool {
+	return p.hasAmounts
+}
+
+func hasAmounts(root node) bool {
+	found := false
+	walk(root, func(n node) {
+		if id, ok := n.(ident); ok && (id.name == "cart.total" || id.name == "price" || id.name == "customer.lifetime_spend") {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,189 @@
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		expectedErr error
+	}{
+		{name: "Comparison", source: `cart.total > 1000`},
+		{name: "Item function", source: `cart.total > 1000 && count(items, category == "shoes") >= 2`},
+		{name: "Nested operators", source: `!(cart.item_count < 3 || sum(items, price * quantity) % 2 == 1) && -cart.total <= 0`},
+		{name: "All functions", source: `any(items, lower(brand) == "acme") || all(items, product_id != 7 && quantity > 0)`},
+		{name: "Customer", source: `customer.order_count == 0 || has_segment("vip") && customer.lifetime_spend > 5000`},
+		{name: "Escaped string", source: `cart.day_of_week == "sat\"urday"`},
+		{name: "Empty", source: `  `, expectedErr: ErrSyntax},
+		{name: "Too long", source: strings.Repeat("true && ", 200) + "true", expectedErr: ErrSyntax},
+		{name: "Too deep", source: strings.Repeat("(", 40) + "true" + strings.Repeat(")", 40), expectedErr: ErrSyntax},
+		{name: "Too many unary", source: strings.Repeat("!", 40) + "true", expectedErr: ErrSyntax},
+		{name: "Unknown character", source: `cart.total > 1000 ; true`, expectedErr: ErrSyntax},
+		{name: "Unterminated string", source: `category == "shoes`, expectedErr: ErrSyntax},
+		{name: "Missing operand", source: `cart.total >`, expectedErr: ErrSyntax},
+		{name: "Missing paren", source: `(cart.total > 1`, expectedErr: ErrSyntax},
+		{name: "Trailing tokens", source: `true false`, expectedErr: ErrSyntax},
+		{name: "Integer out of range", source: `cart.total > 99999999999999999999`, expectedErr: ErrSyntax},
+		{name: "Not boolean", source: `cart.total + 1`, expectedErr: ErrType},
+		{name: "Unknown variable", source: `cart.owner == "me"`, expectedErr: ErrType},
+		{name: "Item variable outside item function", source: `category == "shoes"`, expectedErr: ErrType},
+		{name: "Items as a value", source: `items == items`, expectedErr: ErrType},
+		{name: "Nested item function", source: `any(items, count(items, true) > 1)`, expectedErr: ErrType},
+		{name: "Compare int with string", source: `cart.total == "1000"`, expectedErr: ErrType},
+		{name: "And of ints", source: `1 && true`, expectedErr: ErrType},
+		{name: "Predicate not boolean", source: `count(items, price) > 1`, expectedErr: ErrType},
+		{name: "Sum of booleans", source: `sum(items, true) > 1`, expectedErr: ErrType},
+		{name: "Wrong argument count", source: `count(items) > 1`, expectedErr: ErrType},
+		{name: "Unknown function", source: `exec("rm") == ""`, expectedErr: ErrType},
+		{name: "Lower of int", source: `lower(1) == "1"`, expectedErr: ErrType},
+		{name: "Segment of int", source: `has_segment(1)`, expectedErr: ErrType},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile(tc.source)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Compile(%q) error = %v, want %v", tc.source, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	// 2025-10-18 is a Saturday
+	env := Env{
+		Total:    1_700,
+		Currency: "INR",
+		Items: []Item{
+			{ProductID: 1, Category: "shoes", Brand: "Acme", Quantity: 2, Price: 500},
+			{ProductID: 2, Category: "books", Quantity: 1, Price: 200},
+			{ProductID: 3, Category: "shoes", Brand: "Zeta", Quantity: 1, Price: 500},
+		},
+		Customer: Customer{OrderCount: 3, LifetimeSpend: 12_000, Segments: []string{"vip"}},
+		Now:      time.Date(2025, time.October, 18, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{source: `cart.total > 1000 && count(items, category == "shoes") >= 2`, expected: true},
+		{source: `count(items, category == "shoes") >= 4`},
+		{source: `cart.item_count == 4`, expected: true},
+		{source: `sum(items, price * quantity) == cart.total`, expected: true},
+		{source: `any(items, lower(brand) == "acme")`, expected: true},
+		{source: `all(items, category == "shoes")`},
+		{source: `all(items, price >= 200)`, expected: true},
+		{source: `cart.day_of_week == "saturday" && cart.currency == "INR"`, expected: true},
+		{source: `cart.total / 100 % 10 == 7`, expected: true},
+		{source: `1 + 2 * 3 == 7 && (1 + 2) * 3 == 9 && -2 - -3 == 1`, expected: true},
+		{source: `!(cart.total < 100) != false`, expected: true},
+		{source: `has_segment("VIP") && customer.order_count == 3 && customer.lifetime_spend > 10000`, expected: true},
+		{source: `has_segment("staff")`},
+		// the right side is not evaluated, so there is no division by zero
+		{source: `false && 1 / 0 == 1`},
+		{source: `true || 1 / 0 == 1`, expected: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.source, func(t *testing.T) {
+			program, err := Compile(tc.source)
+			if err != nil {
+				t.Fatalf("Compile() unexpected error: %v", err)
+			}
+			got, err := program.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval() unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Eval() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+
+	t.Run("Division by zero", func(t *testing.T) {
+		program, err := Compile(`cart.total / (cart.item_count - 4) > 1`)
+		if err != nil {
+			t.Fatalf("Compile() unexpected error: %v", err)
+		}
+		if _, err := program.Eval(env); !errors.Is(err, errDivisionByZero) {
+			t.Errorf("Eval() error = %v, want %v", err, errDivisionByZero)
+		}
+	})
+
+	t.Run("Anonymous customer", func(t *testing.T) {
+		program, err := Compile(`customer.order_count == 0 && !has_segment("vip")`)
+		if err != nil {
+			t.Fatalf("Compile() unexpected error: %v", err)
+		}
+		anonymous := env
+		anonymous.Customer = Customer{}
+		if got, err := program.Eval(anonymous); err != nil || !got {
+			t.Errorf("Eval() = %v, %v, want true", got, err)
+		}
+	})
+
+	t.Run("Step limit", func(t *testing.T) {
+		program, err := Compile(`count(items, ` + strings.Repeat("quantity + ", 80) + `1 > 0) > 0`)
+		if err != nil {
+			t.Fatalf("Compile() unexpected error: %v", err)
+		}
+		big := env
+		big.Items = make([]Item, 100)
+		if _, err := program.Eval(big); !errors.Is(err, ErrStepLimit) {
+			t.Errorf("Eval() error = %v, want %v", err, ErrStepLimit)
+		}
+		if _, err := program.Eval(env); err != nil {
+			t.Errorf("Eval() of a small cart unexpected error: %v", err)
+		}
+	})
+}
+
+func TestHasAmounts(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{source: `cart.total > 1000`, expected: true},
+		{source: `sum(items, price) > 1000`, expected: true},
+		{source: `count(items, category == "shoes") >= 2`},
+		{source: `customer.lifetime_spend > 1000`, expected: true},
+		{source: `cart.item_count > 2 && cart.day_of_week == "monday"`},
+	}
+	for _, tc := range tests {
+		program, err := Compile(tc.source)
+		if err != nil {
+			t.Fatalf("Compile(%q) unexpected error: %v", tc.source, err)
+		}
+		if got := program.HasAmounts(); got != tc.expected {
+			t.Errorf("HasAmounts(%q) = %v, want %v", tc.source, got, tc.expected)
+		}
+	}
+}
+
+func TestCompileCached(t *testing.T) {
+	const source = `cart.total > 1000 && any(items, brand == "acme")`
+	first, err := CompileCached(source)
+	if err != nil {
+		t.Fatalf("CompileCached(%q) unexpected error: %v", source, err)
+	}
+	if !first.HasAmounts() {
+		t.Errorf("HasAmounts(%q) = false, want true", source)
+	}
+	// the coupons are evaluated on every cart, they must not compile again
+	second, err := CompileCached(source)
+	if err != nil {
+		t.Fatalf("CompileCached(%q) unexpected error: %v", source, err)
+	}
+	if first != second {
+		t.Errorf("CompileCached(%q) compiled the source again", source)
+	}
+	if _, err := CompileCached(`cart.total >`); !errors.Is(err, ErrSyntax) {
+		t.Errorf("CompileCached() of an invalid source error = %v, want %v", err, ErrSyntax)
+	}
+}
@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	// text is the identifier, the punctuation or the unquoted string
+	text string
+	// value of the integer
+	value int64
+	// pos is the byte offset in the source
+	pos int
+}
+
+// punctuations are ordered so the two character ones are matched first
+var punctuations = []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", "."}
+
+// lex splits the source into the tokens, the last token is always tokEOF
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case isDigit(c):
+			start := i
+			for i < len(source) && isDigit(rune(source[i])) {
+				i++
+			}
+			value, err := strconv.ParseInt(source[start:i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w at %d: integer %s is out of range", ErrSyntax, start, source[start:i])
+			}
+			tokens = append(tokens, token{kind: tokInt, text: source[start:i], value: value, pos: start})
+		case isLetter(c):
+			start := i
+			for i < len(source) && (isLetter(rune(source[i])) || isDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: source[start:i], pos: start})
+		case c == '"':
+			start := i
+			i++
+			for i < len(source) && source[i] != '"' {
+				if source[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("%w at %d: string is not terminated", ErrSyntax, start)
+			}
+			i++
+			text, err := strconv.Unquote(source[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("%w at %d: invalid string %s", ErrSyntax, start, source[start:i])
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: start})
+		default:
+			punct := ""
+			for _, p := range punctuations {
+				if strings.HasPrefix(source[i:], p) {
+					punct = p
+					break
+				}
+			}
+			if punct == "" {
+				return nil, fmt.Errorf("%w at %d: unexpected %q", ErrSyntax, i, source[i])
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: punct, pos: i})
+			i += len(punct)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(source)}), nil
+}
+
+// only ascii is allowed outside the strings
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,253 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+)
+
+// node is a node of the syntax tree
+type node interface {
+	position() int
+}
+
+type (
+	intLit struct {
+		pos   int
+		value int64
+	}
+	stringLit struct {
+		pos   int
+		value string
+	}
+	boolLit struct {
+		pos   int
+		value bool
+	}
+	// ident is a variable, the dotted names like cart.total are a single ident
+	ident struct {
+		pos  int
+		name string
+	}
+	unary struct {
+		pos int
+		op  string
+		x   node
+	}
+	binary struct {
+		pos  int
+		op   string
+		x, y node
+	}
+	call struct {
+		pos  int
+		name string
+		args []node
+	}
+)
+
+func (n intLit) position() int    { return n.pos }
+func (n stringLit) position() int { return n.pos }
+func (n boolLit) position() int   { return n.pos }
+func (n ident) position() int     { return n.pos }
+func (n unary) position() int     { return n.pos }
+func (n binary) position() int    { return n.pos }
+func (n call) position() int      { return n.pos }
+
+// walk calls visit for the node and all the nodes under it
+func walk(n node, visit func(node)) {
+	visit(n)
+	switch n := n.(type) {
+	case unary:
+		walk(n.x, visit)
+	case binary:
+		walk(n.x, visit)
+		walk(n.y, visit)
+	case call:
+		for _, arg := range n.args {
+			walk(arg, visit)
+		}
+	}
+}
+
+// parser is a recursive descent parser, from the lowest precedence:
+// ||, &&, comparisons, + and -, * / and %, unary ! and -
+type parser struct {
+	tokens []token
+	i      int
+	depth  int
+}
+
+func parse(tokens []token) (node, error) {
+	p := &parser{tokens: tokens}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the punctuations
+func (p *parser) accept(puncts ...string) (token, bool) {
+	tok := p.peek()
+	if tok.kind == tokPunct && slices.Contains(puncts, tok.text) {
+		return p.next(), true
+	}
+	return tok, false
+}
+
+func (p *parser) expect(punct string) error {
+	if tok, ok := p.accept(punct); !ok {
+		return fmt.Errorf("%w at %d: expected %q, found %s", ErrSyntax, tok.pos, punct, describe(tok))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(tok token) error {
+	return fmt.Errorf("%w at %d: unexpected %s", ErrSyntax, tok.pos, describe(tok))
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q", tok.text)
+	default:
+		return fmt.Sprintf("%q", tok.text)
+	}
+}
+
+// nest guards the recursion, so a deeply nested expression can not exhaust the stack
+func (p *parser) nest() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return fmt.Errorf("%w at %d: expression is nested deeper than %d", ErrSyntax, p.peek().pos, maxDepth)
+	}
+	return nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	return p.parseBinary(0)
+}
+
+// levels are the binary operators by increasing precedence
+var levels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(levels) {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept(levels[level]...)
+		if !ok {
+			return x, nil
+		}
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binary{pos: tok.pos, op: tok.text, x: x, y: y}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if tok, ok := p.accept("!", "-"); ok {
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{pos: tok.pos, op: tok.text, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokInt:
+		return intLit{pos: tok.pos, value: tok.value}, nil
+	case tokString:
+		return stringLit{pos: tok.pos, value: tok.text}, nil
+	case tokIdent:
+		return p.parseIdent(tok)
+	case tokPunct:
+		if tok.text == "(" {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, p.unexpected(tok)
+}
+
+// parseIdent parses the literal, the dotted variable or the call starting with the identifier
+func (p *parser) parseIdent(tok token) (node, error) {
+	switch tok.text {
+	case "true", "false":
+		return boolLit{pos: tok.pos, value: tok.text == "true"}, nil
+	}
+	name := tok.text
+	for {
+		if _, ok := p.accept("."); !ok {
+			break
+		}
+		part := p.next()
+		if part.kind != tokIdent {
+			return nil, p.unexpected(part)
+		}
+		name += "." + part.text
+	}
+	if _, ok := p.accept("("); !ok {
+		return ident{pos: tok.pos, name: name}, nil
+	}
+
+	c := call{pos: tok.pos, name: name}
+	if _, ok := p.accept(")"); ok {
+		return c, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+		if _, ok := p.accept(","); !ok {
+			return c, p.expect(")")
+		}
+	}
+}
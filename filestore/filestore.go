@@ -0,0 +1,82 @@
+// Package filestore persists a small state to a single JSON file
+//
+// The whole file is replaced atomically on every write, so it suits the states which
+// are small and rarely written, e.g. the catalog and the customers.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ParasRaba155/monk-commerce-task/utils"
+)
+
+// JSON keeps the file of a state of type T in sync with its owner
+//
+// The owner holds the state in memory and serves all the reads from it. JSON serializes
+// the writes and saves the state after each one, so the file always has the latest state.
+type JSON[T any] struct {
+	// mu serializes the writers
+	mu      sync.Mutex
+	path    string
+	initial T
+	state   func() T
+	restore func(T)
+}
+
+// Open restores the state from the file at path, without a file yet the state is initial
+// state must return the current state of the owner and restore must replace it
+func Open[T any](path string, initial T, state func() T, restore func(T)) (*JSON[T], error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create dir of %s: %w", filepath.Base(path), err)
+	}
+	f := &JSON[T]{path: path, initial: initial, state: state, restore: restore}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write runs write and saves the state, an error of write is returned as is and nothing is saved
+// on a failed save the state is restored from the file, so a write is either persisted or not done
+func (f *JSON[T]) Write(write func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := write(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(f.state())
+	if err == nil {
+		err = utils.WriteFileAtomic(f.path, data)
+	}
+	if err == nil {
+		return nil
+	}
+	name := filepath.Base(f.path)
+	if loadErr := f.load(); loadErr != nil {
+		return fmt.Errorf("write %s: %w, restore %s: %w", name, err, name, loadErr)
+	}
+	return fmt.Errorf("write %s: %w", name, err)
+}
+
+// load restores the state from the file, without a file yet the state is initial
+func (f *JSON[T]) load() error {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.restore(f.initial)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", filepath.Base(f.path), err)
+	}
+	var state T
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decode %s: %w", filepath.Base(f.path), err)
+	}
+	f.restore(state)
+	return nil
+}
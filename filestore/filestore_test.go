@@ -0,0 +1,100 @@
+package filestore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/filestore"
+)
+
+type names struct {
+	Names []string `json:"names"`
+}
+
+// owner holds the state in memory, as the repositories do
+type owner struct {
+	names []string
+}
+
+func (o *owner) state() names {
+	return names{Names: slices.Clone(o.names)}
+}
+
+func (o *owner) restore(state names) {
+	o.names = slices.Clone(state.Names)
+}
+
+func open(t *testing.T, path string) (*owner, *filestore.JSON[names]) {
+	t.Helper()
+	o := &owner{}
+	file, err := filestore.Open(path, names{Names: []string{"initial"}}, o.state, o.restore)
+	if err != nil {
+		t.Fatalf("Open() unexpected error: %v", err)
+	}
+	return o, file
+}
+
+func add(o *owner, name string) func() error {
+	return func() error {
+		o.names = append(o.names, name)
+		return nil
+	}
+}
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "names.json")
+	o, file := open(t, path)
+	if want := []string{"initial"}; !slices.Equal(o.names, want) {
+		t.Errorf("state without a file = %v, want %v", o.names, want)
+	}
+	if err := file.Write(add(o, "first")); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+
+	errWrite := errors.New("write failed")
+	err := file.Write(func() error {
+		o.names = append(o.names, "not saved")
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Errorf("Write() error = %v, want %v", err, errWrite)
+	}
+
+	reopened, _ := open(t, path)
+	if want := []string{"initial", "first"}; !slices.Equal(reopened.names, want) {
+		t.Errorf("state after reopen = %v, want %v", reopened.names, want)
+	}
+}
+
+func TestJSONRestoresOnFailedSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.json")
+	o, file := open(t, path)
+	if err := file.Write(add(o, "first")); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+
+	// the temporary file of the atomic write can not be created over a directory
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	if err := file.Write(add(o, "second")); err == nil {
+		t.Fatal("Write() expected an error")
+	}
+	if want := []string{"initial", "first"}; !slices.Equal(o.names, want) {
+		t.Errorf("state after failed save = %v, want %v", o.names, want)
+	}
+}
+
+func TestOpenCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatalf("write names: %v", err)
+	}
+	o := &owner{}
+	if _, err := filestore.Open(path, names{}, o.state, o.restore); err == nil {
+		t.Error("Open() expected an error")
+	}
+}
@@ -0,0 +1,164 @@
+// Package money for the amounts of the prices, discounts and totals
+//
+// An amount is kept in the minor unit of its currency, e.g. paisa for INR, so it never
+// has a fraction. The only place a fraction comes up is a percentage of an amount,
+// which is rounded with an explicit Rounding
+package money
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidRounding = errors.New("invalid rounding")
+	errInvalidCurrency = errors.New("invalid currency")
+)
+
+// Currency is the ISO 4217 code of the currency
+type Currency string
+
+const (
+	INR Currency = "INR"
+	USD Currency = "USD"
+)
+
+// DefaultCurrency is the currency of the carts, catalog prices and coupon amounts which do not declare one
+const DefaultCurrency = INR
+
+// Currencies are the currencies we sell in
+var Currencies = []Currency{INR, USD}
+
+// ParseCurrency returns the supported currency of the case-insensitive code
+func ParseCurrency(code string) (Currency, error) {
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if !slices.Contains(Currencies, currency) {
+		return "", fmt.Errorf("%w: %q, must be one of %v", errInvalidCurrency, code, Currencies)
+	}
+	return currency, nil
+}
+
+// Money is the amount in the minor unit of the currency
+//
+// The operations on two amounts panic if the currencies differ, mixing them is a bug
+// the JSON of the money is only the amount, the currency is reported once by the owner of the amounts
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+// New returns the amount of minor units of the currency
+func New(amount int64, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Zero returns no amount of the currency
+func Zero(currency Currency) Money {
+	return Money{Currency: currency}
+}
+
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
+
+// Mul returns the amount for n units, e.g. the price for the quantity
+func (m Money) Mul(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// Cmp compares the amounts, it returns -1, 0 or +1 same as cmp.Compare
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Min returns the smaller amount
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return m
+	}
+	return o
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Percent returns percent % of the amount, rounded to the minor unit with the rounding
+func (m Money) Percent(percent int, rounding Rounding) Money {
+	return Money{Amount: rounding.div(m.Amount*int64(percent), 100), Currency: m.Currency}
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+}
+
+// MarshalJSON writes the amount in minor units as a number
+func (m Money) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, m.Amount, 10), nil
+}
+
+func (m Money) mustMatch(o Money) {
+	if m.Currency != o.Currency {
+		panic(fmt.Errorf("money: currency mismatch %s and %s", m.Currency, o.Currency))
+	}
+}
+
+// Allocate splits the total across the weights with the largest remainder method
+// every share is rounded down, and the units left over go one each to the shares with the largest
+// remainder, the earlier share wins a tie so the split is deterministic
+// the shares always sum to the total, and no share is more than its weight if the total is not
+func Allocate(total Money, weights []Money) []Money {
+	shares := make([]Money, len(weights))
+	totalWeight := Zero(total.Currency)
+	for i, weight := range weights {
+		totalWeight = totalWeight.Add(weight)
+		shares[i] = Zero(total.Currency)
+	}
+	if totalWeight.IsZero() {
+		return shares
+	}
+
+	remainders := make([]int64, len(weights))
+	allocated := int64(0)
+	for i, weight := range weights {
+		shares[i].Amount = total.Amount * weight.Amount / totalWeight.Amount
+		remainders[i] = total.Amount * weight.Amount % totalWeight.Amount
+		allocated += shares[i].Amount
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case remainders[a] > remainders[b]:
+			return -1
+		case remainders[a] < remainders[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+	for _, i := range order[:total.Amount-allocated] {
+		shares[i].Amount++
+	}
+	return shares
+}
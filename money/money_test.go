@@ -0,0 +1,155 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func inr(amount int64) Money {
+	return New(amount, INR)
+}
+
+func TestRoundingDiv(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int64
+		expected map[Rounding]int64
+	}{
+		{name: "Exact", n: 300, expected: map[Rounding]int64{HalfUp: 3, HalfEven: 3, Floor: 3}},
+		{name: "Below half", n: 249, expected: map[Rounding]int64{HalfUp: 2, HalfEven: 2, Floor: 2}},
+		{name: "Half to even down", n: 250, expected: map[Rounding]int64{HalfUp: 3, HalfEven: 2, Floor: 2}},
+		{name: "Half to even up", n: 350, expected: map[Rounding]int64{HalfUp: 4, HalfEven: 4, Floor: 3}},
+		{name: "Above half", n: 251, expected: map[Rounding]int64{HalfUp: 3, HalfEven: 3, Floor: 2}},
+		{name: "Zero", n: 0, expected: map[Rounding]int64{HalfUp: 0, HalfEven: 0, Floor: 0}},
+		{name: "Negative half", n: -250, expected: map[Rounding]int64{HalfUp: -3, HalfEven: -2, Floor: -3}},
+		{name: "Negative below half", n: -249, expected: map[Rounding]int64{HalfUp: -2, HalfEven: -2, Floor: -3}},
+		{name: "Negative odd half", n: -350, expected: map[Rounding]int64{HalfUp: -4, HalfEven: -4, Floor: -4}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for rounding, expected := range tc.expected {
+				if got := rounding.div(tc.n, 100); got != expected {
+					t.Errorf("%v div(%d, 100) = %d, want %d", rounding, tc.n, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRounding(t *testing.T) {
+	for _, rounding := range []Rounding{HalfUp, HalfEven, Floor} {
+		got, err := ParseRounding(rounding.String())
+		if err != nil {
+			t.Fatalf("ParseRounding(%q) unexpected error: %v", rounding, err)
+		}
+		if got != rounding {
+			t.Errorf("ParseRounding(%q) = %v, want %v", rounding, got, rounding)
+		}
+	}
+	if _, err := ParseRounding("ceil"); !errors.Is(err, errInvalidRounding) {
+		t.Errorf("ParseRounding(%q) error = %v, want %v", "ceil", err, errInvalidRounding)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Money
+		percent  int
+		rounding Rounding
+		expected Money
+	}{
+		{name: "Exact", amount: inr(25_000), percent: 10, rounding: HalfUp, expected: inr(2500)},
+		{name: "Half up", amount: inr(1_005), percent: 10, rounding: HalfUp, expected: inr(101)},
+		{name: "Half even", amount: inr(1_005), percent: 10, rounding: HalfEven, expected: inr(100)},
+		{name: "Floor", amount: inr(1_009), percent: 10, rounding: Floor, expected: inr(100)},
+		{name: "Whole", amount: inr(999), percent: 100, rounding: HalfUp, expected: inr(999)},
+		{name: "Nothing", amount: inr(999), percent: 0, rounding: HalfUp, expected: inr(0)},
+		{name: "Keeps the currency", amount: New(333, USD), percent: 50, rounding: HalfEven, expected: New(166, USD)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.amount.Percent(tc.percent, tc.rounding); got != tc.expected {
+				t.Errorf("Percent() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	amounts := func(values ...int64) []Money {
+		result := make([]Money, len(values))
+		for i, v := range values {
+			result[i] = inr(v)
+		}
+		return result
+	}
+	tests := []struct {
+		name     string
+		total    Money
+		weights  []Money
+		expected []Money
+	}{
+		{name: "Exact split", total: inr(30), weights: amounts(200, 100), expected: amounts(20, 10)},
+		{name: "Largest remainder first", total: inr(2), weights: amounts(10, 40, 30, 20), expected: amounts(0, 1, 1, 0)},
+		{name: "Zero weight gets nothing", total: inr(7), weights: amounts(0, 3, 4), expected: amounts(0, 3, 4)},
+		{name: "Whole price", total: inr(99), weights: amounts(33, 33, 33), expected: amounts(33, 33, 33)},
+		{name: "Equal remainders go to the earlier", total: inr(37), weights: amounts(50, 50, 50), expected: amounts(13, 12, 12)},
+		{name: "No weight", total: inr(5), weights: amounts(0, 0), expected: amounts(0, 0)},
+		{name: "No items", total: inr(0), weights: nil, expected: amounts()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Allocate(tc.total, tc.weights)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Allocate() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCurrencyMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Add() of INR and USD did not panic")
+		}
+	}()
+	inr(100).Add(New(100, USD))
+}
+
+func TestMarshalJSON(t *testing.T) {
+	got, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{Price: inr(12_345)})
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	if expected := `{"price":12345}`; string(got) != expected {
+		t.Errorf("Marshal() = %s, want %s", got, expected)
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	tests := []struct {
+		code        string
+		expected    Currency
+		expectedErr error
+	}{
+		{code: "INR", expected: INR},
+		{code: " usd ", expected: USD},
+		{code: "EUR", expectedErr: errInvalidCurrency},
+		{code: "", expectedErr: errInvalidCurrency},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseCurrency(tc.code)
+		if got != tc.expected || !errors.Is(err, tc.expectedErr) {
+			t.Errorf("ParseCurrency(%q) = %q, %v, want %q, %v", tc.code, got, err, tc.expected, tc.expectedErr)
+		}
+	}
+}
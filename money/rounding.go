@@ -0,0 +1,69 @@
+package money
+
+import "fmt"
+
+// Rounding is how a fraction of the minor unit is rounded
+type Rounding int
+
+const (
+	// HalfUp rounds the half away from zero, e.g. 2.5 to 3, it is the default
+	HalfUp Rounding = iota
+	// HalfEven rounds the half to the even unit, e.g. 2.5 to 2 and 3.5 to 4, also known as bankers' rounding
+	HalfEven
+	// Floor rounds down towards negative infinity, e.g. 2.9 to 2
+	Floor
+)
+
+var roundingNames = [...]string{
+	HalfUp:   "half-up",
+	HalfEven: "half-even",
+	Floor:    "floor",
+}
+
+// ParseRounding returns the rounding by its name, i.e. half-up, half-even or floor
+func ParseRounding(name string) (Rounding, error) {
+	for r, n := range roundingNames {
+		if n == name {
+			return Rounding(r), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q, must be %q, %q or %q", errInvalidRounding, name, roundingNames[HalfUp], roundingNames[HalfEven], roundingNames[Floor])
+}
+
+func (r Rounding) String() string {
+	if r < 0 || int(r) >= len(roundingNames) {
+		return fmt.Sprintf("Rounding(%d)", int(r))
+	}
+	return roundingNames[r]
+}
+
+// div returns n / d rounded with r, d must be positive
+func (r Rounding) div(n, d int64) int64 {
+	q, rem := n/d, n%d
+	// Go truncates towards zero, so q is already the answer without a remainder
+	if rem == 0 {
+		return q
+	}
+	// step is the unit away from zero
+	step := int64(1)
+	if n < 0 {
+		step, rem = -1, -rem
+	}
+	switch r {
+	case Floor:
+		if n < 0 {
+			return q - 1
+		}
+		return q
+	case HalfEven:
+		if 2*rem > d || (2*rem == d && q%2 != 0) {
+			return q + step
+		}
+		return q
+	default:
+		if 2*rem >= d {
+			return q + step
+		}
+		return q
+	}
+}
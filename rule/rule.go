@@ -0,0 +1,255 @@
+// Package rule evaluates the eligibility conditions of the coupons,
+// a Rule is a boolean tree of all (AND), any (OR) and not (NOT) over the conditions on the cart
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+var (
+	// ErrInvalidRule is returned for the rules which are not a valid tree
+	ErrInvalidRule      = errors.New("invalid rule")
+	errInvalidCondition = errors.New("invalid condition")
+)
+
+const (
+	// maxDepth is the deepest a rule can be nested, the root is at depth 1
+	maxDepth = 8
+	// maxNodes is the most rules and conditions a tree can have
+	maxNodes = 64
+)
+
+// ConditionType is the kind of the fact a condition checks
+type ConditionType string
+
+const (
+	// CartTotal is met by the cart total of at least Amount
+	CartTotal ConditionType = "cart_total"
+	// ContainsProduct is met by the cart with at least Quantity (default 1) of ProductID
+	ContainsProduct ConditionType = "contains_product"
+	// ContainsCategory is met by the cart with at least Quantity (default 1) items of Category
+	ContainsCategory ConditionType = "contains_category"
+	// ItemCount is met by the cart with at least Quantity items
+	ItemCount ConditionType = "item_count"
+	// CustomerSegment is met by the customer in Segment, never by an anonymous cart
+	CustomerSegment ConditionType = "customer_segment"
+	// DayOfWeek is met on any of the Days, e.g. ["saturday", "sunday"]
+	DayOfWeek ConditionType = "day_of_week"
+)
+
+// Condition is a single check on the cart, only the fields of its Type are used
+type Condition struct {
+	Type ConditionType `json:"type,omitempty"`
+	// Amount is in the minor unit of the currency of the coupon
+	Amount    int      `json:"amount,omitempty"`
+	ProductID int      `json:"product_id,omitempty"`
+	Category  string   `json:"category,omitempty"`
+	Quantity  int      `json:"quantity,omitempty"`
+	Segment   string   `json:"segment,omitempty"`
+	Days      []string `json:"days,omitempty"`
+}
+
+// Rule is exactly one of All, Any, Not or a condition, e.g.
+// {"all": [{"type": "cart_total", "amount": 1000}, {"not": {"type": "contains_category", "category": "books"}}]}
+type Rule struct {
+	All []Rule `json:"all,omitempty"`
+	Any []Rule `json:"any,omitempty"`
+	Not *Rule  `json:"not,omitempty"`
+	Condition
+}
+
+// Item is the part of a cart item the conditions check
+type Item struct {
+	ProductID int
+	Category  string
+	Quantity  int
+}
+
+// Facts is the cart the rules are evaluated on
+type Facts struct {
+	Total money.Money
+	Items []Item
+	// Segments of the customer of the cart, nil for an anonymous cart
+	Segments []string
+	// Now is the time of the cart, the day of week is in its location
+	Now time.Time
+}
+
+// Validate the whole tree, every rule has to be exactly one of all, any, not or a condition
+func (r Rule) Validate() error {
+	nodes := 0
+	return r.validate(1, &nodes)
+}
+
+func (r Rule) validate(depth int, nodes *int) error {
+	*nodes++
+	if depth > maxDepth {
+		return fmt.Errorf("%w: rules can not be nested deeper than %d", ErrInvalidRule, maxDepth)
+	}
+	if *nodes > maxNodes {
+		return fmt.Errorf("%w: rules can not have more than %d conditions", ErrInvalidRule, maxNodes)
+	}
+
+	kinds := 0
+	for _, set := range []bool{r.All != nil, r.Any != nil, r.Not != nil, r.Type != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("%w: must have exactly one of all, any, not or type", ErrInvalidRule)
+	}
+
+	switch {
+	case r.All != nil, r.Any != nil:
+		children := slices.Concat(r.All, r.Any)
+		if len(children) == 0 {
+			return fmt.Errorf("%w: all and any can not be empty", ErrInvalidRule)
+		}
+		for _, child := range children {
+			if err := child.validate(depth+1, nodes); err != nil {
+				return err
+			}
+		}
+		return nil
+	case r.Not != nil:
+		return r.Not.validate(depth+1, nodes)
+	default:
+		return r.Condition.validate()
+	}
+}
+
+func (c Condition) validate() error {
+	switch c.Type {
+	case CartTotal:
+		if c.Amount <= 0 {
+			return fmt.Errorf("%w: %s amount must be positive", errInvalidCondition, c.Type)
+		}
+	case ContainsProduct:
+		if c.ProductID <= 0 {
+			return fmt.Errorf("%w: %s product_id must be positive", errInvalidCondition, c.Type)
+		}
+	case ContainsCategory:
+		if strings.TrimSpace(c.Category) == "" {
+			return fmt.Errorf("%w: %s category is required", errInvalidCondition, c.Type)
+		}
+	case ItemCount:
+		if c.Quantity <= 0 {
+			return fmt.Errorf("%w: %s quantity must be positive", errInvalidCondition, c.Type)
+		}
+	case CustomerSegment:
+		if strings.TrimSpace(c.Segment) == "" {
+			return fmt.Errorf("%w: %s segment is required", errInvalidCondition, c.Type)
+		}
+	case DayOfWeek:
+		if len(c.Days) == 0 {
+			return fmt.Errorf("%w: %s days are required", errInvalidCondition, c.Type)
+		}
+		for _, day := range c.Days {
+			if _, ok := parseWeekday(day); !ok {
+				return fmt.Errorf("%w: %q is not a day of week", errInvalidCondition, day)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", errInvalidCondition, c.Type)
+	}
+	if c.Quantity < 0 {
+		return fmt.Errorf("%w: %s quantity can not be negative", errInvalidCondition, c.Type)
+	}
+	return nil
+}
+
+// Matches reports whether the facts meet the rule, the rule must be valid
+func (r Rule) Matches(f Facts) bool {
+	switch {
+	case r.All != nil:
+		for _, child := range r.All {
+			if !child.Matches(f) {
+				return false
+			}
+		}
+		return true
+	case r.Any != nil:
+		for _, child := range r.Any {
+			if child.Matches(f) {
+				return true
+			}
+		}
+		return false
+	case r.Not != nil:
+		return !r.Not.Matches(f)
+	default:
+		return r.Condition.matches(f)
+	}
+}
+
+func (c Condition) matches(f Facts) bool {
+	switch c.Type {
+	case CartTotal:
+		return f.Total.Amount >= int64(c.Amount)
+	case ContainsProduct:
+		return f.quantity(func(item Item) bool { return item.ProductID == c.ProductID }) >= max(c.Quantity, 1)
+	case ContainsCategory:
+		return f.quantity(func(item Item) bool {
+			return item.Category != "" && strings.EqualFold(item.Category, strings.TrimSpace(c.Category))
+		}) >= max(c.Quantity, 1)
+	case ItemCount:
+		return f.quantity(func(Item) bool { return true }) >= c.Quantity
+	case CustomerSegment:
+		for _, segment := range f.Segments {
+			if strings.EqualFold(segment, strings.TrimSpace(c.Segment)) {
+				return true
+			}
+		}
+		return false
+	case DayOfWeek:
+		for _, day := range c.Days {
+			if weekday, ok := parseWeekday(day); ok && weekday == f.Now.Weekday() {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// HasAmounts reports whether any condition of the rule has an amount, the amounts are in the currency of the coupon
+func (r Rule) HasAmounts() bool {
+	for _, child := range slices.Concat(r.All, r.Any) {
+		if child.HasAmounts() {
+			return true
+		}
+	}
+	if r.Not != nil && r.Not.HasAmounts() {
+		return true
+	}
+	return r.Type == CartTotal
+}
+
+// quantity is the number of units of the items which match
+func (f Facts) quantity(match func(Item) bool) int {
+	quantity := 0
+	for _, item := range f.Items {
+		if match(item) {
+			quantity += item.Quantity
+		}
+	}
+	return quantity
+}
+
+// parseWeekday parses the case-insensitive english name of the day, e.g. Monday
+func parseWeekday(day string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(strings.TrimSpace(day), weekday.String()) {
+			return weekday, true
+		}
+	}
+	return 0, false
+}
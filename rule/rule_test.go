@@ -0,0 +1,177 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+func TestValidate(t *testing.T) {
+	nested := Rule{Condition: Condition{Type: ItemCount, Quantity: 1}}
+	for range maxDepth {
+		nested = Rule{Not: &nested}
+	}
+	wide := Rule{All: make([]Rule, maxNodes)}
+	for i := range wide.All {
+		wide.All[i] = Rule{Condition: Condition{Type: ItemCount, Quantity: 1}}
+	}
+
+	tests := []struct {
+		name        string
+		rule        Rule
+		expectedErr error
+	}{
+		{name: "Condition", rule: Rule{Condition: Condition{Type: CartTotal, Amount: 1000}}},
+		{
+			name: "Tree",
+			rule: Rule{All: []Rule{
+				{Condition: Condition{Type: CartTotal, Amount: 1000}},
+				{Any: []Rule{
+					{Condition: Condition{Type: ContainsProduct, ProductID: 3, Quantity: 2}},
+					{Condition: Condition{Type: ContainsCategory, Category: "shoes"}},
+				}},
+				{Not: &Rule{Condition: Condition{Type: DayOfWeek, Days: []string{"Saturday", "sunday"}}}},
+				{Condition: Condition{Type: CustomerSegment, Segment: "vip"}},
+			}},
+		},
+		{name: "Empty", rule: Rule{}, expectedErr: ErrInvalidRule},
+		{name: "Empty all", rule: Rule{All: []Rule{}}, expectedErr: ErrInvalidRule},
+		{
+			name:        "All and condition",
+			rule:        Rule{All: []Rule{{Condition: Condition{Type: ItemCount, Quantity: 1}}}, Condition: Condition{Type: ItemCount, Quantity: 1}},
+			expectedErr: ErrInvalidRule,
+		},
+		{name: "Too deep", rule: nested, expectedErr: ErrInvalidRule},
+		{name: "Too many conditions", rule: wide, expectedErr: ErrInvalidRule},
+		{name: "Unknown type", rule: Rule{Condition: Condition{Type: "weather"}}, expectedErr: errInvalidCondition},
+		{name: "Cart total without amount", rule: Rule{Condition: Condition{Type: CartTotal}}, expectedErr: errInvalidCondition},
+		{name: "Product without id", rule: Rule{Condition: Condition{Type: ContainsProduct}}, expectedErr: errInvalidCondition},
+		{name: "Product negative quantity", rule: Rule{Condition: Condition{Type: ContainsProduct, ProductID: 1, Quantity: -1}}, expectedErr: errInvalidCondition},
+		{name: "Blank category", rule: Rule{Condition: Condition{Type: ContainsCategory, Category: " "}}, expectedErr: errInvalidCondition},
+		{name: "Item count without quantity", rule: Rule{Condition: Condition{Type: ItemCount}}, expectedErr: errInvalidCondition},
+		{name: "Blank segment", rule: Rule{Condition: Condition{Type: CustomerSegment}}, expectedErr: errInvalidCondition},
+		{name: "No days", rule: Rule{Condition: Condition{Type: DayOfWeek}}, expectedErr: errInvalidCondition},
+		{name: "Unknown day", rule: Rule{Condition: Condition{Type: DayOfWeek, Days: []string{"funday"}}}, expectedErr: errInvalidCondition},
+		{name: "Invalid nested condition", rule: Rule{Any: []Rule{{Not: &Rule{Condition: Condition{Type: CartTotal}}}}}, expectedErr: errInvalidCondition},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.rule.Validate(); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// 2025-10-18 is a Saturday
+	facts := Facts{
+		Total: money.New(1_500, money.INR),
+		Items: []Item{
+			{ProductID: 1, Category: "Shoes", Quantity: 2},
+			{ProductID: 2, Category: "books", Quantity: 1},
+		},
+		Segments: []string{"VIP"},
+		Now:      time.Date(2025, time.October, 18, 12, 0, 0, 0, time.UTC),
+	}
+	condition := func(c Condition) Rule { return Rule{Condition: c} }
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		expected bool
+	}{
+		{name: "Cart total met", rule: condition(Condition{Type: CartTotal, Amount: 1_500}), expected: true},
+		{name: "Cart total not met", rule: condition(Condition{Type: CartTotal, Amount: 1_501})},
+		{name: "Contains product", rule: condition(Condition{Type: ContainsProduct, ProductID: 1}), expected: true},
+		{name: "Contains product quantity not met", rule: condition(Condition{Type: ContainsProduct, ProductID: 1, Quantity: 3})},
+		{name: "Missing product", rule: condition(Condition{Type: ContainsProduct, ProductID: 9})},
+		{name: "Contains category case-insensitive", rule: condition(Condition{Type: ContainsCategory, Category: "shoes", Quantity: 2}), expected: true},
+		{name: "Missing category", rule: condition(Condition{Type: ContainsCategory, Category: "toys"})},
+		{name: "Item count met", rule: condition(Condition{Type: ItemCount, Quantity: 3}), expected: true},
+		{name: "Item count not met", rule: condition(Condition{Type: ItemCount, Quantity: 4})},
+		{name: "Customer segment", rule: condition(Condition{Type: CustomerSegment, Segment: "vip"}), expected: true},
+		{name: "Other customer segment", rule: condition(Condition{Type: CustomerSegment, Segment: "staff"})},
+		{name: "Day of week", rule: condition(Condition{Type: DayOfWeek, Days: []string{"sunday", "SATURDAY"}}), expected: true},
+		{name: "Other day of week", rule: condition(Condition{Type: DayOfWeek, Days: []string{"monday"}})},
+		{
+			name: "All met",
+			rule: Rule{All: []Rule{
+				condition(Condition{Type: CartTotal, Amount: 1_000}),
+				condition(Condition{Type: ContainsCategory, Category: "books"}),
+			}},
+			expected: true,
+		},
+		{
+			name: "All with one not met",
+			rule: Rule{All: []Rule{
+				condition(Condition{Type: CartTotal, Amount: 1_000}),
+				condition(Condition{Type: ContainsCategory, Category: "toys"}),
+			}},
+		},
+		{
+			name: "Any with one met",
+			rule: Rule{Any: []Rule{
+				condition(Condition{Type: ContainsCategory, Category: "toys"}),
+				condition(Condition{Type: ItemCount, Quantity: 1}),
+			}},
+			expected: true,
+		},
+		{name: "Not", rule: Rule{Not: &Rule{Condition: Condition{Type: ContainsCategory, Category: "books"}}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.rule.Matches(facts); got != tc.expected {
+				t.Errorf("Matches() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+
+	t.Run("Anonymous cart", func(t *testing.T) {
+		anonymous := facts
+		anonymous.Segments = nil
+		if condition(Condition{Type: CustomerSegment, Segment: "vip"}).Matches(anonymous) {
+			t.Errorf("Matches() of customer segment on anonymous cart = true, want false")
+		}
+	})
+}
+
+func TestRuleJSON(t *testing.T) {
+	data := `{"all": [{"type": "cart_total", "amount": 1000}, {"not": {"any": [{"type": "contains_category", "category": "books"}, {"type": "day_of_week", "days": ["sunday"]}]}}]}`
+	expected := Rule{All: []Rule{
+		{Condition: Condition{Type: CartTotal, Amount: 1000}},
+		{Not: &Rule{Any: []Rule{
+			{Condition: Condition{Type: ContainsCategory, Category: "books"}},
+			{Condition: Condition{Type: DayOfWeek, Days: []string{"sunday"}}},
+		}}},
+	}}
+
+	var got Rule
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("json.Unmarshal() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("json.Unmarshal() = %+v, want %+v", got, expected)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+	if !got.HasAmounts() {
+		t.Errorf("HasAmounts() = false, want true")
+	}
+
+	encoded, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("json.Marshal() unexpected error: %v", err)
+	}
+	var again Rule
+	if err := json.Unmarshal(encoded, &again); err != nil || !reflect.DeepEqual(again, expected) {
+		t.Errorf("round trip of %s = %+v, %v, want %+v", encoded, again, err, expected)
+	}
+}
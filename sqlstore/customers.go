@@ -0,0 +1,139 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+)
+
+const customerColumns = `id, created_at, order_count, segments, lifetime_spend`
+
+func scanCustomer(row scanner) (customer.Customer, error) {
+	var (
+		c                   customer.Customer
+		createdAt, segments string
+	)
+	if err := row.Scan(&c.ID, &createdAt, &c.OrderCount, &segments, &c.LifetimeSpend); err != nil {
+		return customer.Customer{}, err
+	}
+	var err error
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return customer.Customer{}, fmt.Errorf("created_at of customer %d: %w", c.ID, err)
+	}
+	if err := json.Unmarshal([]byte(segments), &c.Segments); err != nil {
+		return customer.Customer{}, fmt.Errorf("decode segments of customer %d: %w", c.ID, err)
+	}
+	if len(c.Segments) == 0 {
+		c.Segments = nil
+	}
+	return c, nil
+}
+
+// marshalSegments encodes the segments as a JSON array, no segments is the empty array
+func marshalSegments(segments []string) (string, error) {
+	if len(segments) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(segments)
+	if err != nil {
+		return "", fmt.Errorf("marshal segments: %w", err)
+	}
+	return string(data), nil
+}
+
+// CreateCustomer assigns a new ID and stores the customer.
+func (s *Store) CreateCustomer(c customer.Customer) (customer.Customer, error) {
+	segments, err := marshalSegments(c.Segments)
+	if err != nil {
+		return customer.Customer{}, err
+	}
+	result, err := s.db.Exec(`INSERT INTO customers (created_at, order_count, segments, lifetime_spend) VALUES (?, ?, ?, ?)`,
+		c.CreatedAt.Format(time.RFC3339Nano), c.OrderCount, segments, c.LifetimeSpend)
+	if err != nil {
+		return customer.Customer{}, fmt.Errorf("insert customer: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return customer.Customer{}, fmt.Errorf("insert customer id: %w", err)
+	}
+	c.ID = int(id)
+	return c, nil
+}
+
+// GetAllCustomers returns all customers sorted by ID.
+func (s *Store) GetAllCustomers() ([]customer.Customer, error) {
+	rows, err := s.db.Query(`SELECT ` + customerColumns + ` FROM customers ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("select customers: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]customer.Customer, 0)
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan customer: %w", err)
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// GetCustomerByID returns the customer with the given ID.
+func (s *Store) GetCustomerByID(id int) (customer.Customer, error) {
+	c, err := scanCustomer(s.db.QueryRow(`SELECT `+customerColumns+` FROM customers WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return customer.Customer{}, fmt.Errorf("%w: no customer with id %d", customer.ErrDoesNotExist, id)
+	}
+	if err != nil {
+		return customer.Customer{}, fmt.Errorf("select customer: %w", err)
+	}
+	return c, nil
+}
+
+// UpdateCustomerByID replaces the customer with the new details.
+// a zero CreatedAt keeps the created date of the customer
+func (s *Store) UpdateCustomerByID(id int, newCustomer customer.Customer) (customer.Customer, error) {
+	segments, err := marshalSegments(newCustomer.Segments)
+	if err != nil {
+		return customer.Customer{}, err
+	}
+	createdAt := sql.NullString{}
+	if !newCustomer.CreatedAt.IsZero() {
+		createdAt = sql.NullString{String: newCustomer.CreatedAt.Format(time.RFC3339Nano), Valid: true}
+	}
+	result, err := s.db.Exec(`UPDATE customers SET created_at = COALESCE(?, created_at), order_count = ?, segments = ?, lifetime_spend = ? WHERE id = ?`,
+		createdAt, newCustomer.OrderCount, segments, newCustomer.LifetimeSpend, id)
+	if err != nil {
+		return customer.Customer{}, fmt.Errorf("update customer: %w", err)
+	}
+	if err := expectCustomerAffected(result, id); err != nil {
+		return customer.Customer{}, err
+	}
+	// the created date may be the stored one
+	return s.GetCustomerByID(id)
+}
+
+// DeleteCustomerByID removes the customer.
+func (s *Store) DeleteCustomerByID(id int) error {
+	result, err := s.db.Exec(`DELETE FROM customers WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete customer: %w", err)
+	}
+	return expectCustomerAffected(result, id)
+}
+
+func expectCustomerAffected(result sql.Result, id int) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: no customer with id %d", customer.ErrDoesNotExist, id)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("sql.Open() unexpected error: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatalf("read schema version: %v", err)
+	}
+	return version
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"0001_create_a.sql": {Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY);`)},
+		"0002_seed_a.sql":   {Data: []byte(`INSERT INTO a (id) VALUES (1); INSERT INTO a (id) VALUES (2);`)},
+	}
+	if err := migrate(db, fsys); err != nil {
+		t.Fatalf("migrate() unexpected error: %v", err)
+	}
+	if v := schemaVersion(t, db); v != 2 {
+		t.Errorf("schema version = %d, want 2", v)
+	}
+
+	// applied migrations are not run again, the seed would fail on the primary key
+	fsys["0003_create_b.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE b (id INTEGER PRIMARY KEY);`)}
+	if err := migrate(db, fsys); err != nil {
+		t.Fatalf("migrate() again unexpected error: %v", err)
+	}
+	if v := schemaVersion(t, db); v != 3 {
+		t.Errorf("schema version = %d, want 3", v)
+	}
+	if _, err := db.Exec(`INSERT INTO b (id) VALUES (1)`); err != nil {
+		t.Errorf("new migration was not applied: %v", err)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"0001_create_a.sql": {Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY);`)},
+		"0002_broken.sql":   {Data: []byte(`CREATE TABLE c (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1);`)},
+	}
+	if err := migrate(db, fsys); err == nil {
+		t.Fatalf("migrate() expected error for broken migration")
+	}
+	if v := schemaVersion(t, db); v != 1 {
+		t.Errorf("schema version = %d, want 1", v)
+	}
+	if _, err := db.Exec(`INSERT INTO c (id) VALUES (1)`); err == nil {
+		t.Errorf("partial migration was not rolled back")
+	}
+}
+
+func TestLoadMigrationsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "missing version", fsys: fstest.MapFS{"create_a.sql": {}}},
+		{name: "invalid version", fsys: fstest.MapFS{"abc_create_a.sql": {}}},
+		{name: "duplicated version", fsys: fstest.MapFS{"0001_a.sql": {}, "1_b.sql": {}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := loadMigrations(tc.fsys); err == nil {
+				t.Errorf("loadMigrations() expected error")
+			}
+		})
+	}
+}
+
+// migrationsUpTo returns the embedded migrations upto and including the version
+func migrationsUpTo(t *testing.T, version int) fstest.MapFS {
+	t.Helper()
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("fs.Sub() unexpected error: %v", err)
+	}
+	files, err := fs.Glob(migrations, "*.sql")
+	if err != nil {
+		t.Fatalf("fs.Glob() unexpected error: %v", err)
+	}
+	fsys := fstest.MapFS{}
+	for _, file := range files {
+		if v, _ := strconv.Atoi(file[:4]); v > version {
+			continue
+		}
+		data, err := fs.ReadFile(migrations, file)
+		if err != nil {
+			t.Fatalf("fs.ReadFile() unexpected error: %v", err)
+		}
+		fsys[file] = &fstest.MapFile{Data: data}
+	}
+	return fsys
+}
+
+func TestMigrateAmountsInMinorUnits(t *testing.T) {
+	db := openTestDB(t)
+	if err := migrate(db, migrationsUpTo(t, 7)); err != nil {
+		t.Fatalf("migrate() unexpected error: %v", err)
+	}
+	// the amounts before the migration are in rupees
+	coupons := []struct {
+		typ, details, expected string
+	}{
+		{typ: "cart-wise", details: `{"threshold":100,"discount":10,"max_discount":50}`, expected: `{"threshold":10000,"discount":10,"max_discount":5000}`},
+		{typ: "cart-wise", details: `{"threshold":150,"discount":20,"discount_kind":"fixed"}`, expected: `{"threshold":15000,"discount":2000,"discount_kind":"fixed"}`},
+		{
+			typ:      "cart-wise",
+			details:  `{"threshold":0,"discount":0,"tiers":[{"threshold":500,"discount":5},{"threshold":1000,"discount":10}]}`,
+			expected: `{"threshold":0,"discount":0,"tiers":[{"threshold":50000,"discount":5},{"threshold":100000,"discount":10}]}`,
+		},
+		{
+			typ:      "cart-wise",
+			details:  `{"threshold":0,"discount":0,"tiers":[{"threshold":500,"discount":50}],"discount_kind":"fixed"}`,
+			expected: `{"threshold":0,"discount":0,"tiers":[{"threshold":50000,"discount":5000}],"discount_kind":"fixed"}`,
+		},
+		{typ: "product-wise", details: `{"product_id":7,"discount":5,"discount_kind":"fixed"}`, expected: `{"product_id":7,"discount":500,"discount_kind":"fixed"}`},
+		{typ: "product-wise", details: `{"product_id":7,"discount":10}`, expected: `{"product_id":7,"discount":10}`},
+		{typ: "brand-wise", details: `{"brand":"dell","discount":10,"min_subtotal":300}`, expected: `{"brand":"dell","discount":10,"min_subtotal":30000}`},
+		{typ: "volume-tier", details: `{"product_id":3,"tiers":[{"min_quantity":10,"discount":10}],"max_discount":40}`, expected: `{"product_id":3,"tiers":[{"min_quantity":10,"discount":10}],"max_discount":4000}`},
+	}
+	for i, c := range coupons {
+		if _, err := db.Exec(`INSERT INTO coupons (id, type, details) VALUES (?, ?, ?)`, i+1, c.typ, c.details); err != nil {
+			t.Fatalf("insert coupon: %v", err)
+		}
+	}
+	_, err := db.Exec(`INSERT INTO redemptions (coupon_id, customer_id, cart_total, discount, redeemed_at) VALUES (1, 1, 250, 25, '2025-10-20T09:30:00Z')`)
+	if err != nil {
+		t.Fatalf("insert redemption: %v", err)
+	}
+
+	if err := migrate(db, migrationsUpTo(t, 8)); err != nil {
+		t.Fatalf("migrate() unexpected error: %v", err)
+	}
+	for i, c := range coupons {
+		var details string
+		if err := db.QueryRow(`SELECT details FROM coupons WHERE id = ?`, i+1).Scan(&details); err != nil {
+			t.Fatalf("select coupon: %v", err)
+		}
+		if details != c.expected {
+			t.Errorf("details of the %s coupon = %s, want %s", c.typ, details, c.expected)
+		}
+	}
+	var price, cartTotal, discount int
+	if err := db.QueryRow(`SELECT price FROM products WHERE id = 1`).Scan(&price); err != nil || price != 1000 {
+		t.Errorf("price of product 1 = %d, %v, want 1000", price, err)
+	}
+	if err := db.QueryRow(`SELECT cart_total, discount FROM redemptions`).Scan(&cartTotal, &discount); err != nil || cartTotal != 25000 || discount != 2500 {
+		t.Errorf("redemption = %d, %d, %v, want 25000, 2500", cartTotal, discount, err)
+	}
+}
@@ -0,0 +1,11 @@
+-- details is the json of the coupon details, decoded according to the type
+-- timestamps are RFC3339 text, so the timezone of the coupon is preserved
+CREATE TABLE coupons (
+    id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    type                  TEXT    NOT NULL,
+    details               TEXT    NOT NULL,
+    starts_at             TEXT,
+    ends_at               TEXT,
+    max_total_uses        INTEGER NOT NULL DEFAULT 0,
+    max_uses_per_customer INTEGER NOT NULL DEFAULT 0
+);
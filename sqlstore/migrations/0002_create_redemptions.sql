@@ -0,0 +1,11 @@
+-- the ledger is kept even after the coupon is deleted, so there is no foreign key
+CREATE TABLE redemptions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    coupon_id   INTEGER NOT NULL,
+    customer_id INTEGER NOT NULL,
+    cart_total  INTEGER NOT NULL,
+    discount    INTEGER NOT NULL,
+    redeemed_at TEXT    NOT NULL
+);
+
+CREATE INDEX redemptions_coupon_customer ON redemptions (coupon_id, customer_id);
@@ -0,0 +1,9 @@
+CREATE TABLE products (
+    id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    price INTEGER NOT NULL
+);
+
+-- the same static product list which the in memory setup uses
+INSERT INTO products (id, price) VALUES
+    (1, 10), (2, 20), (3, 30), (4, 40), (5, 50),
+    (6, 60), (7, 70), (8, 80), (9, 90), (10, 100);
@@ -0,0 +1,5 @@
+-- code is stored normalized (upper case), so the unique index is case-insensitive
+-- coupons without code keep it NULL, which the unique index allows more than once
+ALTER TABLE coupons ADD COLUMN code TEXT;
+
+CREATE UNIQUE INDEX coupons_code ON coupons (code);
@@ -0,0 +1,14 @@
+-- single use codes generated for a coupon, they share the namespace with coupons.code
+-- which is checked by the store since sqlite can not have a unique index across tables
+CREATE TABLE coupon_codes (
+    code        TEXT    PRIMARY KEY,
+    coupon_id   INTEGER NOT NULL,
+    redeemed_at TEXT
+);
+
+CREATE INDEX coupon_codes_coupon_id ON coupon_codes (coupon_id);
+
+ALTER TABLE coupons ADD COLUMN requires_code INTEGER NOT NULL DEFAULT 0;
+
+-- the coupon code or single use code the redemption was made with
+ALTER TABLE redemptions ADD COLUMN code TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE coupons ADD COLUMN stackable INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE coupons ADD COLUMN exclusive INTEGER NOT NULL DEFAULT 0;
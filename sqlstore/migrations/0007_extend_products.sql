@@ -0,0 +1,15 @@
+-- the products table becomes the catalog, the seeded products get the same details
+-- as catalog.DefaultProducts
+ALTER TABLE products ADD COLUMN sku TEXT;
+ALTER TABLE products ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN category TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN brand TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN active INTEGER NOT NULL DEFAULT 1;
+
+UPDATE products SET
+    sku      = printf('SKU-%03d', id),
+    name     = 'Product ' || id,
+    category = 'general',
+    brand    = 'generic';
+
+CREATE UNIQUE INDEX products_sku ON products (sku);
@@ -0,0 +1,27 @@
+-- the amounts are in the minor unit of the currency from now on (paisa for INR), they were in rupees
+-- so the prices, the ledger and the amounts in the coupon details are scaled by 100
+-- the percentages stay as they are
+UPDATE products SET price = price * 100;
+
+UPDATE redemptions SET cart_total = cart_total * 100, discount = discount * 100;
+
+UPDATE coupons SET details = json_set(details, '$.discount', json_extract(details, '$.discount') * 100)
+    WHERE type IN ('cart-wise', 'product-wise') AND json_extract(details, '$.discount_kind') = 'fixed'
+        AND json_type(details, '$.discount') IS NOT NULL;
+
+UPDATE coupons SET details = json_set(details, '$.threshold', json_extract(details, '$.threshold') * 100)
+    WHERE type = 'cart-wise' AND json_type(details, '$.threshold') IS NOT NULL;
+
+UPDATE coupons SET details = json_set(details, '$.tiers', (
+        SELECT json_group_array(json_set(tier.value,
+            '$.threshold', json_extract(tier.value, '$.threshold') * 100,
+            '$.discount', json_extract(tier.value, '$.discount')
+                * iif(json_extract(coupons.details, '$.discount_kind') = 'fixed', 100, 1)))
+        FROM json_each(coupons.details, '$.tiers') AS tier))
+    WHERE type = 'cart-wise' AND json_type(details, '$.tiers') = 'array';
+
+UPDATE coupons SET details = json_set(details, '$.max_discount', json_extract(details, '$.max_discount') * 100)
+    WHERE json_type(details, '$.max_discount') IS NOT NULL;
+
+UPDATE coupons SET details = json_set(details, '$.min_subtotal', json_extract(details, '$.min_subtotal') * 100)
+    WHERE type = 'brand-wise' AND json_type(details, '$.min_subtotal') IS NOT NULL;
@@ -0,0 +1,5 @@
+-- prices is the JSON object of the prices in the currencies other than the default one,
+-- the coupons and redemptions before this migration are all in the default currency
+ALTER TABLE products ADD COLUMN prices TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE coupons ADD COLUMN currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE redemptions ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
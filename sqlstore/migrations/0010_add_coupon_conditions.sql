@@ -0,0 +1,2 @@
+-- conditions is the JSON eligibility rule of the coupon, empty for the coupons without conditions
+ALTER TABLE coupons ADD COLUMN conditions TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- expression is the source of the eligibility expression of the coupon, empty for the coupons without one
+ALTER TABLE coupons ADD COLUMN expression TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- segments is the JSON array of the normalized segments of the customer
+CREATE TABLE customers (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at     TEXT    NOT NULL,
+    order_count    INTEGER NOT NULL DEFAULT 0,
+    segments       TEXT    NOT NULL DEFAULT '[]',
+    lifetime_spend INTEGER NOT NULL DEFAULT 0
+);
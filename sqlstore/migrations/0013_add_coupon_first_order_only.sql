@@ -0,0 +1,2 @@
+-- first_order_only coupons are only for the customers without any completed order
+ALTER TABLE coupons ADD COLUMN first_order_only INTEGER NOT NULL DEFAULT 0;
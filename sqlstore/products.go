@@ -0,0 +1,140 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/money"
+)
+
+const productColumns = `id, sku, name, price, category, brand, active, prices`
+
+func scanProduct(row scanner) (catalog.Product, error) {
+	var (
+		p      catalog.Product
+		prices string
+	)
+	if err := row.Scan(&p.ID, &p.SKU, &p.Name, &p.Price, &p.Category, &p.Brand, &p.Active, &prices); err != nil {
+		return catalog.Product{}, err
+	}
+	if err := json.Unmarshal([]byte(prices), &p.Prices); err != nil {
+		return catalog.Product{}, fmt.Errorf("decode prices of product %d: %w", p.ID, err)
+	}
+	if len(p.Prices) == 0 {
+		p.Prices = nil
+	}
+	return p, nil
+}
+
+// marshalPrices encodes the prices as a JSON object, no prices is the empty object
+func marshalPrices(prices map[money.Currency]int) (string, error) {
+	if len(prices) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(prices)
+	if err != nil {
+		return "", fmt.Errorf("marshal prices: %w", err)
+	}
+	return string(data), nil
+}
+
+// CreateProduct assigns a new ID and stores the product.
+// It will fail if the sku is already used by another product
+func (s *Store) CreateProduct(p catalog.Product) (catalog.Product, error) {
+	p.SKU = catalog.NormalizeSKU(p.SKU)
+	prices, err := marshalPrices(p.Prices)
+	if err != nil {
+		return catalog.Product{}, err
+	}
+	result, err := s.db.Exec(`INSERT INTO products (sku, name, price, category, brand, active, prices) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.SKU, p.Name, p.Price, p.Category, p.Brand, p.Active, prices)
+	if isUniqueViolation(err) {
+		return catalog.Product{}, fmt.Errorf("%w: sku %q is already used", catalog.ErrAlreadyExists, p.SKU)
+	}
+	if err != nil {
+		return catalog.Product{}, fmt.Errorf("insert product: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return catalog.Product{}, fmt.Errorf("insert product id: %w", err)
+	}
+	p.ID = int(id)
+	return p, nil
+}
+
+// GetAllProducts returns all products sorted by ID.
+func (s *Store) GetAllProducts() ([]catalog.Product, error) {
+	rows, err := s.db.Query(`SELECT ` + productColumns + ` FROM products ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("select products: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]catalog.Product, 0)
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan product: %w", err)
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// GetProductByID returns the product with the given ID.
+func (s *Store) GetProductByID(id int) (catalog.Product, error) {
+	p, err := scanProduct(s.db.QueryRow(`SELECT `+productColumns+` FROM products WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return catalog.Product{}, fmt.Errorf("%w: no product with id %d", catalog.ErrDoesNotExist, id)
+	}
+	if err != nil {
+		return catalog.Product{}, fmt.Errorf("select product: %w", err)
+	}
+	return p, nil
+}
+
+// UpdateProductByID replaces the product with the new details.
+// It will fail if the new sku is already used by another product
+func (s *Store) UpdateProductByID(id int, newProduct catalog.Product) (catalog.Product, error) {
+	newProduct.SKU = catalog.NormalizeSKU(newProduct.SKU)
+	prices, err := marshalPrices(newProduct.Prices)
+	if err != nil {
+		return catalog.Product{}, err
+	}
+	result, err := s.db.Exec(`UPDATE products SET sku = ?, name = ?, price = ?, category = ?, brand = ?, active = ?, prices = ? WHERE id = ?`,
+		newProduct.SKU, newProduct.Name, newProduct.Price, newProduct.Category, newProduct.Brand, newProduct.Active, prices, id)
+	if isUniqueViolation(err) {
+		return catalog.Product{}, fmt.Errorf("%w: sku %q is already used", catalog.ErrAlreadyExists, newProduct.SKU)
+	}
+	if err != nil {
+		return catalog.Product{}, fmt.Errorf("update product: %w", err)
+	}
+	if err := expectProductAffected(result, id); err != nil {
+		return catalog.Product{}, err
+	}
+	newProduct.ID = id // enforce correct ID
+	return newProduct, nil
+}
+
+// DeleteProductByID removes the product from the catalog.
+func (s *Store) DeleteProductByID(id int) error {
+	result, err := s.db.Exec(`DELETE FROM products WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete product: %w", err)
+	}
+	return expectProductAffected(result, id)
+}
+
+func expectProductAffected(result sql.Result, id int) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: no product with id %d", catalog.ErrDoesNotExist, id)
+	}
+	return nil
+}
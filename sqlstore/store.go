@@ -0,0 +1,556 @@
+// Package sqlstore stores the coupons, the redemption ledger, the products and the customers in an embedded
+// sqlite database, it implements coupon.Repository, catalog.Repository and customer.Repository
+package sqlstore
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite" // pure go sqlite driver
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore opens or creates the database at path and migrates it to the latest schema
+func NewStore(path string) (*Store, error) {
+	// busy_timeout and WAL keep the readers and the writer from failing on each other
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	// sqlite allows a single writer, a single connection serializes the transactions
+	// which is what makes the check and insert of the redemptions atomic
+	db.SetMaxOpenConns(1)
+
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// scanner is the common interface of *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+const couponColumns = `id, type, details, starts_at, ends_at, max_total_uses, max_uses_per_customer, code, requires_code, stackable, exclusive, currency, conditions, expression, first_order_only`
+
+func scanCoupon(row scanner) (coupon.Coupon, error) {
+	var (
+		c                coupon.Coupon
+		details          string
+		startsAt, endsAt sql.NullString
+		code             sql.NullString
+		conditions       string
+	)
+	err := row.Scan(&c.ID, &c.Type, &details, &startsAt, &endsAt, &c.MaxTotalUses, &c.MaxUsesPerCustomer, &code, &c.RequiresCode, &c.Stackable, &c.Exclusive, &c.Currency, &conditions, &c.Expression, &c.FirstOrderOnly)
+	if err != nil {
+		return coupon.Coupon{}, err
+	}
+	c.Code = code.String
+	if c.Details, err = coupon.DecodeDetails(c.Type, json.RawMessage(details)); err != nil {
+		return coupon.Coupon{}, fmt.Errorf("decode details of coupon %d: %w", c.ID, err)
+	}
+	if conditions != "" {
+		if err := json.Unmarshal([]byte(conditions), &c.Conditions); err != nil {
+			return coupon.Coupon{}, fmt.Errorf("decode conditions of coupon %d: %w", c.ID, err)
+		}
+	}
+	if c.StartsAt, err = parseTime(startsAt); err != nil {
+		return coupon.Coupon{}, fmt.Errorf("starts_at of coupon %d: %w", c.ID, err)
+	}
+	if c.EndsAt, err = parseTime(endsAt); err != nil {
+		return coupon.Coupon{}, fmt.Errorf("ends_at of coupon %d: %w", c.ID, err)
+	}
+	return c, nil
+}
+
+// couponArgs are the values of couponColumns without the id
+func couponArgs(c coupon.Coupon) ([]any, error) {
+	details, err := json.Marshal(c.Details)
+	if err != nil {
+		return nil, fmt.Errorf("marshal details: %w", err)
+	}
+	// the coupons without conditions are stored with an empty string
+	var conditions []byte
+	if c.Conditions != nil {
+		if conditions, err = json.Marshal(c.Conditions); err != nil {
+			return nil, fmt.Errorf("marshal conditions: %w", err)
+		}
+	}
+	code := sql.NullString{String: c.Code, Valid: c.Code != ""}
+	return []any{
+		string(c.Type), string(details), formatTime(c.StartsAt), formatTime(c.EndsAt),
+		c.MaxTotalUses, c.MaxUsesPerCustomer, code, c.RequiresCode, c.Stackable, c.Exclusive, string(c.Currency), string(conditions), c.Expression, c.FirstOrderOnly,
+	}, nil
+}
+
+// CreateCoupon assigns a new ID and stores the coupon.
+// It will fail if the code is already used by another coupon
+func (s *Store) CreateCoupon(c coupon.Coupon) (coupon.Coupon, error) {
+	c.Code = coupon.NormalizeCode(c.Code)
+	args, err := couponArgs(c)
+	if err != nil {
+		return coupon.Coupon{}, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("begin create coupon: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSingleUseCode(tx, c.Code); err != nil {
+		return coupon.Coupon{}, err
+	}
+	result, err := tx.Exec(`INSERT INTO coupons (type, details, starts_at, ends_at, max_total_uses, max_uses_per_customer, code, requires_code, stackable, exclusive, currency, conditions, expression, first_order_only)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+	if isUniqueViolation(err) {
+		return coupon.Coupon{}, fmt.Errorf("%w: code %q is already used", coupon.ErrAlreadyExists, c.Code)
+	}
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("insert coupon: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("insert coupon id: %w", err)
+	}
+	c.ID = int(id)
+	return c, tx.Commit()
+}
+
+// GetAllCoupons returns all coupons ordered by ID.
+func (s *Store) GetAllCoupons() ([]coupon.Coupon, error) {
+	rows, err := s.db.Query(`SELECT ` + couponColumns + ` FROM coupons ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("select coupons: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]coupon.Coupon, 0)
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// GetCouponByID returns the coupon with the given ID.
+func (s *Store) GetCouponByID(id int) (coupon.Coupon, error) {
+	return getCouponByID(s.db, id)
+}
+
+// GetCouponByCode returns the coupon with the given code, the code is case-insensitive.
+func (s *Store) GetCouponByCode(code string) (coupon.Coupon, error) {
+	c, err := scanCoupon(s.db.QueryRow(`SELECT `+couponColumns+` FROM coupons WHERE code = ?`, coupon.NormalizeCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coupon.Coupon{}, fmt.Errorf("%w: no coupon with code %q", coupon.ErrDoesNotExist, code)
+	}
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("select coupon: %w", err)
+	}
+	return c, nil
+}
+
+// UpdateCouponByID replaces the coupon with the new details.
+// It will fail if the new code is already used by another coupon
+func (s *Store) UpdateCouponByID(id int, newCoupon coupon.Coupon) (coupon.Coupon, error) {
+	newCoupon.Code = coupon.NormalizeCode(newCoupon.Code)
+	args, err := couponArgs(newCoupon)
+	if err != nil {
+		return coupon.Coupon{}, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("begin update coupon: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSingleUseCode(tx, newCoupon.Code); err != nil {
+		return coupon.Coupon{}, err
+	}
+	result, err := tx.Exec(`UPDATE coupons SET type = ?, details = ?, starts_at = ?, ends_at = ?,
+		max_total_uses = ?, max_uses_per_customer = ?, code = ?, requires_code = ?, stackable = ?, exclusive = ?, currency = ?, conditions = ?, expression = ?, first_order_only = ? WHERE id = ?`, append(args, id)...)
+	if isUniqueViolation(err) {
+		return coupon.Coupon{}, fmt.Errorf("%w: code %q is already used", coupon.ErrAlreadyExists, newCoupon.Code)
+	}
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("update coupon: %w", err)
+	}
+	if err := expectAffected(result, id); err != nil {
+		return coupon.Coupon{}, err
+	}
+	newCoupon.ID = id // enforce correct ID
+	return newCoupon, tx.Commit()
+}
+
+// DeleteCouponByID removes the coupon and its single use codes, its redemptions are kept in the ledger.
+func (s *Store) DeleteCouponByID(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin delete coupon: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM coupons WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete coupon: %w", err)
+	}
+	if err := expectAffected(result, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM coupon_codes WHERE coupon_id = ?`, id); err != nil {
+		return fmt.Errorf("delete coupon codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RecordRedemption inserts the redemption to the ledger
+// It will fail if the redemption would exceed the usage limits of the coupon
+// the limits are checked and the redemption is inserted in the same transaction
+// a single use code must belong to the coupon and is marked as redeemed in the transaction
+func (s *Store) RecordRedemption(redemption coupon.Redemption) error {
+	return s.RecordRedemptions([]coupon.Redemption{redemption})
+}
+
+// RecordRedemptions inserts all the redemptions to the ledger in a single transaction, or none of them
+// It will fail if any redemption would exceed the usage limits of its coupon, counting the ones before it
+func (s *Store) RecordRedemptions(redemptions []coupon.Redemption) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin redemption: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, redemption := range redemptions {
+		if err := insertRedemption(tx, redemption); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertRedemption checks the limits and inserts the redemption in the transaction
+func insertRedemption(tx *sql.Tx, redemption coupon.Redemption) error {
+	redemption.Code = coupon.NormalizeCode(redemption.Code)
+	c, err := getCouponByID(tx, redemption.CouponID)
+	if err != nil {
+		return err
+	}
+	if redemption.Code != "" && redemption.Code != c.Code {
+		singleUse, err := getCouponCode(tx, redemption.Code)
+		if err != nil || singleUse.CouponID != c.ID {
+			return fmt.Errorf("%w: no code %q for coupon %d", coupon.ErrDoesNotExist, redemption.Code, c.ID)
+		}
+		if singleUse.IsRedeemed() {
+			return fmt.Errorf("%w: %q", coupon.ErrCodeRedeemed, redemption.Code)
+		}
+	}
+	usage, err := getUsage(tx, redemption.CouponID, redemption.CustomerID)
+	if err != nil {
+		return err
+	}
+	if err := c.CheckUsage(usage); err != nil {
+		return err
+	}
+	if err := c.CheckFirstOrder(usage); err != nil {
+		return err
+	}
+
+	redeemedAt := redemption.RedeemedAt.Format(time.RFC3339Nano)
+	_, err = tx.Exec(`INSERT INTO redemptions (coupon_id, customer_id, cart_total, discount, redeemed_at, code, currency)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		redemption.CouponID, redemption.CustomerID, redemption.CartTotal, redemption.Discount,
+		redeemedAt, sql.NullString{String: redemption.Code, Valid: redemption.Code != ""}, string(redemption.Currency),
+	)
+	if err != nil {
+		return fmt.Errorf("insert redemption: %w", err)
+	}
+	if redemption.Code != "" && redemption.Code != c.Code {
+		_, err = tx.Exec(`UPDATE coupon_codes SET redeemed_at = ? WHERE code = ?`, redeemedAt, redemption.Code)
+		if err != nil {
+			return fmt.Errorf("redeem code: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetUsage returns the usage of the coupon overall and by the given customer
+func (s *Store) GetUsage(couponID, customerID int) (coupon.Usage, error) {
+	if _, err := getCouponByID(s.db, couponID); err != nil {
+		return coupon.Usage{}, err
+	}
+	return getUsage(s.db, couponID, customerID)
+}
+
+// GetUsages returns the map of couponID -> usage of the coupons overall and by the given customer
+// the coupons which do not exist, e.g. deleted after they were listed, are left out
+func (s *Store) GetUsages(couponIDs []int, customerID int) (map[int]coupon.Usage, error) {
+	usages := make(map[int]coupon.Usage, len(couponIDs))
+	if len(couponIDs) == 0 {
+		return usages, nil
+	}
+	args := make([]any, 0, len(couponIDs)+1)
+	args = append(args, customerID)
+	for _, id := range couponIDs {
+		args = append(args, id)
+	}
+	rows, err := s.db.Query(`SELECT c.id, COUNT(r.id), COALESCE(SUM(r.customer_id = ? AND r.customer_id != 0), 0)
+		FROM coupons c LEFT JOIN redemptions r ON r.coupon_id = c.id
+		WHERE c.id IN (?`+strings.Repeat(", ?", len(couponIDs)-1)+`) GROUP BY c.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count redemptions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		u := coupon.Usage{CustomerID: customerID}
+		if err := rows.Scan(&id, &u.Total, &u.ByCustomer); err != nil {
+			return nil, err
+		}
+		usages[id] = u
+	}
+	return usages, rows.Err()
+}
+
+// GetRedemptionsByCouponID returns the ledger entries of the coupon in the order they were recorded
+func (s *Store) GetRedemptionsByCouponID(couponID int) ([]coupon.Redemption, error) {
+	if _, err := getCouponByID(s.db, couponID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT coupon_id, customer_id, cart_total, discount, redeemed_at, COALESCE(code, ''), currency
+		FROM redemptions WHERE coupon_id = ? ORDER BY id`, couponID)
+	if err != nil {
+		return nil, fmt.Errorf("select redemptions: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]coupon.Redemption, 0)
+	for rows.Next() {
+		var (
+			r          coupon.Redemption
+			redeemedAt string
+		)
+		if err := rows.Scan(&r.CouponID, &r.CustomerID, &r.CartTotal, &r.Discount, &redeemedAt, &r.Code, &r.Currency); err != nil {
+			return nil, err
+		}
+		if r.RedeemedAt, err = time.Parse(time.RFC3339Nano, redeemedAt); err != nil {
+			return nil, fmt.Errorf("redeemed_at of redemption: %w", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// CreateCouponCodes stores the single use codes for the coupon
+// It will fail without storing any code if a code is already used
+func (s *Store) CreateCouponCodes(couponID int, codes []string) ([]coupon.CouponCode, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin create codes: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := getCouponByID(tx, couponID); err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO coupon_codes (code, coupon_id) VALUES (?, ?)`)
+	if err != nil {
+		return nil, fmt.Errorf("prepare insert code: %w", err)
+	}
+	defer stmt.Close()
+
+	created := make([]coupon.CouponCode, len(codes))
+	for i, code := range codes {
+		code = coupon.NormalizeCode(code)
+		if code == "" {
+			return nil, fmt.Errorf("single use code can not be empty")
+		}
+		_, err := stmt.Exec(code, couponID)
+		if isUniqueViolation(err) || isPrimaryKeyViolation(err) {
+			return nil, fmt.Errorf("%w: code %q is already used", coupon.ErrAlreadyExists, code)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("insert code: %w", err)
+		}
+		created[i] = coupon.CouponCode{Code: code, CouponID: couponID}
+	}
+
+	// the new codes must not be a code of any coupon either
+	var conflict string
+	err = tx.QueryRow(`SELECT cc.code FROM coupon_codes cc JOIN coupons c ON c.code = cc.code
+		WHERE cc.coupon_id = ? LIMIT 1`, couponID).Scan(&conflict)
+	if err == nil {
+		return nil, fmt.Errorf("%w: code %q is used by a coupon", coupon.ErrAlreadyExists, conflict)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("check codes: %w", err)
+	}
+	return created, tx.Commit()
+}
+
+// GetCouponCodes returns the single use codes of the coupon sorted by code
+func (s *Store) GetCouponCodes(couponID int) ([]coupon.CouponCode, error) {
+	if _, err := getCouponByID(s.db, couponID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT code, coupon_id, redeemed_at FROM coupon_codes WHERE coupon_id = ? ORDER BY code`, couponID)
+	if err != nil {
+		return nil, fmt.Errorf("select codes: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]coupon.CouponCode, 0)
+	for rows.Next() {
+		code, err := scanCouponCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, code)
+	}
+	return result, rows.Err()
+}
+
+// GetCouponCode returns the single use code, the code is case-insensitive
+func (s *Store) GetCouponCode(code string) (coupon.CouponCode, error) {
+	return getCouponCode(s.db, coupon.NormalizeCode(code))
+}
+
+// querier is the common interface of *sql.DB and *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getCouponByID(q querier, id int) (coupon.Coupon, error) {
+	c, err := scanCoupon(q.QueryRow(`SELECT `+couponColumns+` FROM coupons WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coupon.Coupon{}, fmt.Errorf("%w: no coupon with id %d", coupon.ErrDoesNotExist, id)
+	}
+	if err != nil {
+		return coupon.Coupon{}, fmt.Errorf("select coupon: %w", err)
+	}
+	return c, nil
+}
+
+func getCouponCode(q querier, code string) (coupon.CouponCode, error) {
+	singleUse, err := scanCouponCode(q.QueryRow(`SELECT code, coupon_id, redeemed_at FROM coupon_codes WHERE code = ?`, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return coupon.CouponCode{}, fmt.Errorf("%w: no single use code %q", coupon.ErrDoesNotExist, code)
+	}
+	if err != nil {
+		return coupon.CouponCode{}, fmt.Errorf("select code: %w", err)
+	}
+	return singleUse, nil
+}
+
+func scanCouponCode(row scanner) (coupon.CouponCode, error) {
+	var (
+		code       coupon.CouponCode
+		redeemedAt sql.NullString
+	)
+	if err := row.Scan(&code.Code, &code.CouponID, &redeemedAt); err != nil {
+		return coupon.CouponCode{}, err
+	}
+	var err error
+	if code.RedeemedAt, err = parseTime(redeemedAt); err != nil {
+		return coupon.CouponCode{}, fmt.Errorf("redeemed_at of code %q: %w", code.Code, err)
+	}
+	return code, nil
+}
+
+// checkSingleUseCode returns error if the coupon code is already a single use code
+func checkSingleUseCode(q querier, code string) error {
+	if code == "" {
+		return nil
+	}
+	var couponID int
+	err := q.QueryRow(`SELECT coupon_id FROM coupon_codes WHERE code = ?`, code).Scan(&couponID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("select code: %w", err)
+	}
+	return fmt.Errorf("%w: code %q is a single use code of coupon %d", coupon.ErrAlreadyExists, code, couponID)
+}
+
+// getUsage counts the redemptions of the coupon, anonymous redemptions are not counted per customer
+func getUsage(q querier, couponID, customerID int) (coupon.Usage, error) {
+	u := coupon.Usage{CustomerID: customerID}
+	err := q.QueryRow(`SELECT COUNT(*), COALESCE(SUM(customer_id = ? AND customer_id != 0), 0)
+		FROM redemptions WHERE coupon_id = ?`, customerID, couponID).Scan(&u.Total, &u.ByCustomer)
+	if err != nil {
+		return coupon.Usage{}, fmt.Errorf("count redemptions: %w", err)
+	}
+	return u, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func isPrimaryKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func expectAffected(result sql.Result, id int) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: no coupon with id %d", coupon.ErrDoesNotExist, id)
+	}
+	return nil
+}
+
+func formatTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(time.RFC3339Nano), Valid: true}
+}
+
+func parseTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,91 @@
+package sqlstore
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ParasRaba155/monk-commerce-task/catalog"
+	"github.com/ParasRaba155/monk-commerce-task/catalog/catalogtest"
+	"github.com/ParasRaba155/monk-commerce-task/coupon"
+	"github.com/ParasRaba155/monk-commerce-task/coupon/coupontest"
+	"github.com/ParasRaba155/monk-commerce-task/customer"
+	"github.com/ParasRaba155/monk-commerce-task/customer/customertest"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStoreConformance(t *testing.T) {
+	coupontest.RunRepositoryTests(t, func(t *testing.T) coupon.Repository {
+		return openTestStore(t, filepath.Join(t.TempDir(), "coupons.db"))
+	})
+}
+
+func TestStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coupons.db")
+	store := openTestStore(t, path)
+	created, err := store.CreateCoupon(coupon.Coupon{
+		Type:         "product-wise",
+		Details:      coupon.ProductWiseDetails{ProductID: 2, Discount: 15},
+		MaxTotalUses: 10,
+	})
+	if err != nil {
+		t.Fatalf("CreateCoupon() unexpected error: %v", err)
+	}
+	if err := store.RecordRedemption(coupon.Redemption{CouponID: created.ID, CustomerID: 1, CartTotal: 40, Discount: 6}); err != nil {
+		t.Fatalf("RecordRedemption() unexpected error: %v", err)
+	}
+	store.Close()
+
+	// opening again runs the migrations which are already applied, they must be skipped
+	reopened := openTestStore(t, path)
+	got, err := reopened.GetCouponByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetCouponByID() unexpected error: %v", err)
+	}
+	coupontest.AssertCouponEqual(t, got, created)
+	usage, err := reopened.GetUsage(created.ID, 1)
+	if err != nil {
+		t.Fatalf("GetUsage() unexpected error: %v", err)
+	}
+	if usage.Total != 1 || usage.ByCustomer != 1 {
+		t.Errorf("GetUsage() = %+v, want one redemption", usage)
+	}
+}
+
+func TestStoreCatalogConformance(t *testing.T) {
+	catalogtest.RunRepositoryTests(t, func(t *testing.T) catalog.Repository {
+		return openTestStore(t, filepath.Join(t.TempDir(), "coupons.db"))
+	})
+}
+
+func TestStoreCustomerConformance(t *testing.T) {
+	customertest.RunRepositoryTests(t, func(t *testing.T) customer.Repository {
+		return openTestStore(t, filepath.Join(t.TempDir(), "coupons.db"))
+	})
+}
+
+// TestStoreSeededProducts checks the products of the earlier migrations are migrated into the catalog
+func TestStoreSeededProducts(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "coupons.db"))
+
+	got, err := store.GetAllProducts()
+	if err != nil {
+		t.Fatalf("GetAllProducts() unexpected error: %v", err)
+	}
+	if want := catalog.DefaultProducts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllProducts() = %+v, want %+v", got, want)
+	}
+	if _, err := store.GetProductByID(11); !errors.Is(err, catalog.ErrDoesNotExist) {
+		t.Errorf("GetProductByID(11) error = %v, want %v", err, catalog.ErrDoesNotExist)
+	}
+}
@@ -0,0 +1,167 @@
+// Package storetest holds the tests shared by the conformance suites of the repositories
+// whose entities have an auto-incrementing id, e.g. the catalogtest and the customertest suites
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// concurrency is the number of goroutines each concurrent test starts
+const concurrency = 300
+
+// missingID is an ID no repository under test has an entity for
+const missingID = 1_000_000
+
+// Repository is the repository under test as its methods, e.g. CreateProduct for Create
+type Repository[T any] struct {
+	Create func(entity T) (T, error)
+	Get    func(id int) (T, error)
+	Update func(id int, entity T) (T, error)
+	Delete func(id int) error
+}
+
+// Entity describes the entities of the repository under test
+type Entity[T any] struct {
+	// Name is the entity in the test names, e.g. "product"
+	Name string
+	// New returns a valid entity which differs for every i, e.g. in its unique fields
+	New func(i int) T
+	// ID returns the id of the entity
+	ID func(entity T) int
+	// ErrDoesNotExist is the error of the repository for the missing ids
+	ErrDoesNotExist error
+	// AssertEqual compares the entities, by default with reflect.DeepEqual
+	AssertEqual func(t *testing.T, got, want T)
+}
+
+func (e Entity[T]) assertEqual(t *testing.T, got, want T) {
+	t.Helper()
+	if e.AssertEqual != nil {
+		e.AssertEqual(t, got, want)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %+v, want %+v", e.Name, got, want)
+	}
+}
+
+// RunIDTests runs the tests of the ids, newRepo must return a new repository on every call
+func RunIDTests[T any](t *testing.T, entity Entity[T], newRepo func(t *testing.T) Repository[T]) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, entity Entity[T], repo Repository[T])
+	}{
+		{name: "missing " + entity.Name, test: testMissing[T]},
+		{name: "ids of the deleted " + entity.Name + "s are not reused", test: testDeletedIDs[T]},
+		{name: "concurrent create assigns unique ids", test: testConcurrentCreate[T]},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, entity, newRepo(t))
+		})
+	}
+}
+
+// RunReopenTests checks that a persisted repository keeps the entities and the id counter
+// open must return the repository over the files in dir, the same dir is opened twice
+func RunReopenTests[T any](t *testing.T, entity Entity[T], open func(t *testing.T, dir string) Repository[T]) {
+	dir := t.TempDir()
+	repo := open(t, dir)
+	first := mustCreate(t, entity, repo, 1)
+	second := mustCreate(t, entity, repo, 2)
+	updated, err := repo.Update(entity.ID(first), entity.New(3))
+	if err != nil {
+		t.Fatalf("update %s unexpected error: %v", entity.Name, err)
+	}
+	if err := repo.Delete(entity.ID(second)); err != nil {
+		t.Fatalf("delete %s unexpected error: %v", entity.Name, err)
+	}
+
+	reopened := open(t, dir)
+	got, err := reopened.Get(entity.ID(first))
+	if err != nil {
+		t.Fatalf("get %s after reopen unexpected error: %v", entity.Name, err)
+	}
+	entity.assertEqual(t, got, updated)
+	if _, err := reopened.Get(entity.ID(second)); !errors.Is(err, entity.ErrDoesNotExist) {
+		t.Errorf("get deleted %s after reopen error = %v, want %v", entity.Name, err, entity.ErrDoesNotExist)
+	}
+
+	// the id of the deleted entity is not reused, so it does not inherit anything of the deleted one
+	next := mustCreate(t, entity, reopened, 4)
+	if entity.ID(next) <= entity.ID(second) {
+		t.Errorf("create %s after reopen id = %d, want more than the deleted id %d", entity.Name, entity.ID(next), entity.ID(second))
+	}
+}
+
+func mustCreate[T any](t *testing.T, entity Entity[T], repo Repository[T], i int) T {
+	t.Helper()
+	created, err := repo.Create(entity.New(i))
+	if err != nil {
+		t.Fatalf("create %s unexpected error: %v", entity.Name, err)
+	}
+	return created
+}
+
+func testMissing[T any](t *testing.T, entity Entity[T], repo Repository[T]) {
+	if _, err := repo.Get(missingID); !errors.Is(err, entity.ErrDoesNotExist) {
+		t.Errorf("get %s error = %v, want %v", entity.Name, err, entity.ErrDoesNotExist)
+	}
+	if _, err := repo.Update(missingID, entity.New(1)); !errors.Is(err, entity.ErrDoesNotExist) {
+		t.Errorf("update %s error = %v, want %v", entity.Name, err, entity.ErrDoesNotExist)
+	}
+	if err := repo.Delete(missingID); !errors.Is(err, entity.ErrDoesNotExist) {
+		t.Errorf("delete %s error = %v, want %v", entity.Name, err, entity.ErrDoesNotExist)
+	}
+}
+
+func testDeletedIDs[T any](t *testing.T, entity Entity[T], repo Repository[T]) {
+	mustCreate(t, entity, repo, 1)
+	deleted := mustCreate(t, entity, repo, 2)
+	if err := repo.Delete(entity.ID(deleted)); err != nil {
+		t.Fatalf("delete %s unexpected error: %v", entity.Name, err)
+	}
+	if _, err := repo.Get(entity.ID(deleted)); !errors.Is(err, entity.ErrDoesNotExist) {
+		t.Errorf("get %s after delete error = %v, want %v", entity.Name, err, entity.ErrDoesNotExist)
+	}
+
+	// the id of the deleted entity is the highest one, it is not reused
+	// otherwise e.g. a new customer would inherit the redemptions of the deleted one
+	next := mustCreate(t, entity, repo, 3)
+	if entity.ID(next) <= entity.ID(deleted) {
+		t.Errorf("create %s after delete id = %d, want more than the deleted id %d", entity.Name, entity.ID(next), entity.ID(deleted))
+	}
+}
+
+func testConcurrentCreate[T any](t *testing.T, entity Entity[T], repo Repository[T]) {
+	ids := make(chan int, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := repo.Create(entity.New(i))
+			if err != nil {
+				t.Errorf("create %s unexpected error: %v", entity.Name, err)
+				return
+			}
+			ids <- entity.ID(created)
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool, concurrency)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("create %s assigned id %d twice", entity.Name, id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != concurrency {
+		t.Errorf("created %d %ss, want %d", len(seen), entity.Name, concurrency)
+	}
+}